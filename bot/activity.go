@@ -0,0 +1,207 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"github.com/dondish/lionplayer/player"
+	"time"
+)
+
+// VoiceState is the voice channel a user is in, empty if they left.
+type VoiceState struct {
+	GuildID   string
+	UserID    string
+	ChannelID string
+	// Self is whether it is the voice state of the bot itself.
+	Self bool
+}
+
+// activity tracks the inactivity of the player of a guild.
+type activity struct {
+	player *GuildPlayer
+	// idleTimer fires once the player didn't play for the idle timeout.
+	idleTimer *time.Timer
+	// emptyTimer fires once the voice channel had no listeners for the empty timeout.
+	emptyTimer *time.Timer
+	// autoPaused is whether the player was paused because the channel became empty.
+	autoPaused bool
+}
+
+// stop stops the timers.
+func (a *activity) stop() {
+	if a.idleTimer != nil {
+		a.idleTimer.Stop()
+		a.idleTimer = nil
+	}
+	if a.emptyTimer != nil {
+		a.emptyTimer.Stop()
+		a.emptyTimer = nil
+	}
+}
+
+// HandleVoiceState updates the inactivity of the guild after a user joined, moved or left a voice channel.
+//
+// When the bot itself was disconnected its player is removed, when it was moved the player follows.
+func (b *Bot) HandleVoiceState(vs VoiceState) {
+	if vs.GuildID == "" || b.closed() || !b.Shard.Owns(vs.GuildID) {
+		return
+	}
+	if vs.Self {
+		gp := b.Manager.Get(vs.GuildID)
+		if gp == nil {
+			return
+		}
+		if vs.ChannelID == "" {
+			b.Manager.Remove(vs.GuildID)
+			b.forgetActivity(vs.GuildID)
+			return
+		}
+		if gp.VoiceChannel() != vs.ChannelID {
+			_ = gp.Join(vs.ChannelID)
+		}
+	}
+	b.checkActivity(vs.GuildID)
+}
+
+// onActivity updates the inactivity of a guild after its player started or stopped playing.
+func (b *Bot) onActivity(gp *GuildPlayer, e player.Event) {
+	switch e.(type) {
+	case player.TrackStartEvent, player.TrackEndEvent:
+		b.checkActivity(gp.GuildID())
+	}
+}
+
+// checkActivity pauses the player of the guild while nobody listens and times out leaving when inactive.
+func (b *Bot) checkActivity(guildID string) {
+	gp := b.Manager.Get(guildID)
+	if gp == nil {
+		b.forgetActivity(guildID)
+		return
+	}
+	channelID := gp.VoiceChannel()
+	if channelID == "" {
+		return
+	}
+	settings := b.Settings.Get(guildID)
+	empty := len(b.session.VoiceListeners(guildID, channelID)) == 0
+
+	b.actMu.Lock()
+	defer b.actMu.Unlock()
+	a := b.activities[guildID]
+	if a == nil || a.player != gp {
+		if a != nil {
+			a.stop()
+		}
+		a = &activity{player: gp}
+		b.activities[guildID] = a
+	}
+	p := gp.Player()
+	if empty {
+		if gp.Current() != nil && !p.Paused() {
+			p.Pause(true)
+			a.autoPaused = true
+		}
+		if a.emptyTimer == nil && !settings.AlwaysOn && settings.EmptyTimeout > 0 {
+			a.emptyTimer = time.AfterFunc(time.Duration(settings.EmptyTimeout), func() {
+				b.expire(gp, false)
+			})
+		}
+	} else {
+		if a.autoPaused {
+			a.autoPaused = false
+			p.Pause(false)
+		}
+		if a.emptyTimer != nil {
+			a.emptyTimer.Stop()
+			a.emptyTimer = nil
+		}
+	}
+	if a.idle() && !settings.AlwaysOn && settings.IdleTimeout > 0 {
+		if a.idleTimer == nil {
+			a.idleTimer = time.AfterFunc(time.Duration(settings.IdleTimeout), func() {
+				b.expire(gp, true)
+			})
+		}
+	} else if a.idleTimer != nil {
+		a.idleTimer.Stop()
+		a.idleTimer = nil
+	}
+}
+
+// idle returns whether the player isn't doing anything, pausing while nobody listens doesn't count.
+func (a *activity) idle() bool {
+	gp := a.player
+	return (gp.Current() == nil || (gp.Player().Paused() && !a.autoPaused)) && !gp.Recording()
+}
+
+// expire leaves the voice channel of the player if it is still inactive once a timer fired.
+func (b *Bot) expire(gp *GuildPlayer, idle bool) {
+	guildID := gp.GuildID()
+	b.actMu.Lock()
+	a := b.activities[guildID]
+	if a == nil || a.player != gp || b.Manager.Get(guildID) != gp {
+		b.actMu.Unlock()
+		return
+	}
+	if idle {
+		a.idleTimer = nil
+	} else {
+		a.emptyTimer = nil
+	}
+	stillIdle := a.idle()
+	b.actMu.Unlock()
+
+	settings := b.Settings.Get(guildID)
+	var reason string
+	switch {
+	case settings.AlwaysOn:
+		return
+	case idle && stillIdle:
+		reason = fmt.Sprintf("after %s without playing", time.Duration(settings.IdleTimeout))
+	case !idle && len(b.session.VoiceListeners(guildID, gp.VoiceChannel())) == 0:
+		reason = "since everyone left"
+	default:
+		// It became active meanwhile, the timer is armed again once it becomes inactive.
+		b.checkActivity(guildID)
+		return
+	}
+	channelID := b.announceChannel(gp)
+	b.Manager.Remove(guildID)
+	b.forgetActivity(guildID)
+	if channelID != "" {
+		_, _ = b.session.SendMessage(channelID, "Left the voice channel "+reason)
+	}
+}
+
+// forgetActivity stops tracking the inactivity of a guild.
+func (b *Bot) forgetActivity(guildID string) {
+	b.actMu.Lock()
+	defer b.actMu.Unlock()
+	if a, ok := b.activities[guildID]; ok {
+		a.stop()
+		delete(b.activities, guildID)
+	}
+}
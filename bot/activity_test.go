@@ -0,0 +1,71 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestActivity(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	settings := b.Settings.Defaults()
+	settings.IdleTimeout = Duration(50 * time.Millisecond)
+	settings.EmptyTimeout = Duration(50 * time.Millisecond)
+	assert.Nil(t, b.Settings.Set("1", settings), "error is supposed to be nil")
+	setVoice := func(channelID string) {
+		s.mu.Lock()
+		s.voice["u"] = channelID
+		s.mu.Unlock()
+		b.HandleVoiceState(VoiceState{GuildID: "1", UserID: "u", ChannelID: channelID})
+	}
+
+	setVoice("voice")
+	send(b, s, "u", "!!play a")
+	gp := b.Manager.Get("1")
+	setVoice("")
+	assert.True(t, gp.Player().Paused(), "the player should pause once everyone left")
+	setVoice("voice")
+	assert.False(t, gp.Player().Paused(), "the player should resume once someone is back")
+	setVoice("")
+	waitFor(t, "the bot should leave the empty channel", func() bool { return b.Manager.Get("1") == nil })
+	waitFor(t, "the bot should say why it left", func() bool { return s.last() == "Left the voice channel since everyone left" })
+
+	setVoice("voice")
+	send(b, s, "u", "!!play b")
+	send(b, s, "u", "!!stop")
+	waitFor(t, "the bot should leave when idle", func() bool { return b.Manager.Get("1") == nil })
+	waitFor(t, "the bot should say why it left", func() bool { return s.last() == "Left the voice channel after 50ms without playing" })
+
+	settings.AlwaysOn = true
+	assert.Nil(t, b.Settings.Set("1", settings), "error is supposed to be nil")
+	send(b, s, "u", "!!play c")
+	send(b, s, "u", "!!pause")
+	setVoice("")
+	time.Sleep(150 * time.Millisecond)
+	assert.NotNil(t, b.Manager.Get("1"), "24/7 mode should stay")
+}
@@ -0,0 +1,554 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/dondish/lionplayer/player"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIUser is the id of the user the API runs commands on behalf of.
+const APIUser = "api"
+
+// apiEventBuffer is the number of events buffered for each event stream, events are dropped for streams that
+// fall further behind.
+const apiEventBuffer = 64
+
+// apiKeepAlive is the interval of the comments sent to keep idle event streams open.
+const apiKeepAlive = 30 * time.Second
+
+// APITrack describes a track in the responses of the API.
+type APITrack struct {
+	TrackState
+	Info lavalink.TrackInfo `json:"info"`
+}
+
+// APIPlayer describes a guild player in the responses of the API.
+type APIPlayer struct {
+	GuildID      string   `json:"guildId"`
+	VoiceChannel string   `json:"voiceChannel"`
+	TextChannel  string   `json:"textChannel"`
+	Loop         LoopMode `json:"loop"`
+	Paused       bool     `json:"paused"`
+	// Current is the track playing, nil if none.
+	Current *APITrack `json:"current"`
+	// Position is the position in the current track in milliseconds.
+	Position int64      `json:"position"`
+	Queue    []APITrack `json:"queue"`
+}
+
+// APIEvent is an event of a guild player sent by the event streams of the API.
+type APIEvent struct {
+	// Type is one of trackStart, trackEnd, trackException, trackStuck and sinkError.
+	Type    string    `json:"type"`
+	GuildID string    `json:"guildId"`
+	Track   *APITrack `json:"track,omitempty"`
+	// Reason is the reason the track ended, for trackEnd events.
+	Reason player.EndReason `json:"reason,omitempty"`
+	// Error is what failed, for trackException and sinkError events.
+	Error string `json:"error,omitempty"`
+}
+
+// APIRequest is the body of the requests that run commands, each command uses the fields it needs.
+type APIRequest struct {
+	// Query is the url or the search query to play.
+	Query string `json:"query,omitempty"`
+	// VoiceChannel is the voice channel to play in, the one the bot is in if empty.
+	VoiceChannel string `json:"voiceChannel,omitempty"`
+	// TextChannel is the text channel to announce the tracks in, the one the player is bound to if empty.
+	TextChannel string `json:"textChannel,omitempty"`
+	// Position is the position to seek to, it takes the same forms the seek command does.
+	Position string `json:"position,omitempty"`
+	// Amount is the number of tracks to skip.
+	Amount int `json:"amount,omitempty"`
+	// Mode is the loop mode to set, off, track or queue.
+	Mode string `json:"mode,omitempty"`
+	// From and To are the positions in the queue to move a track between.
+	From int `json:"from,omitempty"`
+	To   int `json:"to,omitempty"`
+	// Settings are the settings to change by the names the settings command uses.
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// APIResult is the response of the requests that run commands.
+type APIResult struct {
+	// Messages are the replies of the commands.
+	Messages []string `json:"messages"`
+	// Player is the player once the commands ran, nil if the guild has none.
+	Player *APIPlayer `json:"player"`
+}
+
+// APIError is the response of the requests that failed.
+type APIError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// apiCommands are the commands run by POST /v1/guilds/{guild}/{action}, by action, with the arguments they
+// take from the request.
+var apiCommands = map[string]struct {
+	name string
+	args func(req APIRequest) string
+}{
+	"play":     {"play", func(req APIRequest) string { return req.Query }},
+	"pause":    {"pause", nil},
+	"resume":   {"resume", nil},
+	"stop":     {"stop", nil},
+	"leave":    {"leave", nil},
+	"previous": {"previous", nil},
+	"replay":   {"replay", nil},
+	"shuffle":  {"shuffle", nil},
+	"seek":     {"seek", func(req APIRequest) string { return req.Position }},
+	"loop":     {"loop", func(req APIRequest) string { return req.Mode }},
+	"skip": {"skip", func(req APIRequest) string {
+		if req.Amount > 0 {
+			return strconv.Itoa(req.Amount)
+		}
+		return ""
+	}},
+}
+
+// API is an http.Handler serving a REST API to control the players of the bot, for dashboards and the like.
+//
+// The requests that change a player run the same commands users send on behalf of APIUser, who has full control
+// of the players, so they are validated like the commands are and their replies are returned in the result.
+//
+// The endpoints are:
+//
+//	GET    /v1/guilds                            the players of all guilds
+//	GET    /v1/events                            the events of all players, as server-sent events
+//	GET    /v1/guilds/{guild}                    the player of a guild
+//	GET    /v1/guilds/{guild}/events             the events of the player of a guild
+//	GET    /v1/guilds/{guild}/queue              the queue
+//	DELETE /v1/guilds/{guild}/queue              clears the queue
+//	DELETE /v1/guilds/{guild}/queue/{position}   removes a track from the queue
+//	POST   /v1/guilds/{guild}/queue/move         moves a track in the queue
+//	GET    /v1/guilds/{guild}/settings           the settings of a guild
+//	PATCH  /v1/guilds/{guild}/settings           changes the settings of a guild
+//	POST   /v1/guilds/{guild}/{action}           play, pause, resume, skip, seek, stop, leave, previous, replay,
+//	                                             shuffle or loop
+type API struct {
+	// Token is the token clients must send in the Authorization header as "Bearer <token>", empty disables
+	// authorization.
+	Token string
+
+	// bots are the bots of the shards controlled, see Supervisor.API.
+	bots []*Bot
+}
+
+// NewAPI creates an API controlling the bot given.
+func NewAPI(b *Bot, token string) *API {
+	return &API{Token: token, bots: []*Bot{b}}
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, APIError{Status: status, Error: message})
+}
+
+// ServeHTTP implements http.Handler.
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, b := range a.bots {
+		if b.closed() {
+			writeError(w, http.StatusServiceUnavailable, "shutting down")
+			return
+		}
+	}
+	if a.Token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/v1/guilds" && r.Method == http.MethodGet:
+		players := []*APIPlayer{}
+		for _, b := range a.bots {
+			for _, gp := range b.Manager.Guilds() {
+				players = append(players, apiPlayer(gp))
+			}
+		}
+		sort.Slice(players, func(i, j int) bool {
+			return players[i].GuildID < players[j].GuildID
+		})
+		writeJSON(w, http.StatusOK, players)
+	case path == "/v1/events" && r.Method == http.MethodGet:
+		a.serveEvents(w, r, a.bots, "")
+	case strings.HasPrefix(path, "/v1/guilds/"):
+		a.serveGuild(w, r, strings.Split(strings.TrimPrefix(path, "/v1/guilds/"), "/"))
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *API) serveGuild(w http.ResponseWriter, r *http.Request, parts []string) {
+	guildID := parts[0]
+	b := botOf(a.bots, guildID)
+	if b == nil {
+		writeError(w, http.StatusNotFound, "guild not served by this process")
+		return
+	}
+	gp := b.Manager.Get(guildID)
+	resource := strings.Join(parts[1:], "/")
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		if gp == nil {
+			writeError(w, http.StatusNotFound, "player not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, apiPlayer(gp))
+	case resource == "events" && r.Method == http.MethodGet:
+		a.serveEvents(w, r, []*Bot{b}, guildID)
+	case resource == "queue" && r.Method == http.MethodGet:
+		queue := []APITrack{}
+		if gp != nil {
+			queue = apiTracks(gp.Queue().Tracks())
+		}
+		writeJSON(w, http.StatusOK, queue)
+	case resource == "queue" && r.Method == http.MethodDelete:
+		a.run(w, r, b, guildID, func(APIRequest) []string { return []string{"clear"} })
+	case resource == "queue/move" && r.Method == http.MethodPost:
+		a.run(w, r, b, guildID, func(req APIRequest) []string {
+			return []string{fmt.Sprintf("move %d %d", req.From, req.To)}
+		})
+	case len(parts) == 3 && parts[1] == "queue" && r.Method == http.MethodDelete:
+		a.run(w, r, b, guildID, func(APIRequest) []string { return []string{"remove " + parts[2]} })
+	case resource == "settings" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, b.Settings.Get(guildID))
+	case resource == "settings" && r.Method == http.MethodPatch:
+		a.run(w, r, b, guildID, func(req APIRequest) []string {
+			var commands []string
+			for name, value := range req.Settings {
+				commands = append(commands, "settings "+name+" "+value)
+			}
+			sort.Strings(commands)
+			return commands
+		})
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		command, ok := apiCommands[parts[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		a.run(w, r, b, guildID, func(req APIRequest) []string {
+			if command.args == nil {
+				return []string{command.name}
+			}
+			return []string{command.name + " " + command.args(req)}
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// run runs the commands the request given asks for, each being the name of a command followed by its arguments.
+//
+// It stops at the first command that fails, which fails the request.
+func (a *API) run(w http.ResponseWriter, r *http.Request, b *Bot, guildID string, commands func(req APIRequest) []string) {
+	var req APIRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	session := &apiSession{Session: b.session, voiceChannel: req.VoiceChannel}
+	m := Message{GuildID: guildID, ChannelID: req.TextChannel, AuthorID: APIUser}
+	if gp := b.Manager.Get(guildID); gp != nil {
+		if session.voiceChannel == "" {
+			session.voiceChannel = gp.VoiceChannel()
+		}
+		if m.ChannelID == "" {
+			m.ChannelID = gp.TextChannel()
+		}
+	}
+	for _, command := range commands(req) {
+		name, rest := nextWord(command)
+		if err := b.Router.Run(session, m, b.Router.Command(name), rest); err != nil {
+			if ue, ok := err.(UserError); ok {
+				writeError(w, http.StatusBadRequest, string(ue))
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+	}
+	result := APIResult{Messages: session.messages()}
+	if gp := b.Manager.Get(guildID); gp != nil {
+		result.Player = apiPlayer(gp)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// serveEvents streams the events of the player of the guild given as server-sent events, of all players of the bots
+// given if empty.
+func (a *API) serveEvents(w http.ResponseWriter, r *http.Request, bots []*Bot, guildID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	events := subscribeAll(bots, guildID, r.Context().Done())
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ticker := time.NewTicker(apiKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(e)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		case <-ticker.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// apiSession is the session the commands run by the API use.
+//
+// It keeps the replies instead of sending them, and gives APIUser full permissions in the voice channel the
+// request is about.
+type apiSession struct {
+	Session
+	voiceChannel string
+
+	mu      sync.Mutex
+	replies []string
+}
+
+func (s *apiSession) messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.replies...)
+}
+
+// SendMessage implements Session, the message is kept as a reply.
+func (s *apiSession) SendMessage(channelID, content string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, content)
+	return "api" + strconv.Itoa(len(s.replies)), nil
+}
+
+// SendEmbed implements Session, the title and the description of the embed are kept as a reply.
+func (s *apiSession) SendEmbed(channelID string, embed *Embed) (string, error) {
+	return s.SendMessage(channelID, strings.TrimSpace(embed.Title+"\n"+embed.Description))
+}
+
+// EditEmbed implements Session, the replies are never edited.
+func (s *apiSession) EditEmbed(channelID, messageID string, embed *Embed) error {
+	return nil
+}
+
+// AddReaction implements Session, the replies have no reactions.
+func (s *apiSession) AddReaction(channelID, messageID, emoji string) error {
+	return nil
+}
+
+// UserVoiceChannel implements Session, APIUser is in the voice channel of the request.
+func (s *apiSession) UserVoiceChannel(guildID, userID string) string {
+	if userID == APIUser {
+		return s.voiceChannel
+	}
+	return s.Session.UserVoiceChannel(guildID, userID)
+}
+
+// UserPermissions implements Session, APIUser has all of the permissions.
+func (s *apiSession) UserPermissions(userID, channelID string) (int, error) {
+	if userID == APIUser {
+		return discordgo.PermissionAll, nil
+	}
+	return s.Session.UserPermissions(userID, channelID)
+}
+
+// MemberRoles implements Session, APIUser has no roles.
+func (s *apiSession) MemberRoles(guildID, userID string) ([]string, error) {
+	if userID == APIUser {
+		return nil, nil
+	}
+	return s.Session.MemberRoles(guildID, userID)
+}
+
+// apiTrack describes a track for the API, tracks that can't be encoded have an empty Track.
+func apiTrack(track *Track) APITrack {
+	ts, _ := trackState(track)
+	ts.Requester = track.Requester
+	return APITrack{TrackState: ts, Info: track.Info}
+}
+
+// apiTracks describes tracks for the API.
+func apiTracks(tracks []*Track) []APITrack {
+	described := make([]APITrack, len(tracks))
+	for i, track := range tracks {
+		described[i] = apiTrack(track)
+	}
+	return described
+}
+
+// apiPlayer describes a guild player for the API.
+func apiPlayer(gp *GuildPlayer) *APIPlayer {
+	p := &APIPlayer{
+		GuildID:      gp.GuildID(),
+		VoiceChannel: gp.VoiceChannel(),
+		TextChannel:  gp.TextChannel(),
+		Loop:         gp.Loop(),
+		Paused:       gp.Player().Paused(),
+		Queue:        apiTracks(gp.Queue().Tracks()),
+	}
+	if current := gp.Current(); current != nil {
+		track := apiTrack(current)
+		p.Current = &track
+		p.Position = int64(gp.Player().Position() / time.Millisecond)
+	}
+	return p
+}
+
+// apiEvent describes an event of a guild player for the API, ok is false for events of other tracks.
+func apiEvent(gp *GuildPlayer, e player.Event) (event APIEvent, ok bool) {
+	track, ok := e.EventTrack().(*Track)
+	if !ok {
+		return event, false
+	}
+	described := apiTrack(track)
+	event = APIEvent{GuildID: gp.GuildID(), Track: &described}
+	switch e := e.(type) {
+	case player.TrackStartEvent:
+		event.Type = "trackStart"
+	case player.TrackEndEvent:
+		event.Type, event.Reason = "trackEnd", e.Reason
+	case player.TrackExceptionEvent:
+		event.Type, event.Error = "trackException", e.Err.Error()
+	case player.TrackStuckEvent:
+		event.Type = "trackStuck"
+	case player.SinkErrorEvent:
+		event.Type, event.Error = "sinkError", e.Err.Error()
+	default:
+		return event, false
+	}
+	return event, true
+}
+
+// subscribe returns a channel receiving the events of the player of the guild given, of all players if empty.
+func (b *Bot) subscribe(guildID string) chan APIEvent {
+	events := make(chan APIEvent, apiEventBuffer)
+	b.evMu.Lock()
+	defer b.evMu.Unlock()
+	b.listeners[events] = guildID
+	return events
+}
+
+// unsubscribe stops passing events to the channel given and closes it.
+func (b *Bot) unsubscribe(events chan APIEvent) {
+	b.evMu.Lock()
+	defer b.evMu.Unlock()
+	if _, ok := b.listeners[events]; ok {
+		delete(b.listeners, events)
+		close(events)
+	}
+}
+
+// subscribeAll returns a channel receiving the events of the bots given like subscribe, until done is closed.
+//
+// The channel is closed once done is closed or all of the bots shut down.
+func subscribeAll(bots []*Bot, guildID string, done <-chan struct{}) <-chan APIEvent {
+	merged := make(chan APIEvent, apiEventBuffer)
+	var wg sync.WaitGroup
+	for _, b := range bots {
+		wg.Add(1)
+		go func(b *Bot, events chan APIEvent) {
+			defer wg.Done()
+			defer b.unsubscribe(events)
+			for {
+				select {
+				case e, ok := <-events:
+					if !ok {
+						return
+					}
+					select {
+					case merged <- e:
+					case <-done:
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}(b, b.subscribe(guildID))
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// publish passes an event of a guild player to the subscribers, those whose buffer is full miss it.
+func (b *Bot) publish(gp *GuildPlayer, e player.Event) {
+	b.evMu.Lock()
+	defer b.evMu.Unlock()
+	if len(b.listeners) == 0 {
+		return
+	}
+	event, ok := apiEvent(gp, e)
+	if !ok {
+		return
+	}
+	for events, guildID := range b.listeners {
+		if guildID != "" && guildID != event.GuildID {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
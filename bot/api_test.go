@@ -0,0 +1,119 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// apiRequest sends a request to the API with the token given and decodes the JSON response into v.
+func apiRequest(t *testing.T, server *httptest.Server, token, method, path, body string, v interface{}) int {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.Nil(t, err, "error is supposed to be nil")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if v != nil {
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(v), "error is supposed to be nil")
+	}
+	return res.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	b, _, _ := newTestBot()
+	defer b.Close()
+	server := httptest.NewServer(NewAPI(b, "secret"))
+	defer server.Close()
+
+	var apiErr APIError
+	assert.Equal(t, http.StatusUnauthorized, apiRequest(t, server, "wrong", "GET", "/v1/guilds", "", &apiErr))
+	var players []*APIPlayer
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "GET", "/v1/guilds", "", &players))
+	assert.Empty(t, players)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, server, "secret", "GET", "/v1/guilds/1", "", &apiErr))
+
+	req, _ := http.NewRequest("GET", server.URL+"/v1/guilds/1/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	events := bufio.NewScanner(stream.Body)
+
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/play", `{"query": "a"}`, &apiErr))
+	assert.Equal(t, ErrNotInVoice.Error(), apiErr.Error, "the API needs a voice channel to join")
+	var result APIResult
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/play",
+		`{"query": "a", "voiceChannel": "voice", "textChannel": "text"}`, &result))
+	assert.Equal(t, "voice", result.Player.VoiceChannel)
+	assert.Equal(t, "text", result.Player.TextChannel)
+	assert.Equal(t, "a", result.Player.Current.Info.Title)
+	assert.Equal(t, APIUser, result.Player.Current.Requester)
+
+	var event APIEvent
+	for events.Scan() {
+		if line := events.Text(); strings.HasPrefix(line, "data: ") {
+			assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event), "error is supposed to be nil")
+			break
+		}
+	}
+	assert.Equal(t, "trackStart", event.Type)
+	assert.Equal(t, "a", event.Track.Info.Title)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/play", `{"query": "b"}`, &result))
+	assert.Equal(t, []string{"Queued - b -  [#1]"}, result.Messages, "the player's voice channel is used by default")
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/pause", "", &result))
+	assert.True(t, result.Player.Paused, "the player should be paused")
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/seek", `{"position": "0:05"}`, &result))
+	assert.Equal(t, int64(5000), result.Player.Position)
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/seek", `{"position": "1:00"}`, &apiErr))
+	assert.Equal(t, "The track is only 0:20 long", apiErr.Error)
+
+	var queue []APITrack
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "GET", "/v1/guilds/1/queue", "", &queue))
+	assert.Len(t, queue, 1)
+	assert.Equal(t, "b", queue[0].Info.Title)
+	assert.NotEmpty(t, queue[0].Track, "the tracks should be encoded")
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "DELETE", "/v1/guilds/1/queue/1", "", &result))
+	assert.Empty(t, result.Player.Queue)
+
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "PATCH", "/v1/guilds/1/settings",
+		`{"settings": {"volume": "50", "fair": "on"}}`, &result))
+	assert.Equal(t, []string{"Changed fair to on", "Changed volume to 50 (informational only, the audio is not re-encoded)"}, result.Messages)
+	var settings Settings
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "secret", "GET", "/v1/guilds/1/settings", "", &settings))
+	assert.Equal(t, 50, settings.Volume)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, server, "secret", "POST", "/v1/guilds/1/dance", "", &apiErr))
+}
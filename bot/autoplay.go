@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// autoplayCandidates is the amount of related tracks autoplay picks from.
+const autoplayCandidates = 10
+
+// autoplay plays a track related to the last track once the queue ran out, if the guild turned autoplay on.
+func (b *Bot) autoplay(gp *GuildPlayer, last *Track) {
+	recommender, ok := b.Loader.(Recommender)
+	if !ok || !gp.Settings().Autoplay {
+		return
+	}
+	track, err := pickRelated(recommender, gp.History(), last)
+	if err != nil {
+		if channelID := b.announceChannel(gp); channelID != "" {
+			text := fmt.Sprintf("Autoplay failed: %s", err)
+			if err == ErrNoMatches {
+				text = "Autoplay found nothing new to play"
+			}
+			_, _ = b.session.SendMessage(channelID, text)
+		}
+		return
+	}
+	// Someone may have played a track meanwhile.
+	if gp.Current() == nil {
+		_, _ = gp.Enqueue(track)
+	}
+}
+
+// pickRelated returns the first track related to the track given that isn't in the history.
+func pickRelated(r Recommender, history *History, last *Track) (*Track, error) {
+	related, err := r.Related(last, autoplayCandidates)
+	if err != nil {
+		return nil, err
+	}
+	played := map[string]bool{trackKey(last): true}
+	for _, entry := range history.Entries() {
+		played[trackKey(entry.Track)] = true
+	}
+	for _, track := range related {
+		if !played[trackKey(track)] {
+			return track, nil
+		}
+	}
+	return nil, ErrNoMatches
+}
+
+// trackKey identifies a track regardless of how many times it was loaded.
+func trackKey(t *Track) string {
+	if t.Info.Identifier == "" {
+		return t.Title()
+	}
+	return t.Info.SourceName + ":" + t.Info.Identifier
+}
+
+// setAutoplay shows or changes whether the guild plays related tracks once the queue runs out.
+func (b *Bot) setAutoplay(ctx *Context) error {
+	settings := b.Settings.Get(ctx.GuildID)
+	if !ctx.Has(0) {
+		return ctx.Reply("Autoplay: %s", onOff(settings.Autoplay))
+	}
+	if !b.isDJ(ctx) {
+		return ErrNotDJ
+	}
+	switch strings.ToLower(ctx.String(0)) {
+	case "on":
+		settings.Autoplay = true
+	case "off":
+		settings.Autoplay = false
+	default:
+		return UserError("Usage: " + ctx.Command.Usage(ctx.Prefix))
+	}
+	if err := b.Settings.Set(ctx.GuildID, settings); err != nil {
+		return err
+	}
+	b.applySettings(ctx.GuildID)
+	return ctx.Reply("Autoplay: %s", onOff(settings.Autoplay))
+}
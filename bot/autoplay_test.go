@@ -0,0 +1,59 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAutoplay(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	b.Loader = fakeLoader{packets: 5}
+	s.voice["u"] = "voice"
+	s.permissions["u"] = discordgo.PermissionManageServer
+
+	assert.Equal(t, "Autoplay: off", send(b, s, "u", "!!autoplay"))
+	send(b, s, "u", "!!play a")
+	waitFor(t, "the track should finish", func() bool {
+		return b.Manager.History("1").Len() == 1
+	})
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, b.Manager.Get("1").Current(), "nothing should play with autoplay off")
+
+	assert.Equal(t, "Autoplay: on", send(b, s, "u", "!!autoplay on"))
+	send(b, s, "u", "!!play b")
+	waitFor(t, "autoplay should run out of new tracks", func() bool {
+		return s.last() == "Autoplay found nothing new to play"
+	})
+	var played []string
+	for _, entry := range b.Manager.History("1").Entries() {
+		played = append(played, entry.Track.Title())
+	}
+	assert.Equal(t, []string{"related 3", "related 2", "related 1", "b", "a"}, played, "related tracks should play once each")
+}
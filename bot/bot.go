@@ -0,0 +1,406 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/dondish/lionplayer/player"
+	"github.com/dondish/lionplayer/youtube"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPrefix is the default prefix of the commands.
+const DefaultPrefix = "!!"
+
+// ErrClosed is returned when shutting down a bot that was already shut down.
+var ErrClosed = errors.New("the bot is closed")
+
+// ErrNoMatches is returned by a Loader when nothing matches the query.
+var ErrNoMatches = UserError("No matches found")
+
+// Loader resolves what users ask to play into tracks.
+type Loader interface {
+	// Load returns the tracks matching the query, ErrNoMatches if there are none.
+	Load(query string) ([]*Track, error)
+}
+
+// Searcher is a Loader that can also search for tracks.
+type Searcher interface {
+	Loader
+	// Search returns up to limit tracks matching the query, ErrNoMatches if there are none.
+	Search(query string, limit int) ([]*Track, error)
+}
+
+// Resolver is a Loader that can recreate the tracks it loaded from their info.
+type Resolver interface {
+	Loader
+	// Resolve returns the track described by the info given, ErrNoMatches if it isn't one of this loader's.
+	Resolve(info lavalink.TrackInfo) (*Track, error)
+}
+
+// Recommender is a Loader that can suggest tracks to play after a track.
+type Recommender interface {
+	Loader
+	// Related returns up to limit tracks related to the track given, ErrNoMatches if there are none.
+	Related(track *Track, limit int) ([]*Track, error)
+}
+
+// YoutubeLoader loads youtube video urls and searches youtube for anything else.
+type YoutubeLoader struct {
+	*youtube.Source
+}
+
+// Load implements Loader, text that isn't a video url loads the first search result.
+func (l YoutubeLoader) Load(query string) ([]*Track, error) {
+	if !l.CheckVideoUrl(query) {
+		return l.Search(query, 1)
+	}
+	track, err := l.PlayVideoUrl(query)
+	if err != nil {
+		return nil, err
+	}
+	return []*Track{NewYoutubeTrack(track, "")}, nil
+}
+
+// Resolve implements Resolver, the stream url is resolved again once the track is played.
+func (l YoutubeLoader) Resolve(info lavalink.TrackInfo) (*Track, error) {
+	if info.SourceName != "youtube" {
+		return nil, ErrNoMatches
+	}
+	length := time.Duration(info.Length) * time.Millisecond
+	return NewYoutubeTrack(l.NewTrack(info.Identifier, info.Title, info.Author, length, info.IsStream), ""), nil
+}
+
+// Related implements Recommender, youtube suggests the tracks to watch next.
+func (l YoutubeLoader) Related(track *Track, limit int) ([]*Track, error) {
+	if track.Info.SourceName != "youtube" {
+		return nil, ErrNoMatches
+	}
+	found, err := l.Source.Related(track.Info.Identifier, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNoMatches
+	}
+	tracks := make([]*Track, len(found))
+	for i, track := range found {
+		tracks[i] = NewYoutubeTrack(track, "")
+	}
+	return tracks, nil
+}
+
+// Search implements Searcher.
+func (l YoutubeLoader) Search(query string, limit int) ([]*Track, error) {
+	found, err := l.Source.Search(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrNoMatches
+	}
+	tracks := make([]*Track, len(found))
+	for i, track := range found {
+		tracks[i] = NewYoutubeTrack(track, "")
+	}
+	return tracks, nil
+}
+
+// Bot is the music bot, it runs the commands users send and reports what the players do.
+type Bot struct {
+	Manager *GuildPlayerManager
+	Router  *Router
+	Loader  Loader
+	// Shard is the shard the bot serves, it ignores the guilds of other shards.
+	Shard Shard
+	// Settings keeps the settings of the guilds.
+	Settings *SettingsStore
+	// StateFile is the file the players are saved in, empty to not save them.
+	StateFile string
+	// Playlists keeps the saved playlists, nil if they are disabled.
+	Playlists *PlaylistStore
+	// RecordDir is the directory recordings are saved in.
+	RecordDir string
+	// SearchResults is the number of results a search shows, up to 9.
+	SearchResults int
+	// SearchTimeout is how long users have to pick a search result.
+	SearchTimeout time.Duration
+	// NowPlayingInterval is the interval to update the now playing message in, zero to not update it.
+	NowPlayingInterval time.Duration
+
+	session Session
+	// closing is set once the bot starts shutting down, from then on it ignores users.
+	closing int32
+	// ownsStores is whether the bot opened the settings and the playlists, and closes the playlists.
+	ownsStores bool
+	// ready is set while the bot is connected and able to serve users, see SetReady.
+	ready      int32
+	selMu      sync.Mutex
+	selections map[string]*selection
+	actMu      sync.Mutex
+	activities map[string]*activity
+	npMu       sync.Mutex
+	npMessages map[string]*nowPlayingMessage
+	evMu       sync.Mutex
+	listeners  map[chan APIEvent]string
+	stopSaving chan struct{}
+	// saving is done once the periodic saving stopped, so it can't overwrite the state saved on shutdown.
+	saving sync.WaitGroup
+	// writeState writes the state file.
+	writeState func(path string, data []byte) error
+}
+
+// New creates a bot configured by the config given, using the session to talk to users and the voice joiner to play.
+//
+// The bot serves the shard of the config, see Supervisor to run several shards.
+func New(config Config, session Session, join VoiceJoiner, loader Loader) (*Bot, error) {
+	settings, playlists, err := openStores(config)
+	if err != nil {
+		return nil, err
+	}
+	b, err := newBot(config, settings, playlists, session, join, loader)
+	if err != nil {
+		return nil, err
+	}
+	b.ownsStores = true
+	return b, nil
+}
+
+// openStores opens the settings and the playlists of the config given.
+func openStores(config Config) (*SettingsStore, *PlaylistStore, error) {
+	settings, err := OpenSettingsStore(config.SettingsFile, config.GuildSettings())
+	if err != nil {
+		return nil, nil, err
+	}
+	var playlists *PlaylistStore
+	if config.PlaylistFile != "" {
+		if playlists, err = OpenPlaylistStore(config.PlaylistFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return settings, playlists, nil
+}
+
+// newBot creates a bot using the stores given, which it doesn't close.
+func newBot(config Config, settings *SettingsStore, playlists *PlaylistStore, session Session, join VoiceJoiner, loader Loader) (*Bot, error) {
+	manager := NewGuildPlayerManager(join)
+	manager.Settings = settings.Get
+	manager.HistoryLength = config.Limits.HistoryLength
+	manager.Shard = config.Shard.ID
+	b := &Bot{
+		Manager:            manager,
+		Router:             NewRouter(config.Prefix, manager),
+		Loader:             loader,
+		Shard:              config.Shard,
+		Settings:           settings,
+		Playlists:          playlists,
+		StateFile:          config.StateFile,
+		RecordDir:          config.RecordDir,
+		SearchResults:      config.Limits.SearchResults,
+		SearchTimeout:      time.Duration(config.Limits.SearchTimeout),
+		NowPlayingInterval: time.Duration(config.NowPlayingInterval),
+		session:            session,
+		selections:         make(map[string]*selection),
+		activities:         make(map[string]*activity),
+		npMessages:         make(map[string]*nowPlayingMessage),
+		listeners:          make(map[chan APIEvent]string),
+		stopSaving:         make(chan struct{}),
+		writeState:         writeFileAtomic,
+	}
+	b.Router.GuildPrefix = func(guildID string) string {
+		return settings.Get(guildID).Prefix
+	}
+	b.Router.DJ = b.isDJ
+	_ = b.Router.Register(b.commands()...)
+	b.Manager.OnDisconnect = func(gp *GuildPlayer, err error) {
+		b.forgetActivity(gp.GuildID())
+		if channelID := b.announceChannel(gp); channelID != "" {
+			_, _ = b.session.SendMessage(channelID, fmt.Sprintf("Lost the voice connection: %s", err))
+		}
+	}
+	b.Manager.OnQueueEnd = b.autoplay
+	b.Manager.OnEvent = func(gp *GuildPlayer, e player.Event) {
+		b.publish(gp, e)
+		go func() {
+			b.onActivity(gp, e)
+			b.announce(gp, e)
+		}()
+	}
+	if b.StateFile != "" && config.StateInterval > 0 {
+		b.saving.Add(1)
+		go b.saveEvery(time.Duration(config.StateInterval))
+	}
+	return b, nil
+}
+
+// saveEvery saves the state of the players periodically until the bot is closed, b.saving must be added to
+// before it is started.
+func (b *Bot) saveEvery(interval time.Duration) {
+	defer b.saving.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if b.closed() {
+				return
+			}
+			if err := b.SaveState(); err != nil {
+				core.LoggerOr(b.Manager.Logger).Log(core.LevelError, "saving the state failed", core.F(core.KeyError, err))
+			}
+		case <-b.stopSaving:
+			return
+		}
+	}
+}
+
+// HandleMessage runs the command in the message given, returning whether it contained one.
+func (b *Bot) HandleMessage(m Message) bool {
+	if m.GuildID == "" || b.closed() || !b.Shard.Owns(m.GuildID) {
+		return false
+	}
+	if b.pickMessage(m) {
+		return true
+	}
+	return b.Router.Handle(b.session, m)
+}
+
+// HandleReaction picks a search result if the reaction is the requester's answer to it, or runs the now playing
+// control reacted with, returning whether it was either.
+func (b *Bot) HandleReaction(r Reaction) bool {
+	if r.GuildID == "" || b.closed() || !b.Shard.Owns(r.GuildID) {
+		return false
+	}
+	return b.pickReaction(r) || b.control(r)
+}
+
+// closed returns whether the bot started shutting down.
+func (b *Bot) closed() bool {
+	return atomic.LoadInt32(&b.closing) == 1
+}
+
+// SetReady sets whether the bot is connected and able to serve users, it is reported by the readiness check.
+func (b *Bot) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&b.ready, v)
+}
+
+// Ready returns whether the bot is ready and not shutting down.
+func (b *Bot) Ready() bool {
+	return atomic.LoadInt32(&b.ready) == 1 && !b.closed()
+}
+
+// Close shuts the bot down, waiting as long as it takes, see Shutdown.
+func (b *Bot) Close() error {
+	return b.Shutdown(context.Background())
+}
+
+// Shutdown shuts the bot down gracefully, giving up waiting for the players to leave once ctx is done.
+//
+// The bot stops handling commands first, then waits for a periodic save in progress and saves the state of the
+// players so they resume after a restart. It cancels the pending searches, stops updating the now playing
+// messages and ends the event streams. Then it stops the players, which closes their tracks, and leaves all of
+// the voice channels after sending some silence. The playlists are closed last, unless they are shared with other
+// shards.
+//
+// If ctx is done before all of the players left, they keep leaving in the background and the error of ctx is
+// returned.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&b.closing, 0, 1) {
+		return ErrClosed
+	}
+	close(b.stopSaving)
+	// A save in progress would overwrite the final state with an older one.
+	b.saving.Wait()
+	err := b.SaveState()
+	b.selMu.Lock()
+	for key, sel := range b.selections {
+		sel.timer.Stop()
+		delete(b.selections, key)
+	}
+	b.selMu.Unlock()
+	b.actMu.Lock()
+	for guildID, a := range b.activities {
+		a.stop()
+		delete(b.activities, guildID)
+	}
+	b.actMu.Unlock()
+	b.npMu.Lock()
+	for guildID, np := range b.npMessages {
+		np.close()
+		delete(b.npMessages, guildID)
+	}
+	b.npMu.Unlock()
+	b.evMu.Lock()
+	for events := range b.listeners {
+		delete(b.listeners, events)
+		close(events)
+	}
+	b.evMu.Unlock()
+	if serr := b.Manager.Shutdown(ctx); err == nil {
+		err = serr
+	}
+	if b.Playlists != nil && b.ownsStores {
+		if perr := b.Playlists.Close(); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// announceChannel returns the channel to report the events of a guild's player in, empty if none.
+func (b *Bot) announceChannel(gp *GuildPlayer) string {
+	if channelID := gp.Settings().AnnounceChannel; channelID != "" {
+		return channelID
+	}
+	return gp.TextChannel()
+}
+
+// announce reports the events of a guild's player in its text channel.
+func (b *Bot) announce(gp *GuildPlayer, e player.Event) {
+	channelID := b.announceChannel(gp)
+	if channelID == "" {
+		return
+	}
+	track, ok := e.EventTrack().(*Track)
+	if !ok {
+		return
+	}
+	switch e := e.(type) {
+	case player.TrackStartEvent:
+		_ = b.showNowPlaying(gp, channelID, track)
+	case player.TrackExceptionEvent:
+		_, _ = b.session.SendMessage(channelID, fmt.Sprintf("Error playing %s: %s", track.Title(), e.Err))
+	}
+}
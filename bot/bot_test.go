@@ -0,0 +1,142 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile, config.PlaylistFile = "", ""
+	config.StateFile = filepath.Join(dir, "state.json")
+	log := &eventLog{}
+	s, voices := newFakeSession(), &fakeVoices{log: log}
+	b, err := New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	server := httptest.NewServer(NewAPI(b, ""))
+	defer server.Close()
+
+	s.voice["u"] = "voice"
+	gp := b.Manager.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"), "error is supposed to be nil")
+	track := newTrack("a", 1000)
+	track.Track = fakeTrack{packets: 1000, log: log}
+	_, err = gp.Enqueue(track)
+	assert.Nil(t, err, "error is supposed to be nil")
+	for voices.get("1").count() < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, b.Shutdown(context.Background()), "error is supposed to be nil")
+	assert.Equal(t, []string{"audio", "close", "silence", "disconnect"}, log.get(),
+		"the track should be closed before the silence is sent and the bot leaves")
+
+	data, err := ioutil.ReadFile(config.StateFile)
+	assert.Nil(t, err, "error is supposed to be nil")
+	var state State
+	assert.Nil(t, json.Unmarshal(data, &state), "error is supposed to be nil")
+	assert.Len(t, state.Guilds, 1, "the state should be saved before the players stop")
+	assert.NotNil(t, state.Guilds[0].Current, "the current track should be saved")
+
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", ChannelID: "text", AuthorID: "u", Content: "!!play b"}),
+		"commands should be ignored once shutting down")
+	assert.Nil(t, b.Manager.Get("1"))
+	assert.Equal(t, http.StatusServiceUnavailable, apiRequest(t, server, "", "GET", "/v1/guilds", "", nil))
+	assert.Equal(t, ErrClosed, b.Close())
+}
+
+func TestShutdown_SaveInProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile, config.PlaylistFile = "", ""
+	config.StateFile = filepath.Join(dir, "state.json")
+	config.StateInterval = 0
+	b, err := New(config, newFakeSession(), (&fakeVoices{}).join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+
+	log := &eventLog{}
+	ticking, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	b.writeState = func(path string, data []byte) error {
+		event := "shutdown"
+		if !b.closed() {
+			event = "tick"
+			once.Do(func() {
+				close(ticking)
+				<-release
+			})
+		}
+		defer log.add(event)
+		return writeFileAtomic(path, data)
+	}
+	b.saving.Add(1)
+	go b.saveEvery(time.Millisecond)
+	<-ticking
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Close()
+	}()
+	select {
+	case err := <-done:
+		done <- err
+		t.Error("the shutdown should wait for the save in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	waitFor(t, "both saves should finish", func() bool {
+		return len(log.get()) == 2
+	})
+	assert.Nil(t, <-done, "error is supposed to be nil")
+	assert.Equal(t, []string{"tick", "shutdown"}, log.get(), "the state should be saved on shutdown after the tick")
+}
+
+func TestShutdown_Deadline(t *testing.T) {
+	b, _, voices := newTestBot()
+	voices.slow = time.Second
+	gp := b.Manager.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"), "error is supposed to be nil")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, b.Shutdown(ctx))
+	assert.True(t, time.Since(start) < voices.slow, "the shutdown should not wait past the deadline")
+}
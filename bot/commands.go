@@ -0,0 +1,758 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// commands returns the commands of the bot.
+func (b *Bot) commands() []*Command {
+	return []*Command{
+		{
+			Name:        "play",
+			Aliases:     []string{"p"},
+			Description: "Plays a track or adds it to the queue, text plays the first search result",
+			Args:        []Arg{{Name: "url|query", Type: ArgRest}},
+			Requires:    RequireVoice,
+			Run:         b.play,
+		},
+		{
+			Name:        "search",
+			Description: "Searches for tracks and lets you pick one to play",
+			Args:        []Arg{{Name: "query", Type: ArgRest}},
+			Requires:    RequireVoice,
+			Run:         b.search,
+		},
+		{
+			Name:        "stop",
+			Description: "Stops playing and clears the queue",
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				ctx.Player.Stop()
+				return ctx.Reply("Stopped")
+			},
+		},
+		{
+			Name:        "seek",
+			Description: "Seeks the current track to a timestamp like 1:30, or from the current position like +30 or -1:00",
+			Args:        []Arg{{Name: "position", Type: ArgString}},
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run:         b.seek,
+		},
+		{
+			Name:        "forward",
+			Aliases:     []string{"ff"},
+			Description: "Seeks the current track forward, 10 seconds unless an amount is given",
+			Args:        []Arg{{Name: "amount", Type: ArgDuration, Optional: true}},
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run: func(ctx *Context) error {
+				step := DefaultSeekStep
+				if ctx.Has(0) {
+					step = ctx.Duration(0)
+				}
+				return b.seekBy(ctx, step)
+			},
+		},
+		{
+			Name:        "rewind",
+			Aliases:     []string{"rw"},
+			Description: "Seeks the current track backward, 10 seconds unless an amount is given",
+			Args:        []Arg{{Name: "amount", Type: ArgDuration, Optional: true}},
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run: func(ctx *Context) error {
+				step := DefaultSeekStep
+				if ctx.Has(0) {
+					step = ctx.Duration(0)
+				}
+				return b.seekBy(ctx, -step)
+			},
+		},
+		{
+			Name:        "replay",
+			Description: "Plays the current track from the start",
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run: func(ctx *Context) error {
+				return b.seekTo(ctx, 0)
+			},
+		},
+		{
+			Name:        "pause",
+			Description: "Pauses the playback",
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run: func(ctx *Context) error {
+				ctx.Player.Player().Pause(true)
+				b.checkActivity(ctx.GuildID)
+				return ctx.Reply("Paused")
+			},
+		},
+		{
+			Name:        "resume",
+			Aliases:     []string{"unpause"},
+			Description: "Resumes the playback",
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run: func(ctx *Context) error {
+				ctx.Player.Player().Pause(false)
+				b.checkActivity(ctx.GuildID)
+				return ctx.Reply("Resumed")
+			},
+		},
+		{
+			Name:        "position",
+			Description: "Shows the position in the current track",
+			Requires:    RequirePlaying,
+			Run: func(ctx *Context) error {
+				current := ctx.Player.Current()
+				if current == nil {
+					return ErrNothingPlaying
+				}
+				return ctx.Reply("%s/%s", FormatDuration(ctx.Player.Player().Position()), FormatLength(current))
+			},
+		},
+		{
+			Name:        "leave",
+			Aliases:     []string{"disconnect"},
+			Description: "Leaves the voice channel",
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				b.Manager.Remove(ctx.GuildID)
+				return ctx.Reply("Left the voice channel")
+			},
+		},
+		{
+			Name:        "record",
+			Description: "Starts or stops recording the voice channel, each user into their own file",
+			Args:        []Arg{{Name: "start|stop", Type: ArgString}},
+			Requires:    RequireVoice,
+			Run:         b.record,
+		},
+		{
+			Name:        "queue",
+			Aliases:     []string{"q"},
+			Description: "Shows the queue",
+			Args:        []Arg{{Name: "page", Type: ArgInt, Optional: true}},
+			Run:         b.queue,
+		},
+		{
+			Name:        "skip",
+			Aliases:     []string{"next"},
+			Description: "Votes to skip the current track, DJs skip it right away or skip more tracks if an amount is given",
+			Args:        []Arg{{Name: "amount", Type: ArgInt, Optional: true}},
+			Requires:    RequireSameVoice | RequirePlaying,
+			Run:         b.skip,
+		},
+		{
+			Name:        "forceskip",
+			Aliases:     []string{"fs"},
+			Description: "Skips the current track without a vote",
+			Requires:    RequireSameVoice | RequirePlaying | RequireDJ,
+			Run:         b.skip,
+		},
+		{
+			Name:        "previous",
+			Aliases:     []string{"prev", "back"},
+			Description: "Plays the last played track again, the current track plays after it",
+			Requires:    RequireVoice,
+			Run:         b.previous,
+		},
+		{
+			Name:        "history",
+			Description: "Shows the tracks played recently",
+			Args:        []Arg{{Name: "page", Type: ArgInt, Optional: true}},
+			Run: func(ctx *Context) error {
+				page := 1
+				if ctx.Has(0) {
+					page = ctx.Int(0)
+				}
+				text, _ := HistoryPage(b.Manager.History(ctx.GuildID).Entries(), page, time.Now())
+				return ctx.Reply("%s", text)
+			},
+		},
+		{
+			Name:        "requeue",
+			Description: "Adds a track from the history back to the queue",
+			Args:        []Arg{{Name: "index", Type: ArgInt}},
+			Requires:    RequireVoice,
+			Run: func(ctx *Context) error {
+				entry, err := b.Manager.History(ctx.GuildID).Get(ctx.Int(0))
+				if err != nil {
+					return UserError(fmt.Sprintf("There is no track at index %d of the history", ctx.Int(0)))
+				}
+				track := *entry.Track
+				return b.enqueue(ctx, []*Track{&track})
+			},
+		},
+		{
+			Name:        "nowplaying",
+			Aliases:     []string{"np"},
+			Description: "Shows the current track with controls",
+			Requires:    RequirePlaying,
+			Run:         b.nowPlaying,
+		},
+		{
+			Name:        "loop",
+			Description: "Shows or changes the loop mode",
+			Args:        []Arg{{Name: "off|track|queue", Type: ArgString, Optional: true}},
+			Requires:    RequireSameVoice,
+			Run:         b.loop,
+		},
+		{
+			Name:        "autoplay",
+			Description: "Shows or changes whether related tracks play once the queue runs out",
+			Args:        []Arg{{Name: "on|off", Type: ArgString, Optional: true}},
+			Run:         b.setAutoplay,
+		},
+		{
+			Name:        "shuffle",
+			Description: "Shuffles the queue",
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				q := ctx.Player.Queue()
+				if q.Len() < 2 {
+					return UserError("Not enough tracks to shuffle")
+				}
+				q.Shuffle()
+				return ctx.Reply("Shuffled %d tracks", q.Len())
+			},
+		},
+		{
+			Name:        "remove",
+			Description: "Removes a track from the queue",
+			Args:        []Arg{{Name: "position", Type: ArgInt}},
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				track, err := ctx.Player.Queue().Remove(ctx.Int(0))
+				if err != nil {
+					return UserError(fmt.Sprintf("There is no track at position %d", ctx.Int(0)))
+				}
+				return ctx.Reply("Removed %s", track.Title())
+			},
+		},
+		{
+			Name:        "move",
+			Description: "Moves a track to another position in the queue",
+			Args:        []Arg{{Name: "from", Type: ArgInt}, {Name: "to", Type: ArgInt}},
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				q := ctx.Player.Queue()
+				if q.Len() == 0 {
+					return UserError("The queue is empty")
+				}
+				track, err := q.Move(ctx.Int(0), ctx.Int(1))
+				if err != nil {
+					return UserError(fmt.Sprintf("Positions must be between 1 and %d", q.Len()))
+				}
+				return ctx.Reply("Moved %s to position %d", track.Title(), ctx.Int(1))
+			},
+		},
+		{
+			Name:        "clear",
+			Description: "Removes all of the tracks from the queue",
+			Requires:    RequireSameVoice | RequireDJ,
+			Run: func(ctx *Context) error {
+				q := ctx.Player.Queue()
+				n := q.Len()
+				q.Clear()
+				return ctx.Reply("Removed %d tracks from the queue", n)
+			},
+		},
+		{
+			Name:        "playlist",
+			Aliases:     []string{"pl"},
+			Description: "Manages saved playlists: save, load, list, delete, add or remove, put server before the name for the server's playlists",
+			Args:        []Arg{{Name: "action", Type: ArgString}, {Name: "name", Type: ArgRest, Optional: true}},
+			Run:         b.playlist,
+		},
+		{
+			Name:        "settings",
+			Description: "Shows or changes the settings of the server: " + strings.Join(settingNames, ", ") + ", or reset them, volume is informational",
+			Args:        []Arg{{Name: "setting", Type: ArgString, Optional: true}, {Name: "value", Type: ArgRest, Optional: true}},
+			Run:         b.settings,
+		},
+	}
+}
+
+// play loads the url or query given and plays it or adds it to the queue.
+func (b *Bot) play(ctx *Context) error {
+	tracks, err := b.Loader.Load(ctx.String(0))
+	if err != nil {
+		return err
+	}
+	return b.enqueue(ctx, tracks)
+}
+
+// enqueue joins the user's voice channel and plays the tracks or adds them to the queue.
+func (b *Bot) enqueue(ctx *Context, tracks []*Track) error {
+	gp := b.Manager.GetOrCreate(ctx.GuildID)
+	gp.BindTextChannel(ctx.ChannelID)
+	if err := gp.Join(ctx.VoiceChannel); err != nil {
+		return err
+	}
+	// Tracks the policies of the guild reject are skipped, the first reason is reported.
+	var rejected []*Track
+	var reason error
+	for _, track := range tracks {
+		track.Requester = ctx.AuthorID
+		position, err := gp.Enqueue(track)
+		if pe, ok := err.(PolicyError); ok {
+			if len(tracks) == 1 {
+				return UserError(pe)
+			}
+			if reason == nil {
+				reason = pe
+			}
+			rejected = append(rejected, track)
+			continue
+		}
+		if err == ErrQueueFull {
+			return UserError(fmt.Sprintf("The queue is full, it can have up to %d tracks", gp.Settings().MaxQueueLength))
+		} else if err != nil {
+			return err
+		}
+		if position > 0 && len(tracks) == 1 {
+			return ctx.Reply("Queued - %s - %s [#%d]", track.Title(), track.Info.Author, position)
+		}
+	}
+	if len(rejected) > 0 {
+		return ctx.Reply("Queued %d tracks, skipped %d: %s", len(tracks)-len(rejected), len(rejected), reason)
+	}
+	if len(tracks) > 1 {
+		return ctx.Reply("Queued %d tracks", len(tracks))
+	}
+	return nil
+}
+
+// record starts or stops recording the voice channel.
+func (b *Bot) record(ctx *Context) error {
+	switch ctx.String(0) {
+	case "start":
+		gp := b.Manager.GetOrCreate(ctx.GuildID)
+		gp.BindTextChannel(ctx.ChannelID)
+		dir := filepath.Join(b.RecordDir, ctx.GuildID+"-"+time.Now().Format("20060102-150405"))
+		if _, err := gp.StartRecording(ctx.VoiceChannel, dir); err == ErrRecording {
+			return UserError("Already recording")
+		} else if err != nil {
+			return err
+		}
+		return ctx.Reply("Recording, type %srecord stop to finish", ctx.Prefix)
+	case "stop":
+		gp := ctx.Player
+		if gp == nil || !gp.Recording() {
+			return UserError("Not recording")
+		}
+		rec, err := gp.StopRecording()
+		if err != nil {
+			return err
+		}
+		if gp.Current() == nil {
+			b.Manager.Remove(ctx.GuildID)
+		}
+		return ctx.Reply("Saved %d tracks to %s", len(rec.Files()), rec.Dir())
+	}
+	return UserError("Usage: " + ctx.Command.Usage(ctx.Prefix))
+}
+
+// queue shows a page of the queue.
+func (b *Bot) queue(ctx *Context) error {
+	gp := ctx.Player
+	if gp == nil {
+		return ctx.Reply("The queue is empty")
+	}
+	page := 1
+	if ctx.Has(0) {
+		page = ctx.Int(0)
+	}
+	text, _ := QueuePage(gp.Queue().Tracks(), page)
+	if current := gp.Current(); current != nil {
+		text = fmt.Sprintf("Now Playing - %s [%s]\n%s", current.Title(), FormatLength(current), text)
+	}
+	return ctx.Reply("%s", text)
+}
+
+// skip skips the current track, or more if an amount is given.
+//
+// Users who don't have full control vote instead, the track is skipped once enough listeners voted.
+func (b *Bot) skip(ctx *Context) error {
+	n := 1
+	if ctx.Has(0) {
+		n = ctx.Int(0)
+		if n < 1 {
+			return UserError("The amount must be positive")
+		}
+	}
+	if !b.isDJ(ctx) {
+		if n > 1 {
+			return ErrNotDJ
+		}
+		return b.voteSkip(ctx)
+	}
+	skipped, err := ctx.Player.Skip(n)
+	if err != nil {
+		return ErrNothingPlaying
+	}
+	if len(skipped) == 1 {
+		return ctx.Reply("Skipped %s", skipped[0].Title())
+	}
+	return ctx.Reply("Skipped %d tracks", len(skipped))
+}
+
+// voteSkip votes to skip the current track and skips it once enough of the listeners voted.
+func (b *Bot) voteSkip(ctx *Context) error {
+	track, voters, err := ctx.Player.VoteSkip(ctx.AuthorID)
+	if err != nil {
+		return ErrNothingPlaying
+	}
+	listeners := ctx.Session.VoiceListeners(ctx.GuildID, ctx.VoiceChannel)
+	votes := 0
+	for _, listener := range listeners {
+		for _, voter := range voters {
+			if listener == voter {
+				votes++
+				break
+			}
+		}
+	}
+	share := b.Settings.Get(ctx.GuildID).SkipVotes
+	required := (len(listeners)*share + 99) / 100
+	if required < 1 {
+		required = 1
+	}
+	if votes < required {
+		return ctx.Reply("Voted to skip %s [%d/%d]", track.Title(), votes, required)
+	}
+	if _, err := ctx.Player.SkipTrack(track); err != nil {
+		return ErrNothingPlaying
+	}
+	return ctx.Reply("Vote passed, skipped %s", track.Title())
+}
+
+// isDJ returns whether the user has full control of the player.
+//
+// DJs, admins and the requester of the current track do, as well as users alone with the bot.
+func (b *Bot) isDJ(ctx *Context) bool {
+	if b.hasDJRole(ctx) {
+		return true
+	}
+	if gp := b.Manager.Get(ctx.GuildID); gp != nil {
+		if current := gp.Current(); current != nil && current.Requester == ctx.AuthorID {
+			return true
+		}
+		if channel := gp.VoiceChannel(); channel != "" {
+			listeners := ctx.Session.VoiceListeners(ctx.GuildID, channel)
+			if len(listeners) == 1 && listeners[0] == ctx.AuthorID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDJRole returns whether the user manages the server or has the DJ role, which gives control over
+// the guild and not only the current player.
+func (b *Bot) hasDJRole(ctx *Context) bool {
+	if perms, err := ctx.Session.UserPermissions(ctx.AuthorID, ctx.ChannelID); err == nil &&
+		perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0 {
+		return true
+	}
+	if role := b.Settings.Get(ctx.GuildID).DJRole; role != "" {
+		roles, _ := ctx.Session.MemberRoles(ctx.GuildID, ctx.AuthorID)
+		for _, r := range roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// previous plays the last played track, replacing the current track requires being a DJ.
+func (b *Bot) previous(ctx *Context) error {
+	if ctx.Player != nil && ctx.Player.Current() != nil && !b.isDJ(ctx) {
+		return ErrNotDJ
+	}
+	gp := b.Manager.GetOrCreate(ctx.GuildID)
+	gp.BindTextChannel(ctx.ChannelID)
+	if err := gp.Join(ctx.VoiceChannel); err != nil {
+		return err
+	}
+	track, err := gp.Previous()
+	if err == ErrNoHistory {
+		return UserError("Nothing was played yet")
+	} else if err != nil {
+		return err
+	}
+	return ctx.Reply("Playing %s again", track.Title())
+}
+
+// nowPlaying shows the current track in a new now playing message.
+func (b *Bot) nowPlaying(ctx *Context) error {
+	gp := ctx.Player
+	current := gp.Current()
+	if current == nil {
+		return ErrNothingPlaying
+	}
+	return b.showNowPlaying(gp, ctx.ChannelID, current)
+}
+
+// loop shows or changes the loop mode.
+func (b *Bot) loop(ctx *Context) error {
+	gp := ctx.Player
+	if !ctx.Has(0) {
+		return ctx.Reply("Loop: %s", gp.Loop())
+	}
+	if !b.isDJ(ctx) {
+		return ErrNotDJ
+	}
+	mode, ok := ParseLoopMode(ctx.String(0))
+	if !ok {
+		return UserError("Usage: " + ctx.Command.Usage(ctx.Prefix))
+	}
+	gp.SetLoop(mode)
+	return ctx.Reply("Loop: %s", mode)
+}
+
+// settingNames are the names of the settings users can change.
+var settingNames = []string{"prefix", "volume", "dj", "announce", "maxqueue", "idle", "empty", "247", "skipvotes",
+	"maxlength", "streams", "userlimit", "duplicates", "blocklist", "fair"}
+
+// mentionRegex matches a role or channel mention, or a plain id.
+var mentionRegex = regexp.MustCompile(`^(?:<@&|<#)?(\d+)>?$`)
+
+// settings shows the settings of the guild, or changes one of them.
+func (b *Bot) settings(ctx *Context) error {
+	settings := b.Settings.Get(ctx.GuildID)
+	if !ctx.Has(0) {
+		blocklist := "none"
+		if len(settings.Blocklist) > 0 {
+			blocklist = strings.Join(settings.Blocklist, ", ")
+		}
+		maxLength := "unlimited"
+		if settings.MaxTrackLength > 0 {
+			maxLength = time.Duration(settings.MaxTrackLength).String()
+		}
+		return ctx.Reply("Settings:\nprefix: %s\nvolume: %d%% (informational)\ndj: %s\nannounce: %s\nmaxqueue: %s\nidle: %s\nempty: %s\n247: %s\nskipvotes: %d%%"+
+			"\nmaxlength: %s\nstreams: %s\nuserlimit: %s\nduplicates: %s\nblocklist: %s\nfair: %s",
+			settings.Prefix, settings.Volume, orNone(settings.DJRole, "<@&%s>"), orNone(settings.AnnounceChannel, "<#%s>"),
+			limit(settings.MaxQueueLength), formatTimeout(settings.IdleTimeout), formatTimeout(settings.EmptyTimeout), onOff(settings.AlwaysOn), settings.SkipVotes,
+			maxLength, onOff(!settings.BlockStreams), limit(settings.MaxUserTracks), onOff(!settings.NoDuplicates), blocklist, onOff(settings.FairQueue))
+	}
+	if err := ctx.RequirePermissions(discordgo.PermissionManageServer); err != nil {
+		return err
+	}
+	name := strings.ToLower(ctx.String(0))
+	if name == "reset" {
+		if err := b.Settings.Reset(ctx.GuildID); err != nil {
+			return err
+		}
+		b.applySettings(ctx.GuildID)
+		return ctx.Reply("The settings were reset")
+	}
+	value := ctx.String(1)
+	if value == "" {
+		return UserError("Usage: " + ctx.Command.Usage(ctx.Prefix))
+	}
+	reply := fmt.Sprintf("Changed %s to %s", name, value)
+	switch name {
+	case "prefix":
+		if len(value) > 5 || strings.ContainsAny(value, " \t\n") {
+			return UserError("The prefix must be up to 5 characters without spaces")
+		}
+		settings.Prefix = value
+	case "volume":
+		volume, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil || volume < 0 || volume > 200 {
+			return UserError("The volume must be between 0 and 200")
+		}
+		settings.Volume = volume
+		// Opus packets are sent as they are, there is no encoder to apply the gain with.
+		reply += " (informational only, the audio is not re-encoded)"
+	case "dj":
+		id, err := parseMention(value, "role")
+		if err != nil {
+			return err
+		}
+		settings.DJRole = id
+	case "announce":
+		id, err := parseMention(value, "channel")
+		if err != nil {
+			return err
+		}
+		settings.AnnounceChannel = id
+	case "maxqueue":
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 0 {
+			return UserError("The maximum queue length must be a number, 0 for unlimited")
+		}
+		settings.MaxQueueLength = max
+	case "idle", "empty":
+		timeout, err := ParseDuration(value)
+		if err != nil {
+			return UserError("The timeout must be a duration like 5m, 0s to never leave")
+		}
+		if name == "idle" {
+			settings.IdleTimeout = Duration(timeout)
+		} else {
+			settings.EmptyTimeout = Duration(timeout)
+		}
+	case "247", "streams", "duplicates", "fair":
+		var on bool
+		switch strings.ToLower(value) {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			return UserError(map[string]string{"247": "24/7 mode", "streams": "Streams", "duplicates": "Duplicates", "fair": "The fair queue"}[name] + " can be on or off")
+		}
+		switch name {
+		case "247":
+			settings.AlwaysOn = on
+		case "streams":
+			settings.BlockStreams = !on
+		case "duplicates":
+			settings.NoDuplicates = !on
+		case "fair":
+			settings.FairQueue = on
+		}
+	case "skipvotes":
+		share, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil || share < 1 || share > 100 {
+			return UserError("The share of votes must be between 1 and 100")
+		}
+		settings.SkipVotes = share
+	case "maxlength":
+		max, err := ParseDuration(value)
+		if err != nil {
+			return UserError("The maximum length must be a duration like 10m, 0s for unlimited")
+		}
+		settings.MaxTrackLength = Duration(max)
+	case "userlimit":
+		max, err := strconv.Atoi(value)
+		if err != nil || max < 0 {
+			return UserError("The maximum tracks per user must be a number, 0 for unlimited")
+		}
+		settings.MaxUserTracks = max
+	case "blocklist":
+		var err error
+		if settings.Blocklist, reply, err = changeBlocklist(settings.Blocklist, value); err != nil {
+			return err
+		}
+	default:
+		return UserError("Unknown setting " + name + ", the settings are " + strings.Join(settingNames, ", "))
+	}
+	if err := b.Settings.Set(ctx.GuildID, settings); err != nil {
+		return err
+	}
+	b.applySettings(ctx.GuildID)
+	b.checkActivity(ctx.GuildID)
+	return ctx.Reply("%s", reply)
+}
+
+// changeBlocklist adds a term to the blocklist, removes one from it or clears it as the value says.
+//
+// It returns the new blocklist and the reply to the user.
+func changeBlocklist(blocklist []string, value string) ([]string, string, error) {
+	parts := strings.SplitN(value, " ", 2)
+	action, term := strings.ToLower(parts[0]), ""
+	if len(parts) == 2 {
+		term = strings.TrimSpace(parts[1])
+	}
+	switch {
+	case action == "clear":
+		return nil, "Cleared the blocklist", nil
+	case action == "add" && term != "":
+		for _, t := range blocklist {
+			if strings.EqualFold(t, term) {
+				return nil, "", UserError(term + " is already blocked")
+			}
+		}
+		return append(append([]string(nil), blocklist...), term), "Blocked " + term, nil
+	case action == "remove" && term != "":
+		for i, t := range blocklist {
+			if strings.EqualFold(t, term) {
+				return append(blocklist[:i:i], blocklist[i+1:]...), "Unblocked " + term, nil
+			}
+		}
+		return nil, "", UserError(term + " is not blocked")
+	}
+	return nil, "", UserError("Usage: blocklist add <term>, blocklist remove <term> or blocklist clear")
+}
+
+// applySettings applies the saved settings of a guild to its player.
+func (b *Bot) applySettings(guildID string) {
+	if gp := b.Manager.Get(guildID); gp != nil {
+		gp.SetSettings(b.Settings.Get(guildID))
+	}
+}
+
+// parseMention returns the id in a role or channel mention, empty if the value is none.
+func parseMention(value, kind string) (string, error) {
+	if value == "none" {
+		return "", nil
+	}
+	matches := mentionRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return "", UserError("Mention the " + kind + " or type none")
+	}
+	return matches[1], nil
+}
+
+// orNone formats the id given, or returns none if it is empty.
+func orNone(id, format string) string {
+	if id == "" {
+		return "none"
+	}
+	return fmt.Sprintf(format, id)
+}
+
+// formatTimeout formats a timeout where 0 means never.
+func formatTimeout(d Duration) string {
+	if d == 0 {
+		return "never"
+	}
+	return time.Duration(d).String()
+}
+
+// onOff formats a boolean setting.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// limit formats a limit where 0 means unlimited.
+func limit(n int) string {
+	if n == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,274 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+// commandCase is a command sent by a user in the voice channel after playing the tracks given.
+type commandCase struct {
+	name string
+	// The first track plays, the rest are queued.
+	tracks []string
+	input  string
+	reply  string
+	// check verifies the player after the command, it is nil if nothing was played.
+	check func(t *testing.T, gp *GuildPlayer)
+}
+
+// runCommandCases runs each case with a new bot.
+func runCommandCases(t *testing.T, cases []commandCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, s, _ := newTestBot()
+			defer b.Close()
+			s.voice["u"] = "voice"
+			for _, track := range c.tracks {
+				send(b, s, "u", "!!play "+track)
+			}
+			assert.Equal(t, c.reply, send(b, s, "u", c.input))
+			if c.check != nil {
+				c.check(t, b.Manager.Get("1"))
+			}
+		})
+	}
+}
+
+// queued returns a check of the titles of the current track and of the queue.
+func queued(current string, queue ...string) func(*testing.T, *GuildPlayer) {
+	return func(t *testing.T, gp *GuildPlayer) {
+		assert.Equal(t, current, gp.Current().Title())
+		assert.Equal(t, queue, titles(gp.Queue().Tracks()))
+	}
+}
+
+func TestCommands(t *testing.T) {
+	b, s, voices := newTestBot()
+	defer b.Close()
+	s.voice["u"] = "voice"
+
+	assert.Equal(t, "No matches found", send(b, s, "u", "!!play https://example.com/missing"))
+	send(b, s, "u", "!!play https://example.com/a")
+	assert.Equal(t, "voice", voices.get("1").ChannelID())
+	assert.Equal(t, "Queued - https://example.com/b -  [#1]", send(b, s, "u", "!!p https://example.com/b"))
+	send(b, s, "u", "!!play https://example.com/c")
+	assert.Contains(t, send(b, s, "u", "!!queue"), "Queue - 2 tracks")
+
+	s.voice["other"] = "elsewhere"
+	assert.Equal(t, ErrOtherVoice.Error(), send(b, s, "other", "!!play https://example.com/d"))
+	assert.Equal(t, ErrNotSameVoice.Error(), send(b, s, "other", "!!skip"))
+
+	assert.Equal(t, "Moved https://example.com/c to position 1", send(b, s, "u", "!!move 2 1"))
+	assert.Equal(t, "Positions must be between 1 and 2", send(b, s, "u", "!!move 3 1"))
+	assert.Equal(t, "Skipped https://example.com/a", send(b, s, "u", "!!skip"))
+	assert.Equal(t, "https://example.com/c", b.Manager.Get("1").Current().Title())
+	assert.Equal(t, "Loop: queue", send(b, s, "u", "!!loop queue"))
+	assert.Equal(t, "Usage: !!loop [off|track|queue]", send(b, s, "u", "!!loop forever"))
+	assert.Equal(t, "Removed https://example.com/b", send(b, s, "u", "!!remove 1"))
+	assert.Equal(t, "Removed 0 tracks from the queue", send(b, s, "u", "!!clear"))
+	assert.Equal(t, "Left the voice channel", send(b, s, "u", "!!leave"))
+	assert.True(t, voices.get("1").disconnected)
+	assert.Nil(t, b.Manager.Get("1"))
+}
+
+func TestDJ(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	for _, user := range []string{"u", "a", "b", "c", "dj"} {
+		s.voice[user] = "voice"
+	}
+	s.roles["dj"] = []string{"123"}
+
+	send(b, s, "u", "!!play one")
+	send(b, s, "a", "!!play two")
+	send(b, s, "a", "!!play three")
+	assert.Equal(t, ErrNotDJ.Error(), send(b, s, "a", "!!stop"))
+	assert.Equal(t, ErrNotDJ.Error(), send(b, s, "a", "!!skip 2"))
+	assert.Equal(t, ErrNotDJ.Error(), send(b, s, "dj", "!!fs"), "the role is not the DJ role yet")
+	assert.Equal(t, "Loop: off", send(b, s, "a", "!!loop"), "everyone can see the loop mode")
+	assert.Equal(t, ErrNotDJ.Error(), send(b, s, "a", "!!loop track"))
+
+	// 5 listeners at 50% need 3 votes.
+	assert.Equal(t, "Voted to skip one [1/3]", send(b, s, "a", "!!skip"))
+	assert.Equal(t, "Voted to skip one [1/3]", send(b, s, "a", "!!skip"), "voting twice should count once")
+	s.voice["b"] = "elsewhere"
+	assert.Equal(t, ErrNotSameVoice.Error(), send(b, s, "b", "!!skip"))
+	s.voice["b"] = "voice"
+	assert.Equal(t, "Voted to skip one [2/3]", send(b, s, "b", "!!skip"))
+	assert.Equal(t, "Vote passed, skipped one", send(b, s, "c", "!!skip"))
+	assert.Equal(t, "two", b.Manager.Get("1").Current().Title())
+	assert.Equal(t, "Voted to skip two [1/3]", send(b, s, "c", "!!skip"), "the votes should reset on track change")
+
+	assert.Equal(t, "Skipped two", send(b, s, "a", "!!skip"), "the requester can skip right away")
+	s.permissions["u"] = discordgo.PermissionManageServer
+	assert.Equal(t, "Changed dj to 123", send(b, s, "u", "!!settings dj 123"))
+	assert.Equal(t, "Changed skipvotes to 100", send(b, s, "u", "!!settings skipvotes 100"))
+	assert.Equal(t, "Paused", send(b, s, "dj", "!!pause"))
+	assert.Equal(t, "Voted to skip three [1/5]", send(b, s, "c", "!!skip"))
+	assert.Equal(t, "Stopped", send(b, s, "u", "!!stop"), "admins have full control")
+}
+
+func TestCommands_Queue(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!queue", reply: "The queue is empty"},
+		{name: "empty queue", tracks: []string{"a"}, input: "!!queue", reply: "Now Playing - a [0:20]\nThe queue is empty"},
+		{name: "tracks", tracks: []string{"a", "b", "c"}, input: "!!q",
+			reply: "Now Playing - a [0:20]\nQueue - 2 tracks [0:40] - page 1/1\n1. b [0:20] - <@u>\n2. c [0:20] - <@u>\n"},
+		{name: "page past the end", tracks: []string{"a", "b"}, input: "!!queue 3",
+			reply: "Now Playing - a [0:20]\nQueue - 1 tracks [0:20] - page 1/1\n1. b [0:20] - <@u>\n"},
+	})
+}
+
+func TestCommands_Skip(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!skip", reply: ErrNotSameVoice.Error()},
+		{name: "last track", tracks: []string{"a"}, input: "!!skip", reply: "Skipped a", check: func(t *testing.T, gp *GuildPlayer) {
+			assert.Nil(t, gp.Current(), "nothing should be left to play")
+		}},
+		{name: "next", tracks: []string{"a", "b", "c"}, input: "!!next", reply: "Skipped a", check: queued("b", "c")},
+		{name: "amount", tracks: []string{"a", "b", "c"}, input: "!!skip 2", reply: "Skipped 2 tracks", check: queued("c")},
+		{name: "amount past the end", tracks: []string{"a", "b"}, input: "!!skip 5", reply: "Skipped 2 tracks"},
+		{name: "zero", tracks: []string{"a", "b"}, input: "!!skip 0", reply: "The amount must be positive", check: queued("a", "b")},
+	})
+}
+
+func TestCommands_NowPlaying(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!nowplaying", reply: ErrNothingPlaying.Error()},
+	})
+
+	b, s, _ := newTestBot()
+	defer b.Close()
+	s.voice["u"] = "voice"
+	send(b, s, "u", "!!play a")
+	assert.Equal(t, "", send(b, s, "u", "!!np"), "the track is shown in an embed")
+	waitFor(t, "the now playing message should be sent", func() bool { return s.embed(1) != nil })
+	assert.Equal(t, "a", s.embed(1).Title)
+}
+
+func TestCommands_Loop(t *testing.T) {
+	mode := func(mode LoopMode) func(*testing.T, *GuildPlayer) {
+		return func(t *testing.T, gp *GuildPlayer) {
+			assert.Equal(t, mode, gp.Loop())
+		}
+	}
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!loop", reply: ErrNotSameVoice.Error()},
+		{name: "show", tracks: []string{"a"}, input: "!!loop", reply: "Loop: off", check: mode(LoopOff)},
+		{name: "track", tracks: []string{"a"}, input: "!!loop track", reply: "Loop: track", check: mode(LoopTrack)},
+		{name: "queue", tracks: []string{"a"}, input: "!!loop queue", reply: "Loop: queue", check: mode(LoopQueue)},
+		{name: "off", tracks: []string{"a"}, input: "!!loop off", reply: "Loop: off", check: mode(LoopOff)},
+		{name: "unknown", tracks: []string{"a"}, input: "!!loop forever", reply: "Usage: !!loop [off|track|queue]", check: mode(LoopOff)},
+	})
+}
+
+func TestCommands_LoopAdvance(t *testing.T) {
+	for _, c := range []struct {
+		mode    string
+		current string
+		queue   []string
+	}{
+		{mode: "off", current: "b", queue: nil},
+		{mode: "track", current: "a", queue: []string{"b"}},
+		{mode: "queue", current: "b", queue: []string{"a"}},
+	} {
+		t.Run(c.mode, func(t *testing.T) {
+			session, voices := newFakeSession(), &fakeVoices{}
+			config := DefaultConfig()
+			config.SettingsFile, config.StateFile, config.PlaylistFile = "", "", ""
+			b, _ := New(config, session, voices.join, fakeLoader{packets: 5})
+			defer b.Close()
+			session.voice["u"] = "voice"
+			send(b, session, "u", "!!play a")
+			send(b, session, "u", "!!play b")
+			send(b, session, "u", "!!loop "+c.mode)
+			gp := b.Manager.Get("1")
+			waitFor(t, "the first track should end", func() bool { return voices.get("1").count() >= 5 })
+			waitFor(t, "the player should advance", func() bool {
+				current := gp.Current()
+				return current != nil && current.Title() == c.current && len(gp.Queue().Tracks()) == len(c.queue)
+			})
+			assert.Equal(t, c.queue, titles(gp.Queue().Tracks()))
+			if c.mode == "track" {
+				time.Sleep(150 * time.Millisecond)
+				assert.Equal(t, "a", gp.Current().Title(), "the track should keep repeating")
+			}
+		})
+	}
+}
+
+func TestCommands_Shuffle(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!shuffle", reply: ErrNotSameVoice.Error()},
+		{name: "empty queue", tracks: []string{"a"}, input: "!!shuffle", reply: "Not enough tracks to shuffle"},
+		{name: "single track", tracks: []string{"a", "b"}, input: "!!shuffle", reply: "Not enough tracks to shuffle", check: queued("a", "b")},
+		{name: "tracks", tracks: []string{"a", "b", "c", "d"}, input: "!!shuffle", reply: "Shuffled 3 tracks", check: func(t *testing.T, gp *GuildPlayer) {
+			assert.Equal(t, "a", gp.Current().Title(), "the current track should keep playing")
+			shuffled := titles(gp.Queue().Tracks())
+			sort.Strings(shuffled)
+			assert.Equal(t, []string{"b", "c", "d"}, shuffled, "the tracks should only be reordered")
+		}},
+	})
+}
+
+func TestCommands_Remove(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!remove 1", reply: ErrNotSameVoice.Error()},
+		{name: "empty queue", tracks: []string{"a"}, input: "!!remove 1", reply: "There is no track at position 1"},
+		{name: "first", tracks: []string{"a", "b", "c"}, input: "!!remove 1", reply: "Removed b", check: queued("a", "c")},
+		{name: "last", tracks: []string{"a", "b", "c"}, input: "!!remove 2", reply: "Removed c", check: queued("a", "b")},
+		{name: "zero", tracks: []string{"a", "b"}, input: "!!remove 0", reply: "There is no track at position 0", check: queued("a", "b")},
+		{name: "negative", tracks: []string{"a", "b"}, input: "!!remove -1", reply: "There is no track at position -1", check: queued("a", "b")},
+		{name: "past the end", tracks: []string{"a", "b"}, input: "!!remove 2", reply: "There is no track at position 2", check: queued("a", "b")},
+		{name: "not a number", tracks: []string{"a", "b"}, input: "!!remove b", reply: "position must be a number\nUsage: !!remove <position>", check: queued("a", "b")},
+	})
+}
+
+func TestCommands_Move(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!move 1 2", reply: ErrNotSameVoice.Error()},
+		{name: "empty queue", tracks: []string{"a"}, input: "!!move 1 1", reply: "The queue is empty"},
+		{name: "to the front", tracks: []string{"a", "b", "c", "d"}, input: "!!move 3 1", reply: "Moved d to position 1", check: queued("a", "d", "b", "c")},
+		{name: "to the end", tracks: []string{"a", "b", "c", "d"}, input: "!!move 1 3", reply: "Moved b to position 3", check: queued("a", "c", "d", "b")},
+		{name: "in place", tracks: []string{"a", "b", "c"}, input: "!!move 2 2", reply: "Moved c to position 2", check: queued("a", "b", "c")},
+		{name: "from zero", tracks: []string{"a", "b", "c"}, input: "!!move 0 1", reply: "Positions must be between 1 and 2", check: queued("a", "b", "c")},
+		{name: "to zero", tracks: []string{"a", "b", "c"}, input: "!!move 2 0", reply: "Positions must be between 1 and 2", check: queued("a", "b", "c")},
+		{name: "from past the end", tracks: []string{"a", "b", "c"}, input: "!!move 3 1", reply: "Positions must be between 1 and 2", check: queued("a", "b", "c")},
+		{name: "to past the end", tracks: []string{"a", "b", "c"}, input: "!!move 1 3", reply: "Positions must be between 1 and 2", check: queued("a", "b", "c")},
+	})
+}
+
+func TestCommands_Clear(t *testing.T) {
+	runCommandCases(t, []commandCase{
+		{name: "nothing playing", input: "!!clear", reply: ErrNotSameVoice.Error()},
+		{name: "empty queue", tracks: []string{"a"}, input: "!!clear", reply: "Removed 0 tracks from the queue", check: queued("a")},
+		{name: "tracks", tracks: []string{"a", "b", "c"}, input: "!!clear", reply: "Removed 2 tracks from the queue", check: queued("a")},
+	})
+}
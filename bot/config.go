@@ -0,0 +1,315 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/core"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSharedPlaylists is returned when processes running some of the shards are configured with playlists.
+//
+// The playlist database can be opened by a single process, while the playlists of a user must be the same in every
+// guild, whichever process runs it.
+var ErrSharedPlaylists = errors.New("playlists can't be shared between processes running different shards, run " +
+	"all of the shards in one process or disable playlists with an empty playlistFile")
+
+// Duration is a time.Duration written in JSON as a string like "1m30s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// HTTPConfig configures the HTTP client used to fetch tracks.
+type HTTPConfig struct {
+	// Timeout is the timeout of a request.
+	Timeout Duration `json:"timeout"`
+	// Proxy is the url of the proxy to send requests through, empty to connect directly.
+	Proxy string `json:"proxy,omitempty"`
+	// MaxIdleConns is the maximum number of idle connections kept open.
+	MaxIdleConns int `json:"maxIdleConns"`
+}
+
+// Client creates an HTTP client with the configuration.
+func (c HTTPConfig) Client() (*http.Client, error) {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, MaxIdleConns: c.MaxIdleConns}
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Timeout: time.Duration(c.Timeout), Transport: transport}, nil
+}
+
+// APIConfig configures the REST API controlling the players, see API.
+type APIConfig struct {
+	// Address is the address to serve the API on, like :8080, empty to not serve it.
+	Address string `json:"address,omitempty"`
+	// Token is the token clients must send in the Authorization header.
+	Token string `json:"token,omitempty"`
+}
+
+// MetricsConfig configures the endpoint serving the metrics and the health checks, see NewMetricsHandler.
+type MetricsConfig struct {
+	// Address is the address to serve the metrics on, like :9090, empty to not serve them.
+	Address string `json:"address,omitempty"`
+}
+
+// ShardConfig configures the gateway shards the process runs, see Supervisor.
+type ShardConfig struct {
+	// Count is the number of shards of the bot across all processes, 0 for the number Discord recommends.
+	Count int `json:"count"`
+	// IDs are the ids of the shards this process runs, empty to run all of them.
+	//
+	// Processes running some of the shards keep their own settings and can't have playlists, see Config.ForProcess.
+	IDs []int `json:"ids,omitempty"`
+}
+
+// Shards returns the shards to run out of the number of shards given.
+func (c ShardConfig) Shards(count int) ([]Shard, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid shard count %d", count)
+	}
+	if len(c.IDs) == 0 {
+		shards := make([]Shard, count)
+		for id := range shards {
+			shards[id] = Shard{ID: id, Count: count}
+		}
+		return shards, nil
+	}
+	shards := make([]Shard, 0, len(c.IDs))
+	seen := make(map[int]bool)
+	for _, id := range c.IDs {
+		if id < 0 || id >= count {
+			return nil, fmt.Errorf("shard %d is out of the %d shards", id, count)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("shard %d is listed twice", id)
+		}
+		seen[id] = true
+		shards = append(shards, Shard{ID: id, Count: count})
+	}
+	return shards, nil
+}
+
+// Limits limit what users can do.
+type Limits struct {
+	// MaxQueueLength is the default maximum number of tracks in a queue, 0 for unlimited.
+	MaxQueueLength int `json:"maxQueueLength"`
+	// IdleTimeout is the default time to stay in a voice channel without playing.
+	IdleTimeout Duration `json:"idleTimeout"`
+	// EmptyTimeout is the default time to stay in a voice channel nobody listens in.
+	EmptyTimeout Duration `json:"emptyTimeout"`
+	// SkipVotes is the default share of the listeners in percents who must vote to skip a track.
+	SkipVotes int `json:"skipVotes"`
+	// MaxTrackLength is the default maximum length of the tracks users queue, 0 for unlimited.
+	MaxTrackLength Duration `json:"maxTrackLength"`
+	// MaxUserTracks is the default maximum number of tracks each user may have in the queue, 0 for unlimited.
+	MaxUserTracks int `json:"maxUserTracks"`
+	// SearchResults is the number of results a search shows, up to 9.
+	SearchResults int `json:"searchResults"`
+	// SearchTimeout is how long users have to pick a search result.
+	SearchTimeout Duration `json:"searchTimeout"`
+	// HistoryLength is the number of played tracks kept for each guild.
+	HistoryLength int `json:"historyLength"`
+}
+
+// Config configures the bot.
+type Config struct {
+	// Token is the token of the bot.
+	Token string `json:"token"`
+	// Prefix is the prefix of the commands in guilds that didn't change it.
+	Prefix string `json:"prefix"`
+	// SettingsFile is the file the settings of the guilds are saved in.
+	SettingsFile string `json:"settingsFile"`
+	// StateFile is the file the players are saved in to resume them after a restart, empty to not save them.
+	StateFile string `json:"stateFile"`
+	// StateInterval is the interval to save the players in, they are saved on shutdown as well.
+	StateInterval Duration `json:"stateInterval"`
+	// PlaylistFile is the database the playlists are saved in, empty to disable playlists.
+	PlaylistFile string `json:"playlistFile"`
+	// RecordDir is the directory recordings are saved in.
+	RecordDir string `json:"recordDir"`
+	// NowPlayingInterval is the interval to update the now playing message in, zero to not update it.
+	NowPlayingInterval Duration `json:"nowPlayingInterval"`
+	// ShutdownTimeout is how long to wait for the players to leave their voice channels when shutting down.
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// LogLevel is the minimum level of the events logged: debug, info, warn or error.
+	LogLevel string        `json:"logLevel"`
+	HTTP     HTTPConfig    `json:"http"`
+	API      APIConfig     `json:"api"`
+	Metrics  MetricsConfig `json:"metrics"`
+	Shards   ShardConfig   `json:"shards"`
+	// Shard is the shard a bot serves, set by ForShard. The zero value serves all guilds.
+	Shard  Shard  `json:"-"`
+	Limits Limits `json:"limits"`
+}
+
+// DefaultConfig returns the configuration used for anything the config file leaves out.
+func DefaultConfig() Config {
+	return Config{
+		Prefix:             DefaultPrefix,
+		SettingsFile:       "settings.json",
+		StateFile:          "state.json",
+		StateInterval:      Duration(time.Minute),
+		PlaylistFile:       "playlists.db",
+		RecordDir:          "recordings",
+		NowPlayingInterval: Duration(DefaultNowPlayingInterval),
+		ShutdownTimeout:    Duration(10 * time.Second),
+		LogLevel:           core.LevelInfo.String(),
+		Shards:             ShardConfig{Count: 1},
+		HTTP: HTTPConfig{
+			Timeout:      Duration(10 * time.Second),
+			MaxIdleConns: 100,
+		},
+		Limits: Limits{
+			MaxQueueLength: 500,
+			IdleTimeout:    Duration(5 * time.Minute),
+			EmptyTimeout:   Duration(time.Minute),
+			SkipVotes:      50,
+			SearchResults:  DefaultSearchResults,
+			SearchTimeout:  Duration(DefaultSearchTimeout),
+			HistoryLength:  DefaultHistoryLength,
+		},
+	}
+}
+
+// LoadConfig reads the JSON config file at the path given on top of the default configuration.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	f, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return config, err
+	}
+	if _, ok := core.ParseLevel(config.LogLevel); !ok {
+		return config, fmt.Errorf("unknown log level %q", config.LogLevel)
+	}
+	if config.Shards.Count < 0 {
+		return config, fmt.Errorf("invalid shard count %d", config.Shards.Count)
+	}
+	if config.Shards.Count > 0 {
+		if _, err := config.Shards.Shards(config.Shards.Count); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// ForShard returns the configuration of the bot serving the shard given.
+//
+// When the bot is sharded each shard saves its players in its own state file, named after the shard.
+func (c Config) ForShard(shard Shard) Config {
+	c.Shard = shard
+	if shard.Count > 1 {
+		c.StateFile = suffixPath(c.StateFile, strconv.Itoa(shard.ID))
+	}
+	return c
+}
+
+// ForProcess returns the configuration of a process running the shards of the config.
+//
+// The settings file can't be shared between processes, so a process running some of the shards keeps the settings
+// of its guilds in a file named after its shards, like settings.0-1.json. The playlists of the users can't be kept
+// apart like that, so such a process returns ErrSharedPlaylists unless playlists are disabled.
+func (c Config) ForProcess() (Config, error) {
+	if len(c.Shards.IDs) == 0 {
+		return c, nil
+	}
+	if c.PlaylistFile != "" {
+		return c, ErrSharedPlaylists
+	}
+	sorted := append([]int(nil), c.Shards.IDs...)
+	sort.Ints(sorted)
+	ids := make([]string, len(sorted))
+	for i, id := range sorted {
+		ids[i] = strconv.Itoa(id)
+	}
+	suffix := strings.Join(ids, "-")
+	c.SettingsFile = suffixPath(c.SettingsFile, suffix)
+	return c, nil
+}
+
+// suffixPath adds a suffix to the name of the file at the path given before its extension, empty paths stay empty.
+func suffixPath(path, suffix string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(path, ext), suffix, ext)
+}
+
+// Level returns the minimum level of the events logged.
+func (c Config) Level() core.Level {
+	level, _ := core.ParseLevel(c.LogLevel)
+	return level
+}
+
+// GuildSettings returns the settings of guilds that didn't change them.
+func (c Config) GuildSettings() Settings {
+	return Settings{
+		Prefix:         c.Prefix,
+		Volume:         100,
+		MaxQueueLength: c.Limits.MaxQueueLength,
+		IdleTimeout:    c.Limits.IdleTimeout,
+		EmptyTimeout:   c.Limits.EmptyTimeout,
+		SkipVotes:      c.Limits.SkipVotes,
+		MaxTrackLength: c.Limits.MaxTrackLength,
+		MaxUserTracks:  c.Limits.MaxUserTracks,
+	}
+}
@@ -0,0 +1,57 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "config")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.Remove(f.Name())
+	_, _ = f.WriteString(`{"token": "abc", "prefix": "?", "http": {"timeout": "30s"}, "limits": {"searchResults": 3}}`)
+	_ = f.Close()
+
+	config, err := LoadConfig(f.Name())
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "abc", config.Token)
+	assert.Equal(t, "?", config.GuildSettings().Prefix)
+	assert.Equal(t, Duration(30*time.Second), config.HTTP.Timeout)
+	assert.Equal(t, 3, config.Limits.SearchResults)
+	assert.Equal(t, DefaultConfig().Limits.MaxQueueLength, config.Limits.MaxQueueLength, "missing fields should keep their defaults")
+
+	_ = ioutil.WriteFile(f.Name(), []byte(`{"tokn": "abc"}`), 0644)
+	_, err = LoadConfig(f.Name())
+	assert.NotNil(t, err, "unknown fields should be rejected")
+
+	_ = ioutil.WriteFile(f.Name(), []byte(`{"shards": {"count": 2, "ids": [2]}}`), 0644)
+	_, err = LoadConfig(f.Name())
+	assert.NotNil(t, err, "shards out of the count should be rejected")
+}
@@ -0,0 +1,286 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"github.com/dondish/lionplayer/voice"
+	"sync"
+	"time"
+)
+
+// sendTimeout is the time to wait for discordgo to accept a frame before giving up on it.
+const sendTimeout = time.Second
+
+var (
+	errVoiceClosed = errors.New("voice connection closed")
+	errSendTimeout = errors.New("timed out sending a frame")
+)
+
+// discordVoice adapts a discordgo voice connection to VoiceConnection and Receiver.
+type discordVoice struct {
+	vc       *discordgo.VoiceConnection
+	speaking bool
+	recv     chan voice.Packet
+	recvOnce sync.Once
+	closed   chan struct{}
+	once     sync.Once
+	forget   func()
+}
+
+// RecommendedShards returns the number of shards Discord recommends the bot of the token given to run.
+func RecommendedShards(token string) (int, error) {
+	s, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return 0, err
+	}
+	gateway, err := s.GatewayBot()
+	if err != nil {
+		return 0, err
+	}
+	return gateway.Shards, nil
+}
+
+// DiscordVoice returns a VoiceJoiner that joins voice channels using the discordgo session given.
+func DiscordVoice(s *discordgo.Session) VoiceJoiner {
+	var mu sync.Mutex
+	conns := make(map[*discordgo.VoiceConnection]*discordVoice)
+	return func(guildID, channelID string, deaf bool) (VoiceConnection, error) {
+		vc, err := s.ChannelVoiceJoin(guildID, channelID, false, deaf)
+		if err != nil {
+			// A join that timed out leaves the connection open, close it so the next join starts over.
+			if vc != nil {
+				mu.Lock()
+				v, ok := conns[vc]
+				mu.Unlock()
+				if ok {
+					_ = v.Disconnect()
+				} else {
+					_ = vc.Disconnect()
+				}
+			}
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// Moving between channels keeps the same connection, so does its adapter.
+		if v, ok := conns[vc]; ok {
+			return v, nil
+		}
+		v := &discordVoice{vc: vc, closed: make(chan struct{})}
+		v.forget = func() {
+			mu.Lock()
+			delete(conns, vc)
+			mu.Unlock()
+		}
+		conns[vc] = v
+		return v, nil
+	}
+}
+
+// WriteOpus implements player.Sink, discordgo paces the frames.
+func (v *discordVoice) WriteOpus(frame []byte) error {
+	if !v.speaking && v.vc.Speaking(true) == nil {
+		v.speaking = true
+	}
+	select {
+	case v.vc.OpusSend <- frame:
+		return nil
+	case <-v.closed:
+		return errVoiceClosed
+	case <-time.After(sendTimeout):
+		return errSendTimeout
+	}
+}
+
+// ChannelID implements VoiceConnection.
+func (v *discordVoice) ChannelID() string {
+	v.vc.RLock()
+	defer v.vc.RUnlock()
+	return v.vc.ChannelID
+}
+
+// Disconnect implements VoiceConnection.
+func (v *discordVoice) Disconnect() error {
+	var err error
+	v.once.Do(func() {
+		close(v.closed)
+		v.forget()
+		err = v.vc.Disconnect()
+	})
+	return err
+}
+
+// Receive implements Receiver.
+func (v *discordVoice) Receive() <-chan voice.Packet {
+	v.recvOnce.Do(func() {
+		v.recv = make(chan voice.Packet, 64)
+		go func() {
+			defer close(v.recv)
+			for {
+				select {
+				case <-v.closed:
+					return
+				case p := <-v.vc.OpusRecv:
+					if p == nil {
+						continue
+					}
+					select {
+					case v.recv <- voice.Packet{SSRC: p.SSRC, Sequence: p.Sequence, Timestamp: p.Timestamp, Opus: p.Opus}:
+					case <-v.closed:
+						return
+					}
+				}
+			}
+		}()
+	})
+	return v.recv
+}
+
+// OnSpeaking implements Receiver.
+func (v *discordVoice) OnSpeaking(f func(ssrc uint32, userID string)) {
+	v.vc.AddHandler(func(_ *discordgo.VoiceConnection, u *discordgo.VoiceSpeakingUpdate) {
+		f(uint32(u.SSRC), u.UserID)
+	})
+}
+
+// discordSession adapts a discordgo session to Session.
+type discordSession struct {
+	s *discordgo.Session
+}
+
+// NewDiscordSession returns a Session using the discordgo session given.
+func NewDiscordSession(s *discordgo.Session) Session {
+	return discordSession{s: s}
+}
+
+// SendMessage implements Session.
+func (d discordSession) SendMessage(channelID, content string) (string, error) {
+	m, err := d.s.ChannelMessageSend(channelID, content)
+	if err != nil {
+		return "", err
+	}
+	return m.ID, nil
+}
+
+// SendEmbed implements Session.
+func (d discordSession) SendEmbed(channelID string, embed *Embed) (string, error) {
+	m, err := d.s.ChannelMessageSendEmbed(channelID, discordEmbed(embed))
+	if err != nil {
+		return "", err
+	}
+	return m.ID, nil
+}
+
+// EditEmbed implements Session.
+func (d discordSession) EditEmbed(channelID, messageID string, embed *Embed) error {
+	_, err := d.s.ChannelMessageEditEmbed(channelID, messageID, discordEmbed(embed))
+	return err
+}
+
+// AddReaction implements Session.
+func (d discordSession) AddReaction(channelID, messageID, emoji string) error {
+	return d.s.MessageReactionAdd(channelID, messageID, emoji)
+}
+
+// RemoveReaction implements Session.
+func (d discordSession) RemoveReaction(channelID, messageID, emoji, userID string) error {
+	return d.s.MessageReactionRemove(channelID, messageID, emoji, userID)
+}
+
+// UserVoiceChannel implements Session.
+func (d discordSession) UserVoiceChannel(guildID, userID string) string {
+	g, err := d.s.State.Guild(guildID)
+	if err != nil {
+		return ""
+	}
+	for _, vs := range g.VoiceStates {
+		if vs.UserID == userID {
+			return vs.ChannelID
+		}
+	}
+	return ""
+}
+
+// UserPermissions implements Session.
+func (d discordSession) UserPermissions(userID, channelID string) (int, error) {
+	if perms, err := d.s.State.UserChannelPermissions(userID, channelID); err == nil {
+		return perms, nil
+	}
+	return d.s.UserChannelPermissions(userID, channelID)
+}
+
+// MemberRoles implements Session.
+func (d discordSession) MemberRoles(guildID, userID string) ([]string, error) {
+	member, err := d.s.State.Member(guildID, userID)
+	if err != nil {
+		if member, err = d.s.GuildMember(guildID, userID); err != nil {
+			return nil, err
+		}
+	}
+	return member.Roles, nil
+}
+
+// VoiceListeners implements Session.
+func (d discordSession) VoiceListeners(guildID, channelID string) []string {
+	g, err := d.s.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+	var listeners []string
+	for _, vs := range g.VoiceStates {
+		if vs.ChannelID != channelID || vs.UserID == d.s.State.User.ID {
+			continue
+		}
+		if member, err := d.s.State.Member(guildID, vs.UserID); err == nil && member.User != nil && member.User.Bot {
+			continue
+		}
+		listeners = append(listeners, vs.UserID)
+	}
+	return listeners
+}
+
+// discordEmbed converts an Embed into a discordgo embed.
+func discordEmbed(embed *Embed) *discordgo.MessageEmbed {
+	e := &discordgo.MessageEmbed{Title: embed.Title, URL: embed.URL, Description: embed.Description, Color: embed.Color}
+	if embed.Thumbnail != "" {
+		e.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: embed.Thumbnail}
+	}
+	for _, field := range embed.Fields {
+		e.Fields = append(e.Fields, &discordgo.MessageEmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	return e
+}
+
+// DiscordMessage converts a discordgo message into a Message.
+func DiscordMessage(m *discordgo.Message) Message {
+	return Message{GuildID: m.GuildID, ChannelID: m.ChannelID, AuthorID: m.Author.ID, Content: m.Content}
+}
+
+// DiscordReaction converts a discordgo reaction into a Reaction.
+func DiscordReaction(r *discordgo.MessageReaction) Reaction {
+	return Reaction{GuildID: r.GuildID, ChannelID: r.ChannelID, MessageID: r.MessageID, UserID: r.UserID, Emoji: r.Emoji.Name}
+}
@@ -0,0 +1,467 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/dondish/lionplayer/player"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSession records the replies sent and answers with fixed voice states and permissions.
+//
+// The now playing messages are sent asynchronously as embeds, so they are kept apart from the replies.
+type fakeSession struct {
+	mu          sync.Mutex
+	messages    []string
+	embeds      []*Embed
+	edits       int
+	reactions   map[string][]string
+	removed     []string
+	roles       map[string][]string
+	voice       map[string]string
+	permissions map[string]int
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{reactions: make(map[string][]string), roles: make(map[string][]string), voice: make(map[string]string), permissions: make(map[string]int)}
+}
+
+func (s *fakeSession) SendMessage(channelID, content string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, content)
+	return strconv.Itoa(len(s.messages)), nil
+}
+
+func (s *fakeSession) SendEmbed(channelID string, embed *Embed) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embeds = append(s.embeds, embed)
+	return "embed" + strconv.Itoa(len(s.embeds)), nil
+}
+
+func (s *fakeSession) EditEmbed(channelID, messageID string, embed *Embed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, err := strconv.Atoi(strings.TrimPrefix(messageID, "embed"))
+	if err != nil || i < 1 || i > len(s.embeds) {
+		return errors.New("unknown message")
+	}
+	s.embeds[i-1] = embed
+	s.edits++
+	return nil
+}
+
+func (s *fakeSession) RemoveReaction(channelID, messageID, emoji, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = append(s.removed, userID+":"+emoji)
+	return nil
+}
+
+// embed returns the now playing message given by its position, nil if it wasn't sent yet.
+func (s *fakeSession) embed(i int) *Embed {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i > len(s.embeds) {
+		return nil
+	}
+	return s.embeds[i-1]
+}
+
+func (s *fakeSession) AddReaction(channelID, messageID, emoji string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reactions[messageID] = append(s.reactions[messageID], emoji)
+	return nil
+}
+
+func (s *fakeSession) UserVoiceChannel(guildID, userID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.voice[userID]
+}
+
+func (s *fakeSession) UserPermissions(userID, channelID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.permissions[userID], nil
+}
+
+func (s *fakeSession) MemberRoles(guildID, userID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roles[userID], nil
+}
+
+func (s *fakeSession) VoiceListeners(guildID, channelID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var listeners []string
+	for user, channel := range s.voice {
+		if channel == channelID {
+			listeners = append(listeners, user)
+		}
+	}
+	return listeners
+}
+
+// last returns the last message sent.
+func (s *fakeSession) last() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		return ""
+	}
+	return s.messages[len(s.messages)-1]
+}
+
+// fakeLoader loads any query into a track of silence named after it.
+type fakeLoader struct {
+	packets int
+}
+
+func (l fakeLoader) Load(query string) ([]*Track, error) {
+	if strings.Contains(query, "missing") {
+		return nil, ErrNoMatches
+	}
+	return []*Track{newTrack(query, l.packets)}, nil
+}
+
+func (l fakeLoader) Resolve(info lavalink.TrackInfo) (*Track, error) {
+	if strings.Contains(info.Title, "missing") {
+		return nil, ErrNoMatches
+	}
+	return newTrack(info.Title, l.packets), nil
+}
+
+func (l fakeLoader) Related(track *Track, limit int) ([]*Track, error) {
+	var tracks []*Track
+	for i := 1; i <= 3 && i <= limit; i++ {
+		tracks = append(tracks, newTrack(fmt.Sprintf("related %d", i), l.packets))
+	}
+	return tracks, nil
+}
+
+func (l fakeLoader) Search(query string, limit int) ([]*Track, error) {
+	if strings.Contains(query, "missing") {
+		return nil, ErrNoMatches
+	}
+	var tracks []*Track
+	for i := 1; i <= limit; i++ {
+		tracks = append(tracks, newTrack(fmt.Sprintf("%s %d", query, i), l.packets))
+	}
+	return tracks, nil
+}
+
+// newTestBot creates a bot with a fake session, voice and loader.
+func newTestBot() (*Bot, *fakeSession, *fakeVoices) {
+	session, voices := newFakeSession(), &fakeVoices{}
+	config := DefaultConfig()
+	config.SettingsFile, config.StateFile, config.PlaylistFile = "", "", ""
+	b, _ := New(config, session, voices.join, fakeLoader{packets: 1000})
+	return b, session, voices
+}
+
+// send sends a message from the user given and returns the reply.
+func send(b *Bot, s *fakeSession, user, content string) string {
+	b.HandleMessage(Message{GuildID: "1", ChannelID: "text", AuthorID: user, Content: content})
+	return s.last()
+}
+
+// waitFor waits for the condition to become true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// fakeFrame is the frame fake tracks play, it isn't silent so it can be told apart from the trailing silence.
+var fakeFrame = []byte{0xFC, 1, 2, 3}
+
+// eventLog records what the fakes did in order, repeating events are recorded once.
+type eventLog struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *eventLog) add(event string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) == 0 || l.events[len(l.events)-1] != event {
+		l.events = append(l.events, event)
+	}
+}
+
+func (l *eventLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// fakeLogger records the events logged, formatted like "warn msg key=value".
+type fakeLogger struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *fakeLogger) Log(level core.Level, msg string, fields ...core.Field) {
+	event := level.String() + " " + msg
+	for _, f := range fields {
+		event += fmt.Sprintf(" %s=%v", f.Key, f.Value)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+}
+
+func (l *fakeLogger) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.events...)
+}
+
+// fakePlayable plays a fixed amount of packets.
+type fakePlayable struct {
+	packets int
+	c       chan core.Packet
+	closed  chan struct{}
+	once    sync.Once
+	log     *eventLog
+
+	mu sync.Mutex
+	// next is the packet sent next, seeking moves it.
+	next int
+}
+
+func (f *fakePlayable) Close() error {
+	f.once.Do(func() {
+		close(f.closed)
+		f.log.add("close")
+	})
+	return nil
+}
+
+func (f *fakePlayable) Chan() <-chan core.Packet { return f.c }
+func (f *fakePlayable) Pause(bool)               {}
+func (f *fakePlayable) SampleRate() int          { return 48000 }
+func (f *fakePlayable) Channels() int            { return 2 }
+func (f *fakePlayable) Codec() string            { return "opus" }
+
+func (f *fakePlayable) Seek(position time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next = int(position / (20 * time.Millisecond))
+	return nil
+}
+
+func (f *fakePlayable) Play() {
+	defer close(f.c)
+	for {
+		f.mu.Lock()
+		i := f.next
+		f.next++
+		f.mu.Unlock()
+		if i >= f.packets {
+			return
+		}
+		select {
+		case f.c <- core.Packet{Timecode: time.Duration(i) * 20 * time.Millisecond, Data: fakeFrame}:
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// fakeTrack is a track of fake packets.
+type fakeTrack struct {
+	packets int
+	// log records when the playables are closed, nil to not record it.
+	log *eventLog
+}
+
+func (t fakeTrack) Playable() (core.Playable, error) {
+	return &fakePlayable{packets: t.packets, c: make(chan core.Packet), closed: make(chan struct{}), log: t.log}, nil
+}
+
+func (t fakeTrack) Bitrate() int            { return 0 }
+func (t fakeTrack) Codec() string           { return "opus" }
+func (t fakeTrack) Duration() time.Duration { return time.Duration(t.packets) * 20 * time.Millisecond }
+
+func newTrack(title string, packets int) *Track {
+	return &Track{Track: fakeTrack{packets: packets}, Info: lavalink.TrackInfo{Title: title, Length: int64(packets) * 20}}
+}
+
+// fakeVoice counts the frames it receives, pacing them like a real connection would.
+//
+// While down it fails to send until it is joined again.
+type fakeVoice struct {
+	mu           sync.Mutex
+	channelID    string
+	frames       int
+	joins        int
+	down         bool
+	disconnected bool
+	// log records the audio, the silence and the disconnection, nil to not record them.
+	log *eventLog
+	// slow delays disconnecting.
+	slow time.Duration
+}
+
+func (v *fakeVoice) WriteOpus(frame []byte) error {
+	time.Sleep(time.Millisecond)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.down {
+		return errVoiceClosed
+	}
+	v.frames++
+	if bytes.Equal(frame, opus.Silence) {
+		v.log.add("silence")
+	} else {
+		v.log.add("audio")
+	}
+	return nil
+}
+
+func (v *fakeVoice) setDown(down bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.down = down
+}
+
+func (v *fakeVoice) ChannelID() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.channelID
+}
+
+func (v *fakeVoice) Disconnect() error {
+	v.mu.Lock()
+	slow := v.slow
+	v.mu.Unlock()
+	time.Sleep(slow)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.disconnected = true
+	v.log.add("disconnect")
+	return nil
+}
+
+func (v *fakeVoice) count() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frames
+}
+
+// fakeVoices joins fake voice connections, one per guild.
+type fakeVoices struct {
+	mu     sync.Mutex
+	guilds map[string]*fakeVoice
+	// broken fails all joins.
+	broken bool
+	// log and slow are passed to the voice connections.
+	log  *eventLog
+	slow time.Duration
+	// hold delays joining until it is closed if set, held counts the joins it delayed.
+	hold chan struct{}
+	held int
+}
+
+func (f *fakeVoices) join(guildID, channelID string, deaf bool) (VoiceConnection, error) {
+	f.mu.Lock()
+	hold := f.hold
+	if hold != nil {
+		f.held++
+	}
+	f.mu.Unlock()
+	if hold != nil {
+		<-hold
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.broken {
+		return nil, errVoiceClosed
+	}
+	if f.guilds == nil {
+		f.guilds = make(map[string]*fakeVoice)
+	}
+	v, ok := f.guilds[guildID]
+	if !ok {
+		v = &fakeVoice{log: f.log, slow: f.slow}
+		f.guilds[guildID] = v
+	}
+	v.mu.Lock()
+	v.channelID = channelID
+	v.joins++
+	v.down = false
+	v.mu.Unlock()
+	return v, nil
+}
+
+func (f *fakeVoices) get(guildID string) *fakeVoice {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.guilds[guildID]
+}
+
+// collectEnds returns a manager that reports the tracks that ended in each guild.
+func collectEnds(voices *fakeVoices) (*GuildPlayerManager, chan string) {
+	m := NewGuildPlayerManager(voices.join)
+	ends := make(chan string, 256)
+	m.OnEvent = func(gp *GuildPlayer, e player.Event) {
+		if end, ok := e.(player.TrackEndEvent); ok {
+			ends <- gp.GuildID() + ":" + end.Track.(*Track).Title() + ":" + string(end.Reason)
+		}
+	}
+	return m, ends
+}
+
+func waitEnd(t *testing.T, ends chan string) string {
+	select {
+	case end := <-ends:
+		return end
+	case <-time.After(5 * time.Second):
+		t.Fatal("no track ended")
+		return ""
+	}
+}
@@ -0,0 +1,142 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueuePageSize is the amount of tracks shown in each page of the queue.
+const QueuePageSize = 10
+
+// FormatDuration formats a duration the way track lengths are usually shown, like 3:07 or 1:02:03.
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d/time.Hour), int(d/time.Minute)%60, int(d/time.Second)%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+// FormatLength formats the length of a track, LIVE for streams.
+func FormatLength(track *Track) string {
+	if track.Info.IsStream {
+		return "LIVE"
+	}
+	return FormatDuration(track.Length())
+}
+
+// ProgressBar draws the position within a track of the length given.
+func ProgressBar(position, length time.Duration, width int) string {
+	if length <= 0 {
+		return strings.Repeat("▬", width)
+	}
+	done := int(int64(width) * int64(position) / int64(length))
+	if done >= width {
+		done = width - 1
+	} else if done < 0 {
+		done = 0
+	}
+	return strings.Repeat("▬", done) + "🔘" + strings.Repeat("▬", width-done-1)
+}
+
+// FormatAgo formats how long ago something happened, roughly.
+func FormatAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", d/time.Hour)
+	}
+	return fmt.Sprintf("%dd ago", d/(24*time.Hour))
+}
+
+// QueuePage renders the page given of the queue, pages start at 1.
+//
+// Returns the rendered page and the amount of pages.
+func QueuePage(tracks []*Track, page int) (string, int) {
+	pages := (len(tracks) + QueuePageSize - 1) / QueuePageSize
+	if pages == 0 {
+		return "The queue is empty", 0
+	}
+	if page < 1 {
+		page = 1
+	} else if page > pages {
+		page = pages
+	}
+	var total time.Duration
+	for _, track := range tracks {
+		total += track.Length()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Queue - %d tracks [%s] - page %d/%d\n", len(tracks), FormatDuration(total), page, pages)
+	end := page * QueuePageSize
+	if end > len(tracks) {
+		end = len(tracks)
+	}
+	for i := (page - 1) * QueuePageSize; i < end; i++ {
+		fmt.Fprintf(&sb, "%d. %s [%s]", i+1, tracks[i].Title(), FormatLength(tracks[i]))
+		if tracks[i].Requester != "" {
+			fmt.Fprintf(&sb, " - <@%s>", tracks[i].Requester)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String(), pages
+}
+
+// HistoryPage renders the page given of the history as of the time given, pages start at 1.
+//
+// Returns the rendered page and the amount of pages.
+func HistoryPage(entries []HistoryEntry, page int, now time.Time) (string, int) {
+	pages := (len(entries) + QueuePageSize - 1) / QueuePageSize
+	if pages == 0 {
+		return "Nothing was played yet", 0
+	}
+	if page < 1 {
+		page = 1
+	} else if page > pages {
+		page = pages
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "History - %d tracks - page %d/%d\n", len(entries), page, pages)
+	end := page * QueuePageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	for i := (page - 1) * QueuePageSize; i < end; i++ {
+		entry := entries[i]
+		fmt.Fprintf(&sb, "%d. %s [%s]", i+1, entry.Track.Title(), FormatLength(entry.Track))
+		if entry.Requester != "" {
+			fmt.Fprintf(&sb, " - <@%s>", entry.Requester)
+		}
+		fmt.Fprintf(&sb, " - %s\n", FormatAgo(now.Sub(entry.Ended)))
+	}
+	return sb.String(), pages
+}
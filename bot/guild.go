@@ -0,0 +1,729 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/dondish/lionplayer/player"
+	"github.com/dondish/lionplayer/record"
+	"github.com/dondish/lionplayer/voice"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDestroyed is returned when using a guild player after it was removed from its manager.
+	ErrDestroyed = errors.New("the guild player was destroyed")
+	// ErrRecording is returned when starting a recording while already recording.
+	ErrRecording = errors.New("already recording")
+	// ErrNotRecording is returned when stopping a recording while not recording.
+	ErrNotRecording = errors.New("not recording")
+	// ErrReceiveUnsupported is returned when recording using a voice connection that can't receive audio.
+	ErrReceiveUnsupported = errors.New("the voice connection can't receive audio")
+	// ErrQueueFull is returned when enqueuing while the queue has the maximum number of tracks.
+	ErrQueueFull = errors.New("the queue is full")
+	// ErrNoHistory is returned when going back to the previous track before any track was played.
+	ErrNoHistory = errors.New("the history is empty")
+)
+
+// silenceFrames is the number of silent frames sent when leaving a voice channel while playing.
+const silenceFrames = 5
+
+// VoiceConnection is a connection to a voice channel of a guild.
+type VoiceConnection interface {
+	player.Sink
+	// ChannelID returns the id of the voice channel connected to.
+	ChannelID() string
+	// Disconnect leaves the voice channel.
+	Disconnect() error
+}
+
+// Receiver is implemented by voice connections that can receive the audio of other users.
+type Receiver interface {
+	// Receive returns the channel the audio of other users is received on.
+	Receive() <-chan voice.Packet
+	// OnSpeaking sets the function called when the user sending an SSRC becomes known.
+	OnSpeaking(func(ssrc uint32, userID string))
+}
+
+// VoiceJoiner joins the voice channel given, moving the connection of the guild if it already has one.
+//
+// The bot deafens itself unless deaf is false, which is needed to receive audio. A failed join must not leave
+// a connection open.
+type VoiceJoiner func(guildID, channelID string, deaf bool) (VoiceConnection, error)
+
+// Settings are the settings of a guild.
+type Settings struct {
+	// Prefix is the prefix of the commands.
+	Prefix string `json:"prefix"`
+	// Volume is the volume in percents, it is informational only since the audio is not re-encoded.
+	Volume int `json:"volume"`
+	// DJRole is the id of the role allowed to control the player, empty if everyone is.
+	DJRole string `json:"djRole,omitempty"`
+	// AnnounceChannel is the id of the channel tracks are announced in, empty for where they were requested.
+	AnnounceChannel string `json:"announceChannel,omitempty"`
+	// MaxQueueLength is the maximum number of tracks in the queue, 0 for unlimited.
+	MaxQueueLength int `json:"maxQueueLength"`
+	// IdleTimeout is the time to stay in a voice channel without playing, 0 to stay.
+	IdleTimeout Duration `json:"idleTimeout"`
+	// EmptyTimeout is the time to stay in a voice channel nobody listens in, the player is paused meanwhile.
+	EmptyTimeout Duration `json:"emptyTimeout"`
+	// AlwaysOn keeps the bot in the voice channel even when it is idle or empty.
+	AlwaysOn bool `json:"alwaysOn"`
+	// Autoplay plays tracks related to the last track once the queue runs out.
+	Autoplay bool `json:"autoplay,omitempty"`
+	// SkipVotes is the share of the listeners in percents who must vote to skip a track.
+	SkipVotes int `json:"skipVotes"`
+	// MaxTrackLength is the maximum length of the tracks users queue, 0 for unlimited.
+	MaxTrackLength Duration `json:"maxTrackLength"`
+	// BlockStreams rejects live streams.
+	BlockStreams bool `json:"blockStreams,omitempty"`
+	// MaxUserTracks is the maximum number of tracks each user may have in the queue, 0 for unlimited.
+	MaxUserTracks int `json:"maxUserTracks"`
+	// NoDuplicates rejects tracks that are already playing or queued.
+	NoDuplicates bool `json:"noDuplicates,omitempty"`
+	// FairQueue makes the requesters take turns instead of playing the tracks in the order they were queued.
+	FairQueue bool `json:"fairQueue,omitempty"`
+	// Blocklist are the identifiers, urls or parts of titles and authors of tracks that are rejected.
+	Blocklist []string `json:"blocklist,omitempty"`
+}
+
+// LoopMode is what is repeated once a track finishes.
+type LoopMode string
+
+// The loop modes.
+const (
+	// LoopOff plays every track once.
+	LoopOff LoopMode = "off"
+	// LoopTrack repeats the current track.
+	LoopTrack LoopMode = "track"
+	// LoopQueue adds the tracks back to the end of the queue after they finish.
+	LoopQueue LoopMode = "queue"
+)
+
+// Next returns the loop mode after this one, cycling through off, track and queue.
+func (m LoopMode) Next() LoopMode {
+	switch m {
+	case LoopOff:
+		return LoopTrack
+	case LoopTrack:
+		return LoopQueue
+	}
+	return LoopOff
+}
+
+// ParseLoopMode parses the name of a loop mode.
+func ParseLoopMode(name string) (LoopMode, bool) {
+	switch mode := LoopMode(name); mode {
+	case LoopOff, LoopTrack, LoopQueue:
+		return mode, true
+	}
+	return "", false
+}
+
+// DefaultSettings are the settings of guilds when no others are given.
+var DefaultSettings = DefaultConfig().GuildSettings()
+
+// recording is a recording in progress.
+type recording struct {
+	*record.Recorder
+	stop chan struct{}
+	done chan struct{}
+}
+
+// GuildPlayer owns everything the bot needs to play in a single guild.
+//
+// It is safe for concurrent use.
+type GuildPlayer struct {
+	guildID string
+	manager *GuildPlayerManager
+	player  *player.Player
+	queue   Queue
+	history *History
+
+	// Serializes the operations changing the current track.
+	playMu sync.Mutex
+	// Serializes joining voice channels, which is done without holding mu.
+	joinMu sync.Mutex
+
+	mu          sync.Mutex
+	voice       VoiceConnection
+	deaf        bool
+	current     *Track
+	started     time.Time
+	loop        LoopMode
+	textChannel string
+	settings    Settings
+	votes       map[string]bool
+	recording   *recording
+	// reconnecting is whether the voice connection failed and is being reconnected.
+	reconnecting bool
+	destroyed    bool
+	logger       core.Logger
+}
+
+// newGuildPlayer creates the player of the guild given.
+func newGuildPlayer(m *GuildPlayerManager, guildID string) *GuildPlayer {
+	gp := &GuildPlayer{
+		guildID:  guildID,
+		manager:  m,
+		player:   player.New(nil),
+		history:  m.history(guildID),
+		settings: m.settings(guildID),
+		loop:     LoopOff,
+		logger:   core.With(m.Logger, core.F(core.KeyGuild, guildID)),
+	}
+	gp.player.SetVolume(gp.settings.Volume)
+	gp.player.OnEvent = gp.onEvent
+	gp.player.Metrics = m.Metrics
+	gp.player.Logger = gp.logger
+	return gp
+}
+
+// GuildID returns the id of the guild.
+func (gp *GuildPlayer) GuildID() string {
+	return gp.guildID
+}
+
+// Player returns the underlying player, which can be used to pause, seek and query the position.
+func (gp *GuildPlayer) Player() *player.Player {
+	return gp.player
+}
+
+// Queue returns the queue of the tracks waiting to be played.
+func (gp *GuildPlayer) Queue() *Queue {
+	return &gp.queue
+}
+
+// History returns the history of the tracks played in the guild.
+func (gp *GuildPlayer) History() *History {
+	return gp.history
+}
+
+// Join joins the voice channel given, moving from the current channel if needed.
+func (gp *GuildPlayer) Join(channelID string) error {
+	gp.joinMu.Lock()
+	defer gp.joinMu.Unlock()
+	return gp.join(channelID, false)
+}
+
+// join joins the voice channel given, deafened unless recording or about to record, joinMu must be held.
+//
+// mu isn't held while joining as it may take a while, if the player was destroyed meanwhile the new connection
+// is left.
+func (gp *GuildPlayer) join(channelID string, record bool) error {
+	gp.mu.Lock()
+	if gp.destroyed {
+		gp.mu.Unlock()
+		return ErrDestroyed
+	}
+	deaf := gp.recording == nil && !record
+	if gp.voice != nil && gp.voice.ChannelID() == channelID && gp.deaf == deaf {
+		gp.mu.Unlock()
+		return nil
+	}
+	gp.mu.Unlock()
+	vc, err := gp.manager.join(gp.guildID, channelID, deaf)
+	if err != nil {
+		return err
+	}
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	if gp.destroyed {
+		_ = vc.Disconnect()
+		return ErrDestroyed
+	}
+	gp.voice, gp.deaf = vc, deaf
+	gp.player.SetSink(vc)
+	return nil
+}
+
+// VoiceChannel returns the id of the voice channel the bot is in, empty if not connected.
+func (gp *GuildPlayer) VoiceChannel() string {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	if gp.voice == nil {
+		return ""
+	}
+	return gp.voice.ChannelID()
+}
+
+// TextChannel returns the id of the text channel bound to the player.
+func (gp *GuildPlayer) TextChannel() string {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	return gp.textChannel
+}
+
+// BindTextChannel binds the text channel given to the player, announcements are sent to it.
+func (gp *GuildPlayer) BindTextChannel(channelID string) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	gp.textChannel = channelID
+}
+
+// Settings returns the settings of the player.
+func (gp *GuildPlayer) Settings() Settings {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	return gp.settings
+}
+
+// SetSettings changes the settings of the player, turning the fair queue on reorders the queue.
+func (gp *GuildPlayer) SetSettings(settings Settings) {
+	gp.mu.Lock()
+	if settings.FairQueue && !gp.settings.FairQueue {
+		gp.queue.Interleave(gp.current)
+	}
+	gp.settings = settings
+	gp.mu.Unlock()
+	gp.player.SetVolume(settings.Volume)
+}
+
+// Current returns the track currently playing, nil if not playing.
+func (gp *GuildPlayer) Current() *Track {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	return gp.current
+}
+
+// Loop returns the loop mode.
+func (gp *GuildPlayer) Loop() LoopMode {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	return gp.loop
+}
+
+// SetLoop changes the loop mode.
+func (gp *GuildPlayer) SetLoop(mode LoopMode) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	gp.loop = mode
+}
+
+// Enqueue plays the track given, or adds it to the queue if a track is already playing.
+//
+// It returns the position of the track in the queue, 0 if it started playing, ErrQueueFull, or a
+// PolicyError if the settings don't allow the track.
+func (gp *GuildPlayer) Enqueue(track *Track) (int, error) {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed {
+		gp.mu.Unlock()
+		return 0, ErrDestroyed
+	}
+	if err := gp.settings.Check(track, gp.current, gp.queue.Tracks()); err != nil {
+		gp.mu.Unlock()
+		return 0, err
+	}
+	if gp.current != nil {
+		defer gp.mu.Unlock()
+		if max := gp.settings.MaxQueueLength; max > 0 && gp.queue.Len() >= max {
+			return 0, ErrQueueFull
+		}
+		if gp.settings.FairQueue {
+			return gp.queue.PushFair(track, gp.current), nil
+		}
+		return gp.queue.Push(track), nil
+	}
+	gp.setCurrent(track)
+	gp.mu.Unlock()
+	gp.player.Play(track, 0, 0)
+	return 0, nil
+}
+
+// PlayFrom plays the track given from the position given, replacing the current track.
+//
+// The replaced track doesn't advance the queue, it is used to restore the track that was playing.
+func (gp *GuildPlayer) PlayFrom(track *Track, position time.Duration) error {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed {
+		gp.mu.Unlock()
+		return ErrDestroyed
+	}
+	gp.setCurrent(track)
+	gp.mu.Unlock()
+	gp.player.Play(track, position, 0)
+	return nil
+}
+
+// Skip skips the current track and the next n-1 tracks in the queue, then plays the next one.
+//
+// It returns the skipped tracks, starting with the current one. While looping the
+// queue the skipped tracks are added back to its end.
+func (gp *GuildPlayer) Skip(n int) ([]*Track, error) {
+	return gp.skip(nil, n)
+}
+
+// SkipTrack skips the track given if it is still playing, like Skip(1).
+func (gp *GuildPlayer) SkipTrack(track *Track) ([]*Track, error) {
+	return gp.skip(track, 1)
+}
+
+// skip skips n tracks starting with the current one, which must be the track given unless it is nil.
+func (gp *GuildPlayer) skip(expected *Track, n int) ([]*Track, error) {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	current := gp.current
+	if current == nil || (expected != nil && current != expected) {
+		gp.mu.Unlock()
+		return nil, player.ErrNotPlaying
+	}
+	skipped := append([]*Track{current}, gp.queue.Drop(n-1)...)
+	if gp.loop == LoopQueue {
+		for _, track := range skipped {
+			gp.queue.Push(track)
+		}
+	}
+	next := gp.queue.Pop()
+	gp.setCurrent(next)
+	gp.mu.Unlock()
+	if next != nil {
+		gp.player.Play(next, 0, 0)
+	} else {
+		gp.player.Stop()
+		gp.queueEnded(skipped[len(skipped)-1])
+	}
+	return skipped, nil
+}
+
+// Stop stops the current track and clears the queue.
+func (gp *GuildPlayer) Stop() {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	gp.setCurrent(nil)
+	gp.mu.Unlock()
+	gp.queue.Clear()
+	gp.player.Stop()
+}
+
+// advance plays the next track after the track given ended, according to the loop mode.
+func (gp *GuildPlayer) advance(ended *Track, reason player.EndReason) {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed || gp.current != ended {
+		gp.mu.Unlock()
+		return
+	}
+	// Tracks that failed to load are never repeated, they would fail again, nor are they added to the history.
+	repeat := reason == player.Finished
+	if reason == player.LoadFailed {
+		gp.current = nil
+	}
+	var next *Track
+	if gp.loop == LoopTrack && repeat {
+		next = ended
+	} else {
+		if gp.loop == LoopQueue && repeat {
+			gp.queue.Push(ended)
+		}
+		next = gp.queue.Pop()
+	}
+	gp.setCurrent(next)
+	gp.mu.Unlock()
+	if next != nil {
+		gp.player.Play(next, 0, 0)
+	} else {
+		gp.queueEnded(ended)
+	}
+}
+
+// queueEnded lets the manager know the queue ran out after the track given.
+func (gp *GuildPlayer) queueEnded(last *Track) {
+	if f := gp.manager.OnQueueEnd; f != nil {
+		go f(gp, last)
+	}
+}
+
+// Previous plays the most recent track in the history again and removes it from the history.
+//
+// The current track is put back at the front of the queue. Returns the track played or ErrNoHistory.
+func (gp *GuildPlayer) Previous() (*Track, error) {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed {
+		gp.mu.Unlock()
+		return nil, ErrDestroyed
+	}
+	entry, ok := gp.history.Pop()
+	if !ok {
+		gp.mu.Unlock()
+		return nil, ErrNoHistory
+	}
+	if gp.current != nil {
+		gp.queue.Insert(1, gp.current)
+		gp.current = nil
+	}
+	gp.setCurrent(entry.Track)
+	gp.mu.Unlock()
+	gp.player.Play(entry.Track, 0, 0)
+	return entry.Track, nil
+}
+
+// setCurrent changes the current track, adding the replaced track to the history, and resets the skip votes.
+// mu must be held.
+func (gp *GuildPlayer) setCurrent(track *Track) {
+	now := time.Now()
+	if gp.current != nil && gp.current != track {
+		gp.history.Push(HistoryEntry{Track: gp.current, Requester: gp.current.Requester, Started: gp.started, Ended: now})
+	}
+	gp.current, gp.started = track, now
+	gp.votes = nil
+}
+
+// VoteSkip records the vote of the user given to skip the current track.
+//
+// It returns the track voted on and the users who voted to skip it, the votes reset once another track plays.
+func (gp *GuildPlayer) VoteSkip(userID string) (*Track, []string, error) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	if gp.current == nil {
+		return nil, nil, player.ErrNotPlaying
+	}
+	if gp.votes == nil {
+		gp.votes = make(map[string]bool)
+	}
+	gp.votes[userID] = true
+	voters := make([]string, 0, len(gp.votes))
+	for voter := range gp.votes {
+		voters = append(voters, voter)
+	}
+	return gp.current, voters, nil
+}
+
+// onEvent handles the events of the player.
+func (gp *GuildPlayer) onEvent(e player.Event) {
+	switch e := e.(type) {
+	case player.TrackEndEvent:
+		if track, ok := e.Track.(*Track); ok && e.Reason.MayStartNext() {
+			go gp.advance(track, e.Reason)
+		}
+	case player.TrackExceptionEvent:
+		gp.logger.Log(core.LevelWarn, "track failed", core.F(core.KeyTrack, trackIdentifier(e.Track)), core.F(core.KeyError, e.Err))
+	case player.TrackStuckEvent:
+		gp.logger.Log(core.LevelWarn, "track stuck", core.F(core.KeyTrack, trackIdentifier(e.Track)), core.F("threshold", e.Threshold))
+	case player.SinkErrorEvent:
+		gp.logger.Log(core.LevelWarn, "voice connection failed", core.F(core.KeyError, e.Err))
+		go gp.reconnect(e.Sink, e.Err)
+	}
+	gp.manager.emit(gp, e)
+}
+
+// trackIdentifier returns the identifier of the track given, empty if it isn't a Track.
+func trackIdentifier(track core.Track) string {
+	if t, ok := track.(*Track); ok {
+		return t.Info.Identifier
+	}
+	return ""
+}
+
+// reconnect rejoins the voice channel after the connection failed to send a frame.
+//
+// The player keeps the frame and halts meanwhile, so the track resumes where it stopped. The channel
+// is taken from the failed connection as the bot may have been moved. If all of the attempts fail
+// the player is removed.
+func (gp *GuildPlayer) reconnect(failed player.Sink, cause error) {
+	gp.mu.Lock()
+	if gp.destroyed || gp.reconnecting || gp.voice == nil || player.Sink(gp.voice) != failed {
+		gp.mu.Unlock()
+		return
+	}
+	gp.reconnecting = true
+	failedVoice, channelID := gp.voice, gp.voice.ChannelID()
+	gp.mu.Unlock()
+	// The failed connection still holds its socket, and may be handed back by the next join if left open.
+	_ = failedVoice.Disconnect()
+
+	err := cause
+	delay := gp.manager.ReconnectDelay
+	for attempt := 0; attempt < gp.manager.ReconnectAttempts; attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		var done bool
+		done, err = gp.rejoin(failed, channelID)
+		if done {
+			if err == nil {
+				gp.logger.Log(core.LevelInfo, "reconnected", core.F("attempt", attempt+1))
+			}
+			return
+		}
+		gp.logger.Log(core.LevelWarn, "reconnecting failed", core.F("attempt", attempt+1), core.F(core.KeyError, err))
+	}
+	gp.mu.Lock()
+	gp.reconnecting = false
+	gp.mu.Unlock()
+	gp.logger.Log(core.LevelError, "gave up reconnecting", core.F(core.KeyError, err))
+	if gp.manager.removePlayer(gp) && gp.manager.OnDisconnect != nil {
+		gp.manager.OnDisconnect(gp, err)
+	}
+}
+
+// rejoin makes a single attempt to rejoin the channel of the failed connection, returning whether to stop
+// reconnecting.
+//
+// Reconnecting stops once the attempt succeeds, or if the player was destroyed or joined another channel meanwhile.
+func (gp *GuildPlayer) rejoin(failed player.Sink, channelID string) (bool, error) {
+	gp.joinMu.Lock()
+	defer gp.joinMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed || gp.voice == nil || player.Sink(gp.voice) != failed {
+		gp.reconnecting = false
+		gp.mu.Unlock()
+		return true, ErrDestroyed
+	}
+	deaf := gp.deaf
+	gp.mu.Unlock()
+
+	vc, err := gp.manager.join(gp.guildID, channelID, deaf)
+	if err != nil {
+		return false, err
+	}
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	gp.reconnecting = false
+	if gp.destroyed {
+		_ = vc.Disconnect()
+		return true, ErrDestroyed
+	}
+	gp.voice = vc
+	gp.player.SetSink(vc)
+	return true, nil
+}
+
+// StartRecording joins the voice channel given undeafened and records it into the directory given.
+func (gp *GuildPlayer) StartRecording(channelID, dir string) (*record.Recorder, error) {
+	gp.joinMu.Lock()
+	defer gp.joinMu.Unlock()
+	if gp.Recording() {
+		return nil, ErrRecording
+	}
+	if err := gp.join(channelID, true); err != nil {
+		return nil, err
+	}
+	rec, err := record.New(dir)
+	if err != nil {
+		return nil, err
+	}
+	rec.Logger = gp.logger
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	if gp.destroyed {
+		_ = rec.Close()
+		return nil, ErrDestroyed
+	}
+	if gp.recording != nil {
+		_ = rec.Close()
+		return nil, ErrRecording
+	}
+	receiver, ok := gp.voice.(Receiver)
+	if !ok {
+		_ = rec.Close()
+		return nil, ErrReceiveUnsupported
+	}
+	r := &recording{Recorder: rec, stop: make(chan struct{}), done: make(chan struct{})}
+	gp.recording = r
+	receiver.OnSpeaking(rec.SetUser)
+	go func() {
+		defer close(r.done)
+		c := receiver.Receive()
+		// Only the first failure is logged, the packets keep failing the same way.
+		var failed bool
+		for {
+			select {
+			case <-r.stop:
+				return
+			case p, ok := <-c:
+				if !ok {
+					return
+				}
+				if err := rec.Write(p); err != nil && !failed {
+					failed = true
+					gp.logger.Log(core.LevelError, "recording failed", core.F("dir", rec.Dir()), core.F(core.KeyError, err))
+				}
+			}
+		}
+	}()
+	return rec, nil
+}
+
+// Recording returns whether the player is recording.
+func (gp *GuildPlayer) Recording() bool {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+	return gp.recording != nil
+}
+
+// StopRecording stops the recording and closes its files.
+func (gp *GuildPlayer) StopRecording() (*record.Recorder, error) {
+	gp.mu.Lock()
+	r := gp.recording
+	gp.recording = nil
+	gp.mu.Unlock()
+	if r == nil {
+		return nil, ErrNotRecording
+	}
+	close(r.stop)
+	<-r.done
+	return r.Recorder, r.Close()
+}
+
+// destroy stops everything, closing the track playing, and leaves the voice channel.
+func (gp *GuildPlayer) destroy() {
+	gp.playMu.Lock()
+	defer gp.playMu.Unlock()
+	gp.mu.Lock()
+	if gp.destroyed {
+		gp.mu.Unlock()
+		return
+	}
+	gp.destroyed = true
+	gp.current = nil
+	vc := gp.voice
+	gp.voice = nil
+	gp.mu.Unlock()
+
+	gp.queue.Clear()
+	_, _ = gp.StopRecording()
+	playing := gp.player.Track() != nil && !gp.player.Paused()
+	_ = gp.player.Close()
+	if vc != nil {
+		// Discord interpolates the last frames unless the audio ends with silence.
+		for i := 0; playing && i < silenceFrames; i++ {
+			if vc.WriteOpus(opus.Silence) != nil {
+				break
+			}
+		}
+		_ = vc.Disconnect()
+	}
+}
@@ -0,0 +1,101 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHistoryLength is the default amount of tracks kept in the history of each guild.
+const DefaultHistoryLength = 50
+
+// HistoryEntry is a track that was played.
+type HistoryEntry struct {
+	Track *Track
+	// Requester is the id of the user who requested the track.
+	Requester string
+	Started   time.Time
+	Ended     time.Time
+}
+
+// History is a synchronized list of the last tracks played, the most recent first.
+type History struct {
+	mu      sync.Mutex
+	max     int
+	entries []HistoryEntry
+}
+
+// NewHistory creates a history keeping up to max tracks, unbounded if max isn't positive.
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// Push adds a track that finished playing, forgetting the oldest one if the history is full.
+func (h *History) Push(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append([]HistoryEntry{entry}, h.entries...)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries[len(h.entries)-1] = HistoryEntry{}
+		h.entries = h.entries[:h.max]
+	}
+}
+
+// Pop removes and returns the most recent track, false if the history is empty.
+func (h *History) Pop() (HistoryEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) == 0 {
+		return HistoryEntry{}, false
+	}
+	entry := h.entries[0]
+	h.entries = append(h.entries[:0], h.entries[1:]...)
+	return entry, true
+}
+
+// Get returns the track at the position given, starting at 1 for the most recent.
+func (h *History) Get(position int) (HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if position < 1 || position > len(h.entries) {
+		return HistoryEntry{}, ErrOutOfRange
+	}
+	return h.entries[position-1], nil
+}
+
+// Len returns the amount of tracks in the history.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// Entries returns a copy of the history, the most recent first.
+func (h *History) Entries() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HistoryEntry(nil), h.entries...)
+}
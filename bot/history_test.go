@@ -0,0 +1,46 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	s.voice["u"] = "voice"
+
+	assert.Equal(t, "Nothing was played yet", send(b, s, "u", "!!previous"))
+	send(b, s, "u", "!!play a")
+	send(b, s, "u", "!!play b")
+	send(b, s, "u", "!!skip")
+	assert.Equal(t, "History - 1 tracks - page 1/1\n1. a [0:20] - <@u> - just now\n", send(b, s, "u", "!!history"))
+	assert.Equal(t, "Queued - a -  [#1]", send(b, s, "u", "!!requeue 1"))
+	assert.Equal(t, "There is no track at index 2 of the history", send(b, s, "u", "!!requeue 2"))
+	assert.Equal(t, "Playing a again", send(b, s, "u", "!!back"))
+	assert.Equal(t, []string{"b", "a"}, titles(b.Manager.Get("1").Queue().Tracks()))
+}
@@ -0,0 +1,213 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package bot implements the Discord music bot on top of the lionplayer packages.
+package bot
+
+import (
+	"context"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/player"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The defaults of the reconnection settings.
+const (
+	DefaultReconnectDelay    = time.Second
+	DefaultReconnectAttempts = 5
+)
+
+// GuildPlayerManager owns the players of all of the guilds the bot plays in.
+//
+// It is safe for concurrent use, each guild is served independently.
+type GuildPlayerManager struct {
+	// OnEvent is called with the events of the players of all guilds, it must not block.
+	OnEvent func(*GuildPlayer, player.Event)
+	// Settings returns the settings of a guild new players start with, if nil they start with DefaultSettings.
+	Settings func(guildID string) Settings
+	// OnQueueEnd is called when the queue ran out after the track given, it may enqueue another track.
+	OnQueueEnd func(gp *GuildPlayer, last *Track)
+	// OnDisconnect is called when a player gave up reconnecting to its voice channel and was removed.
+	OnDisconnect func(*GuildPlayer, error)
+	// ReconnectDelay is the delay before reconnecting after the voice connection failed, it doubles with each attempt.
+	ReconnectDelay time.Duration
+	// ReconnectAttempts is the number of attempts to reconnect before giving up.
+	ReconnectAttempts int
+	// HistoryLength is the amount of tracks kept in the history of each guild.
+	HistoryLength int
+	// Logger logs the failures of the players, nil for core.DefaultLogger.
+	Logger core.Logger
+	// Metrics measures the players, nil for core.DefaultMetrics.
+	Metrics core.Metrics
+	// Shard is the id of the shard the guilds belong to, it labels the metrics.
+	Shard int
+
+	join      VoiceJoiner
+	mu        sync.Mutex
+	guilds    map[string]*GuildPlayer
+	histories map[string]*History
+}
+
+// NewGuildPlayerManager creates a manager joining voice channels using the function given.
+func NewGuildPlayerManager(join VoiceJoiner) *GuildPlayerManager {
+	return &GuildPlayerManager{
+		ReconnectDelay:    DefaultReconnectDelay,
+		ReconnectAttempts: DefaultReconnectAttempts,
+		HistoryLength:     DefaultHistoryLength,
+		join:              join,
+		guilds:            make(map[string]*GuildPlayer),
+		histories:         make(map[string]*History),
+	}
+}
+
+// History returns the history of the tracks played in the guild given, it outlives the guild's players.
+func (m *GuildPlayerManager) History(guildID string) *History {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.history(guildID)
+}
+
+// history returns the history of the guild given, creating it if needed, mu must be held.
+func (m *GuildPlayerManager) history(guildID string) *History {
+	h, ok := m.histories[guildID]
+	if !ok {
+		h = NewHistory(m.HistoryLength)
+		m.histories[guildID] = h
+	}
+	return h
+}
+
+// Get returns the player of the guild given, nil if it doesn't have one.
+func (m *GuildPlayerManager) Get(guildID string) *GuildPlayer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.guilds[guildID]
+}
+
+// GetOrCreate returns the player of the guild given, creating it if needed.
+func (m *GuildPlayerManager) GetOrCreate(guildID string) *GuildPlayer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	gp, ok := m.guilds[guildID]
+	if !ok {
+		gp = newGuildPlayer(m, guildID)
+		m.guilds[guildID] = gp
+		m.measure()
+	}
+	return gp
+}
+
+// measure sets the gauge of the active players, mu must be held.
+func (m *GuildPlayerManager) measure() {
+	core.MetricsOr(m.Metrics).Set(core.MetricActivePlayers, float64(len(m.guilds)), core.L(core.LabelShard, strconv.Itoa(m.Shard)))
+}
+
+// Remove destroys the player of the guild given, leaving its voice channel.
+//
+// It is used both when leaving on purpose and when the bot was disconnected.
+// Returns whether the guild had a player.
+func (m *GuildPlayerManager) Remove(guildID string) bool {
+	m.mu.Lock()
+	gp, ok := m.guilds[guildID]
+	delete(m.guilds, guildID)
+	m.measure()
+	m.mu.Unlock()
+	if ok {
+		gp.destroy()
+	}
+	return ok
+}
+
+// removePlayer destroys the player given if it is still the player of its guild, returning whether it was.
+func (m *GuildPlayerManager) removePlayer(gp *GuildPlayer) bool {
+	m.mu.Lock()
+	ok := m.guilds[gp.guildID] == gp
+	if ok {
+		delete(m.guilds, gp.guildID)
+		m.measure()
+	}
+	m.mu.Unlock()
+	if ok {
+		gp.destroy()
+	}
+	return ok
+}
+
+// Guilds returns the players of all guilds.
+func (m *GuildPlayerManager) Guilds() []*GuildPlayer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	players := make([]*GuildPlayer, 0, len(m.guilds))
+	for _, gp := range m.guilds {
+		players = append(players, gp)
+	}
+	return players
+}
+
+// Close destroys the players of all guilds.
+func (m *GuildPlayerManager) Close() {
+	_ = m.Shutdown(context.Background())
+}
+
+// Shutdown destroys the players of all guilds concurrently and waits until they left their voice channels.
+//
+// If ctx is done first the players keep leaving in the background and the error of ctx is returned.
+func (m *GuildPlayerManager) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for _, gp := range m.Guilds() {
+			wg.Add(1)
+			go func(gp *GuildPlayer) {
+				defer wg.Done()
+				m.removePlayer(gp)
+			}(gp)
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// settings returns the settings of the guild given.
+func (m *GuildPlayerManager) settings(guildID string) Settings {
+	if m.Settings == nil {
+		return DefaultSettings
+	}
+	return m.Settings(guildID)
+}
+
+// emit passes an event to the event handler.
+func (m *GuildPlayerManager) emit(gp *GuildPlayer, e player.Event) {
+	if m.OnEvent != nil {
+		m.OnEvent(gp, e)
+	}
+}
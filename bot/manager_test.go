@@ -0,0 +1,247 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuildPlayerManager_Concurrent(t *testing.T) {
+	voices := &fakeVoices{}
+	m, ends := collectEnds(voices)
+	defer m.Close()
+
+	for _, guild := range []string{"1", "2"} {
+		gp := m.GetOrCreate(guild)
+		assert.Equal(t, gp, m.GetOrCreate(guild), "a guild should have a single player")
+		assert.Nil(t, gp.Join("voice"+guild))
+		position, err := gp.Enqueue(newTrack("a", 20))
+		assert.Nil(t, err, "error is supposed to be nil")
+		assert.Equal(t, 0, position, "the first track should start right away")
+		position, _ = gp.Enqueue(newTrack("b", 10))
+		assert.Equal(t, 1, position)
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		got[waitEnd(t, ends)] = true
+	}
+	assert.Equal(t, map[string]bool{"1:a:finished": true, "1:b:finished": true, "2:a:finished": true, "2:b:finished": true}, got)
+	assert.Equal(t, 30, voices.get("1").count(), "each guild should play its own tracks")
+	assert.Equal(t, 30, voices.get("2").count(), "each guild should play its own tracks")
+	assert.Len(t, m.Guilds(), 2)
+}
+
+func TestGuildPlayer_SkipAndLeave(t *testing.T) {
+	voices := &fakeVoices{}
+	m, ends := collectEnds(voices)
+
+	gp := m.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"))
+	assert.Equal(t, "voice", gp.VoiceChannel())
+	_, _ = gp.Enqueue(newTrack("a", 1000))
+	_, _ = gp.Enqueue(newTrack("b", 1000))
+
+	skipped, err := gp.Skip(1)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "a", skipped[0].Title())
+	assert.Equal(t, "1:a:replaced", waitEnd(t, ends))
+	assert.Equal(t, "b", gp.Current().Title())
+	assert.Equal(t, 0, gp.Queue().Len())
+
+	assert.True(t, m.Remove("1"))
+	assert.Equal(t, "1:b:cleanup", waitEnd(t, ends))
+	assert.True(t, voices.get("1").disconnected, "leaving should disconnect")
+	assert.Nil(t, m.Get("1"))
+	_, err = gp.Enqueue(newTrack("c", 1))
+	assert.Equal(t, ErrDestroyed, err)
+}
+
+func TestGuildPlayer_Loop(t *testing.T) {
+	voices := &fakeVoices{}
+	m, ends := collectEnds(voices)
+	defer m.Close()
+
+	gp := m.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"))
+	gp.SetLoop(LoopTrack)
+	_, _ = gp.Enqueue(newTrack("a", 5))
+	_, _ = gp.Enqueue(newTrack("b", 5))
+	assert.Equal(t, "1:a:finished", waitEnd(t, ends))
+	assert.Equal(t, "1:a:finished", waitEnd(t, ends), "the track should repeat")
+	gp.Stop()
+	assert.Nil(t, gp.Current())
+
+	gp = m.GetOrCreate("2")
+	assert.Nil(t, gp.Join("voice"))
+	gp.SetLoop(LoopQueue)
+	_, _ = gp.Enqueue(newTrack("a", 5))
+	_, _ = gp.Enqueue(newTrack("b", 5))
+	for _, expected := range []string{"2:a:finished", "2:b:finished", "2:a:finished", "2:b:finished"} {
+		end := waitEnd(t, ends)
+		for strings.HasPrefix(end, "1:") {
+			end = waitEnd(t, ends)
+		}
+		assert.Equal(t, expected, end, "the queue should repeat")
+	}
+}
+
+func TestGuildPlayer_History(t *testing.T) {
+	voices := &fakeVoices{}
+	m, _ := collectEnds(voices)
+	defer m.Close()
+	m.HistoryLength = 2
+
+	gp := m.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"))
+	_, err := gp.Previous()
+	assert.Equal(t, ErrNoHistory, err)
+	for _, title := range []string{"a", "b", "c"} {
+		_, _ = gp.Enqueue(newTrack(title, 1000))
+	}
+	gp.Current().Requester = "u"
+	_, _ = gp.Skip(1)
+	_, _ = gp.Skip(1)
+	entries := gp.History().Entries()
+	assert.Equal(t, []string{"b", "a"}, []string{entries[0].Track.Title(), entries[1].Track.Title()})
+	assert.Equal(t, "u", entries[1].Requester)
+	assert.False(t, entries[1].Ended.Before(entries[1].Started))
+
+	track, err := gp.Previous()
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "b", track.Title())
+	assert.Equal(t, "b", gp.Current().Title())
+	assert.Equal(t, []string{"c"}, titles(gp.Queue().Tracks()), "the replaced track should play next")
+	assert.Equal(t, 1, gp.History().Len(), "the track played again should leave the history")
+
+	_, _ = gp.Skip(1)
+	gp.Stop()
+	entries = gp.History().Entries()
+	assert.Len(t, entries, 2, "the history should be bounded")
+	assert.Equal(t, "c", entries[0].Track.Title())
+
+	m.Remove("1")
+	gp = m.GetOrCreate("1")
+	assert.Equal(t, 2, gp.History().Len(), "the history should outlive the player")
+}
+
+func TestGuildPlayer_Reconnect(t *testing.T) {
+	voices := &fakeVoices{}
+	m, ends := collectEnds(voices)
+	m.ReconnectDelay = 10 * time.Millisecond
+	m.ReconnectAttempts = 3
+	disconnected := make(chan error, 1)
+	m.OnDisconnect = func(gp *GuildPlayer, err error) {
+		disconnected <- err
+	}
+	defer m.Close()
+
+	gp := m.GetOrCreate("1")
+	assert.Nil(t, gp.Join("voice"), "error is supposed to be nil")
+	_, err := gp.Enqueue(newTrack("a", 1000))
+	assert.Nil(t, err, "error is supposed to be nil")
+	v := voices.get("1")
+	for v.count() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+
+	v.setDown(true)
+	deadline := time.Now().Add(time.Second)
+	for {
+		v.mu.Lock()
+		joins := v.joins
+		v.mu.Unlock()
+		if joins == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the player should reconnect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	v.mu.Lock()
+	assert.True(t, v.disconnected, "the failed connection should be disconnected before rejoining")
+	v.disconnected = false
+	v.mu.Unlock()
+	before := v.count()
+	for v.count() < before+10 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "a", gp.Current().Title(), "the track should keep playing")
+	assert.Equal(t, 0, len(ends), "the track should not end")
+
+	voices.mu.Lock()
+	voices.broken = true
+	voices.mu.Unlock()
+	v.setDown(true)
+	select {
+	case err := <-disconnected:
+		assert.Equal(t, errVoiceClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("the player should give up")
+	}
+	v.mu.Lock()
+	assert.True(t, v.disconnected, "the failed connection should be disconnected")
+	v.mu.Unlock()
+	assert.Nil(t, m.Get("1"), "the player should be removed")
+}
+
+func TestGuildPlayer_SlowJoin(t *testing.T) {
+	voices := &fakeVoices{hold: make(chan struct{})}
+	m := NewGuildPlayerManager(voices.join)
+	defer m.Close()
+
+	gp := m.GetOrCreate("1")
+	joined := make(chan error, 1)
+	go func() {
+		joined <- gp.Join("voice")
+	}()
+	waitFor(t, "the join to start", func() bool {
+		voices.mu.Lock()
+		defer voices.mu.Unlock()
+		return voices.held == 1
+	})
+	got := make(chan string, 1)
+	go func() {
+		got <- gp.VoiceChannel()
+	}()
+	select {
+	case channelID := <-got:
+		assert.Equal(t, "", channelID)
+	case <-time.After(time.Second):
+		t.Fatal("the player should not be locked while joining")
+	}
+
+	assert.True(t, m.Remove("1"), "the player should be removed while joining")
+	close(voices.hold)
+	assert.Equal(t, ErrDestroyed, <-joined)
+	v := voices.get("1")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	assert.True(t, v.disconnected, "the connection joined after the player was destroyed should be left")
+}
@@ -0,0 +1,66 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import "net/http"
+
+// NewMetricsHandler creates a handler serving the metrics given on /metrics along with the checks of the bot given.
+//
+// /healthz succeeds until the bot shuts down, /readyz succeeds while it is ready to serve users, see Bot.SetReady.
+func NewMetricsHandler(b *Bot, metrics http.Handler) http.Handler {
+	return newMetricsHandler(metrics, []*Bot{b})
+}
+
+// newMetricsHandler creates a handler serving the metrics given along with the checks of all of the bots given.
+func newMetricsHandler(metrics http.Handler, bots []*Bot) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		ok := true
+		for _, b := range bots {
+			ok = ok && !b.closed()
+		}
+		check(w, ok)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ok := true
+		for _, b := range bots {
+			ok = ok && b.Ready()
+		}
+		check(w, ok)
+	})
+	return mux
+}
+
+// check writes the result of a health check.
+func check(w http.ResponseWriter, ok bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("unavailable\n"))
+		return
+	}
+	_, _ = w.Write([]byte("ok\n"))
+}
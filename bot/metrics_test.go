@@ -0,0 +1,81 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/dondish/lionplayer/metrics"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	b, s, voices := newTestBot()
+	defer b.Close()
+	registry := metrics.New()
+	b.Manager.Metrics = registry
+	server := httptest.NewServer(NewMetricsHandler(b, registry))
+	defer server.Close()
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		assert.Nil(t, err, "error is supposed to be nil")
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err, "error is supposed to be nil")
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "the bot should not be ready before SetReady")
+	b.SetReady(true)
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+
+	s.voice["u"] = "voice"
+	send(b, s, "u", "!!play a")
+	gp := b.Manager.Get("1")
+	for voices.get("1") == nil || voices.get("1").count() < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	send(b, s, "u", "!!seek 0:10")
+	_, body := get("/metrics")
+	assert.Contains(t, body, "\nlionplayer_active_players{shard=\"0\"} 1\n")
+	assert.Contains(t, body, "\nlionplayer_seeks_total 1\n")
+	assert.Regexp(t, "\nlionplayer_packets_sent_total [1-9][0-9]+\n", body)
+
+	assert.Nil(t, b.Close(), "error is supposed to be nil")
+	assert.Nil(t, b.Manager.Get(gp.GuildID()))
+	_, body = get("/metrics")
+	assert.Contains(t, body, "\nlionplayer_active_players{shard=\"0\"} 0\n", "the players should be counted out once removed")
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "the bot should be unhealthy once shut down")
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
@@ -0,0 +1,202 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultNowPlayingInterval is the default interval to update the now playing message in,
+// editing it more often risks hitting the rate limits of busy channels.
+const DefaultNowPlayingInterval = 15 * time.Second
+
+// nowPlayingColor is the color of the now playing embed.
+const nowPlayingColor = 0xF5A623
+
+// The emojis of the now playing controls.
+const (
+	playPauseEmoji = "⏯"
+	skipEmoji      = "⏭"
+	stopEmoji      = "⏹"
+	loopEmoji      = "🔁"
+	shuffleEmoji   = "🔀"
+)
+
+// controls are the emojis the now playing message is reacted with.
+var controls = []string{playPauseEmoji, skipEmoji, stopEmoji, loopEmoji, shuffleEmoji}
+
+// nowPlayingMessage is the message showing the current track of a guild, it is kept up to date until the track changes.
+type nowPlayingMessage struct {
+	channelID string
+	messageID string
+	track     *Track
+	stop      chan struct{}
+	once      sync.Once
+}
+
+// close stops updating the message.
+func (np *nowPlayingMessage) close() {
+	np.once.Do(func() {
+		close(np.stop)
+	})
+}
+
+// nowPlayingEmbed renders the track the player of a guild is playing.
+func nowPlayingEmbed(gp *GuildPlayer, track *Track) *Embed {
+	p := gp.Player()
+	position := p.Position()
+	state := "▶"
+	if p.Paused() {
+		state = "⏸"
+	}
+	author, requester := track.Info.Author, "Unknown"
+	if author == "" {
+		author = "Unknown"
+	}
+	if track.Requester != "" {
+		requester = "<@" + track.Requester + ">"
+	}
+	return &Embed{
+		Title:       track.Title(),
+		URL:         track.URL(),
+		Description: fmt.Sprintf("%s %s `%s/%s`", state, ProgressBar(position, track.Length(), 20), FormatDuration(position), FormatLength(track)),
+		Thumbnail:   track.Artwork(),
+		Color:       nowPlayingColor,
+		Fields: []EmbedField{
+			{Name: "Author", Value: author, Inline: true},
+			{Name: "Requested by", Value: requester, Inline: true},
+			{Name: "Loop", Value: string(gp.Loop()), Inline: true},
+			{Name: "Queue", Value: fmt.Sprintf("%d tracks", gp.Queue().Len()), Inline: true},
+		},
+	}
+}
+
+// showNowPlaying sends the now playing message of the track to the channel given and keeps it up to date.
+//
+// It replaces the previous now playing message of the guild, only the latest one has working controls.
+func (b *Bot) showNowPlaying(gp *GuildPlayer, channelID string, track *Track) error {
+	if gp.Current() != track {
+		return nil
+	}
+	messageID, err := b.session.SendEmbed(channelID, nowPlayingEmbed(gp, track))
+	if err != nil {
+		return err
+	}
+	np := &nowPlayingMessage{channelID: channelID, messageID: messageID, track: track, stop: make(chan struct{})}
+	b.npMu.Lock()
+	if old, ok := b.npMessages[gp.GuildID()]; ok {
+		old.close()
+	}
+	b.npMessages[gp.GuildID()] = np
+	b.npMu.Unlock()
+
+	// Reacting takes a request per emoji, the controls work as soon as each is added.
+	go func() {
+		for _, emoji := range controls {
+			if b.session.AddReaction(channelID, messageID, emoji) != nil {
+				return
+			}
+		}
+	}()
+	if b.NowPlayingInterval > 0 {
+		go b.updateNowPlaying(gp, np)
+	}
+	return nil
+}
+
+// updateNowPlaying edits the now playing message periodically until its track stops playing.
+func (b *Bot) updateNowPlaying(gp *GuildPlayer, np *nowPlayingMessage) {
+	ticker := time.NewTicker(b.NowPlayingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !b.refreshNowPlaying(gp, np) {
+				b.forgetNowPlaying(gp.GuildID(), np)
+				return
+			}
+		case <-np.stop:
+			return
+		}
+	}
+}
+
+// refreshNowPlaying edits the now playing message, returning false if its track is no longer playing.
+func (b *Bot) refreshNowPlaying(gp *GuildPlayer, np *nowPlayingMessage) bool {
+	if b.Manager.Get(gp.GuildID()) != gp || gp.Current() != np.track {
+		return false
+	}
+	_ = b.session.EditEmbed(np.channelID, np.messageID, nowPlayingEmbed(gp, np.track))
+	return true
+}
+
+// forgetNowPlaying stops updating the now playing message given, nil for whichever the guild has.
+func (b *Bot) forgetNowPlaying(guildID string, np *nowPlayingMessage) {
+	b.npMu.Lock()
+	defer b.npMu.Unlock()
+	if current, ok := b.npMessages[guildID]; ok && (np == nil || current == np) {
+		current.close()
+		delete(b.npMessages, guildID)
+	}
+}
+
+// control runs the command of the now playing control the user reacted with, returning whether it was one.
+//
+// The controls run as the text commands do, so the user must meet the same requirements.
+func (b *Bot) control(r Reaction) bool {
+	b.npMu.Lock()
+	np := b.npMessages[r.GuildID]
+	b.npMu.Unlock()
+	gp := b.Manager.Get(r.GuildID)
+	if np == nil || np.messageID != r.MessageID || gp == nil {
+		return false
+	}
+	var name, rest string
+	switch strings.TrimSuffix(r.Emoji, "\ufe0f") {
+	case playPauseEmoji:
+		name = "pause"
+		if gp.Player().Paused() {
+			name = "resume"
+		}
+	case skipEmoji:
+		name = "skip"
+	case stopEmoji:
+		name = "stop"
+	case loopEmoji:
+		name, rest = "loop", string(gp.Loop().Next())
+	case shuffleEmoji:
+		name = "shuffle"
+	default:
+		return false
+	}
+	// Removing the reaction lets the user press the control again.
+	_ = b.session.RemoveReaction(r.ChannelID, r.MessageID, r.Emoji, r.UserID)
+	b.Router.Execute(b.session, Message{GuildID: r.GuildID, ChannelID: r.ChannelID, AuthorID: r.UserID}, b.Router.Command(name), rest)
+	b.refreshNowPlaying(gp, np)
+	return true
+}
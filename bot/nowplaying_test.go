@@ -0,0 +1,85 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNowPlaying(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	b.NowPlayingInterval = 10 * time.Millisecond
+	s.voice["u"], s.voice["a"] = "voice", "voice"
+	react := func(user, emoji string) bool {
+		return b.HandleReaction(Reaction{GuildID: "1", ChannelID: "text", MessageID: "embed1", UserID: user, Emoji: emoji})
+	}
+
+	send(b, s, "u", "!!play a")
+	send(b, s, "u", "!!play b")
+	waitFor(t, "the now playing message should be sent", func() bool {
+		return s.embed(1) != nil
+	})
+	embed := s.embed(1)
+	assert.Equal(t, "a", embed.Title)
+	assert.Equal(t, EmbedField{Name: "Requested by", Value: "<@u>", Inline: true}, embed.Fields[1])
+	waitFor(t, "the controls should be added", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.reactions["embed1"]) == len(controls)
+	})
+	waitFor(t, "the now playing message should be updated", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.edits > 0
+	})
+
+	gp := b.Manager.Get("1")
+	assert.True(t, react("u", playPauseEmoji+"\ufe0f"), "the control should be handled")
+	assert.Equal(t, "Paused", s.last())
+	assert.True(t, gp.Player().Paused())
+	assert.True(t, strings.HasPrefix(s.embed(1).Description, "⏸"), "the message should show the player is paused")
+	assert.Equal(t, []string{"u:" + playPauseEmoji + "\ufe0f"}, s.removed, "the reaction should be removed to press it again")
+	react("u", playPauseEmoji)
+	assert.False(t, gp.Player().Paused())
+	react("u", loopEmoji)
+	assert.Equal(t, LoopTrack, gp.Loop())
+
+	assert.True(t, react("a", stopEmoji))
+	assert.Equal(t, ErrNotDJ.Error(), s.last(), "the controls should need the same permissions as the commands")
+	assert.False(t, b.HandleReaction(Reaction{GuildID: "1", ChannelID: "text", MessageID: "1", UserID: "u", Emoji: stopEmoji}),
+		"reactions to other messages should be ignored")
+
+	react("u", skipEmoji)
+	waitFor(t, "the next track should get its own message", func() bool {
+		return s.embed(2) != nil
+	})
+	assert.Equal(t, "b", s.embed(2).Title)
+	assert.False(t, react("u", stopEmoji), "the controls of an old message should stop working")
+	assert.Equal(t, "b", gp.Current().Title())
+}
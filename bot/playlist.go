@@ -0,0 +1,383 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/lavalink"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxPlaylistName is the maximum length of a playlist name.
+const MaxPlaylistName = 32
+
+// ErrPlaylistNotFound is returned when a playlist doesn't exist.
+var ErrPlaylistNotFound = errors.New("playlist not found")
+
+// PlaylistScope is who a playlist belongs to.
+type PlaylistScope string
+
+// The playlist scopes.
+const (
+	// UserPlaylist is a personal playlist the user can play in any guild.
+	UserPlaylist PlaylistScope = "user"
+	// GuildPlaylist is shared by the members of a guild.
+	GuildPlaylist PlaylistScope = "guild"
+)
+
+// Playlist is a saved list of tracks.
+type Playlist struct {
+	Name string `json:"name"`
+	// Tracks are the tracks encoded like Lavalink does, they are resolved again when the playlist is loaded.
+	Tracks []string `json:"tracks"`
+	// CreatedBy is the id of the user who created the playlist.
+	CreatedBy string    `json:"createdBy"`
+	Updated   time.Time `json:"updated"`
+}
+
+// PlaylistStore keeps the playlists in a bbolt database, a bucket per scope holds a bucket per owner.
+//
+// It is safe for concurrent use.
+type PlaylistStore struct {
+	db *bolt.DB
+}
+
+// OpenPlaylistStore opens the database at the path given, creating it if needed.
+//
+// The database can be opened by a single process at a time.
+func OpenPlaylistStore(path string) (*PlaylistStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("the playlist database %s is used by another process", path)
+	} else if err != nil {
+		return nil, err
+	}
+	return &PlaylistStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *PlaylistStore) Close() error {
+	return s.db.Close()
+}
+
+// playlistKey returns the key of a playlist, names are case insensitive.
+func playlistKey(name string) []byte {
+	return []byte(strings.ToLower(name))
+}
+
+// bucket returns the bucket of the owner given, nil if it has no playlists.
+func bucket(tx *bolt.Tx, scope PlaylistScope, owner string) *bolt.Bucket {
+	b := tx.Bucket([]byte(scope))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte(owner))
+}
+
+// Get returns a playlist of the owner given, ErrPlaylistNotFound if there is none by that name.
+func (s *PlaylistStore) Get(scope PlaylistScope, owner, name string) (Playlist, error) {
+	var p Playlist
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, scope, owner)
+		if b == nil {
+			return ErrPlaylistNotFound
+		}
+		data := b.Get(playlistKey(name))
+		if data == nil {
+			return ErrPlaylistNotFound
+		}
+		return json.Unmarshal(data, &p)
+	})
+	return p, err
+}
+
+// List returns the playlists of the owner given sorted by name.
+func (s *PlaylistStore) List(scope PlaylistScope, owner string) ([]Playlist, error) {
+	var playlists []Playlist
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := bucket(tx, scope, owner)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, data []byte) error {
+			var p Playlist
+			if err := json.Unmarshal(data, &p); err != nil {
+				return err
+			}
+			playlists = append(playlists, p)
+			return nil
+		})
+	})
+	sort.Slice(playlists, func(i, j int) bool {
+		return strings.ToLower(playlists[i].Name) < strings.ToLower(playlists[j].Name)
+	})
+	return playlists, err
+}
+
+// Save saves a playlist of the owner given, replacing the playlist with the same name.
+func (s *PlaylistStore) Save(scope PlaylistScope, owner string, p Playlist) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, scope, owner, p)
+	})
+}
+
+// Update changes a playlist of the owner given atomically, it is saved unless the function fails.
+func (s *PlaylistStore) Update(scope PlaylistScope, owner, name string, f func(*Playlist) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := bucket(tx, scope, owner)
+		if b == nil {
+			return ErrPlaylistNotFound
+		}
+		data := b.Get(playlistKey(name))
+		if data == nil {
+			return ErrPlaylistNotFound
+		}
+		var p Playlist
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		if err := f(&p); err != nil {
+			return err
+		}
+		return put(tx, scope, owner, p)
+	})
+}
+
+// put writes a playlist in the transaction given.
+func put(tx *bolt.Tx, scope PlaylistScope, owner string, p Playlist) error {
+	root, err := tx.CreateBucketIfNotExists([]byte(scope))
+	if err != nil {
+		return err
+	}
+	b, err := root.CreateBucketIfNotExists([]byte(owner))
+	if err != nil {
+		return err
+	}
+	p.Updated = time.Now()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return b.Put(playlistKey(p.Name), data)
+}
+
+// Delete deletes a playlist of the owner given, ErrPlaylistNotFound if there is none by that name.
+func (s *PlaylistStore) Delete(scope PlaylistScope, owner, name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := bucket(tx, scope, owner)
+		if b == nil || b.Get(playlistKey(name)) == nil {
+			return ErrPlaylistNotFound
+		}
+		return b.Delete(playlistKey(name))
+	})
+}
+
+// playlist runs the playlist subcommands, the playlists are the user's unless the name follows the word server.
+//
+// Everyone can load and list the playlists of the server, changing them takes the DJ role.
+func (b *Bot) playlist(ctx *Context) error {
+	if b.Playlists == nil {
+		return UserError("Playlists are disabled")
+	}
+	action := strings.ToLower(ctx.String(0))
+	args := strings.Fields(ctx.String(1))
+	scope, owner := UserPlaylist, ctx.AuthorID
+	if len(args) > 0 && strings.EqualFold(args[0], "server") {
+		scope, owner = GuildPlaylist, ctx.GuildID
+		args = args[1:]
+	}
+	if action == "list" {
+		return b.listPlaylists(ctx, scope, owner)
+	}
+	if len(args) == 0 {
+		return UserError(fmt.Sprintf("Usage: %splaylist <save|load|delete|add|remove> [server] <name>, or %splaylist list [server]", ctx.Prefix, ctx.Prefix))
+	}
+	name, rest := args[0], strings.Join(args[1:], " ")
+	if scope == GuildPlaylist && action != "load" && !b.hasDJRole(ctx) {
+		return ErrNotDJ
+	}
+	var err error
+	switch action {
+	case "save":
+		err = b.savePlaylist(ctx, scope, owner, name)
+	case "load":
+		err = b.loadPlaylist(ctx, scope, owner, name)
+	case "delete":
+		if err = b.Playlists.Delete(scope, owner, name); err == nil {
+			err = ctx.Reply("Deleted the playlist %s", name)
+		}
+	case "add":
+		err = b.addToPlaylist(ctx, scope, owner, name, rest)
+	case "remove":
+		err = b.removeFromPlaylist(ctx, scope, owner, name, rest)
+	default:
+		return UserError("Unknown action " + action + ", the actions are save, load, list, delete, add and remove")
+	}
+	if err == ErrPlaylistNotFound {
+		return UserError(fmt.Sprintf("There is no playlist named %s", name))
+	}
+	return err
+}
+
+// listPlaylists lists the playlists of the owner given.
+func (b *Bot) listPlaylists(ctx *Context, scope PlaylistScope, owner string) error {
+	playlists, err := b.Playlists.List(scope, owner)
+	if err != nil {
+		return err
+	}
+	whose := "Your"
+	if scope == GuildPlaylist {
+		whose = "The server's"
+	}
+	if len(playlists) == 0 {
+		return ctx.Reply("%s playlists are empty", whose)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s playlists:", whose)
+	for _, p := range playlists {
+		fmt.Fprintf(&sb, "\n%s - %d tracks", p.Name, len(p.Tracks))
+	}
+	return ctx.Reply("%s", sb.String())
+}
+
+// encodeTracks encodes the tracks to be saved in a playlist.
+func encodeTracks(tracks []*Track) ([]string, error) {
+	encoded := make([]string, len(tracks))
+	for i, track := range tracks {
+		var err error
+		if encoded[i], err = lavalink.EncodeTrack(track.Info); err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+// savePlaylist saves the current track and the queue as a playlist, replacing the playlist with the same name.
+func (b *Bot) savePlaylist(ctx *Context, scope PlaylistScope, owner, name string) error {
+	if len(name) > MaxPlaylistName {
+		return UserError(fmt.Sprintf("The name must be up to %d characters", MaxPlaylistName))
+	}
+	var tracks []*Track
+	if gp := ctx.Player; gp != nil {
+		if current := gp.Current(); current != nil {
+			tracks = append(tracks, current)
+		}
+		tracks = append(tracks, gp.Queue().Tracks()...)
+	}
+	if len(tracks) == 0 {
+		return UserError("There is nothing to save, the queue is empty")
+	}
+	encoded, err := encodeTracks(tracks)
+	if err != nil {
+		return err
+	}
+	if err := b.Playlists.Save(scope, owner, Playlist{Name: name, Tracks: encoded, CreatedBy: ctx.AuthorID}); err != nil {
+		return err
+	}
+	return ctx.Reply("Saved %d tracks to the playlist %s", len(tracks), name)
+}
+
+// loadPlaylist plays a playlist or adds it to the queue, its tracks are resolved again.
+func (b *Bot) loadPlaylist(ctx *Context, scope PlaylistScope, owner, name string) error {
+	if err := ctx.Require(RequireVoice); err != nil {
+		return err
+	}
+	resolver, ok := b.Loader.(Resolver)
+	if !ok {
+		return ErrNotResolvable
+	}
+	p, err := b.Playlists.Get(scope, owner, name)
+	if err != nil {
+		return err
+	}
+	var tracks []*Track
+	for _, encoded := range p.Tracks {
+		if track, err := resolveTrack(resolver, encoded); err == nil {
+			tracks = append(tracks, track)
+		}
+	}
+	if len(tracks) == 0 {
+		return UserError(fmt.Sprintf("None of the tracks of the playlist %s can be played", p.Name))
+	}
+	return b.enqueue(ctx, tracks)
+}
+
+// addToPlaylist adds the tracks matching the query to a playlist, or the current track if there is no query.
+func (b *Bot) addToPlaylist(ctx *Context, scope PlaylistScope, owner, name, query string) error {
+	var tracks []*Track
+	if query == "" {
+		if ctx.Player == nil || ctx.Player.Current() == nil {
+			return ErrNothingPlaying
+		}
+		tracks = []*Track{ctx.Player.Current()}
+	} else {
+		var err error
+		if tracks, err = b.Loader.Load(query); err != nil {
+			return err
+		}
+	}
+	encoded, err := encodeTracks(tracks)
+	if err != nil {
+		return err
+	}
+	err = b.Playlists.Update(scope, owner, name, func(p *Playlist) error {
+		p.Tracks = append(p.Tracks, encoded...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 1 {
+		return ctx.Reply("Added %s to the playlist %s", tracks[0].Title(), name)
+	}
+	return ctx.Reply("Added %d tracks to the playlist %s", len(tracks), name)
+}
+
+// removeFromPlaylist removes the track at the index given from a playlist.
+func (b *Bot) removeFromPlaylist(ctx *Context, scope PlaylistScope, owner, name, index string) error {
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return UserError(fmt.Sprintf("Usage: %splaylist remove [server] <name> <index>", ctx.Prefix))
+	}
+	var removed lavalink.TrackInfo
+	err = b.Playlists.Update(scope, owner, name, func(p *Playlist) error {
+		if i < 1 || i > len(p.Tracks) {
+			return UserError(fmt.Sprintf("There is no track at index %d of the playlist %s", i, name))
+		}
+		removed, _ = lavalink.DecodeTrack(p.Tracks[i-1])
+		p.Tracks = append(p.Tracks[:i-1], p.Tracks[i:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Reply("Removed %s from the playlist %s", removed.Title, name)
+}
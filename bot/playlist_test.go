@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlaylists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playlists")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile, config.StateFile = "", ""
+	config.PlaylistFile = filepath.Join(dir, "playlists.db")
+	s := newFakeSession()
+	b, err := New(config, s, (&fakeVoices{}).join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	s.voice["u"], s.voice["a"] = "voice", "voice"
+
+	send(b, s, "u", "!!play a")
+	send(b, s, "u", "!!play b")
+	assert.Equal(t, "Saved 2 tracks to the playlist Mix", send(b, s, "u", "!!playlist save Mix"))
+	assert.Equal(t, "Added c to the playlist mix", send(b, s, "u", "!!playlist add mix c"))
+	assert.Equal(t, "Removed a from the playlist mix", send(b, s, "u", "!!pl remove mix 1"))
+	assert.Equal(t, "There is no track at index 3 of the playlist mix", send(b, s, "u", "!!pl remove mix 3"))
+	assert.Equal(t, "There is no playlist named nope", send(b, s, "u", "!!pl add nope"))
+	assert.Equal(t, "The server's playlists are empty", send(b, s, "a", "!!pl list server"))
+	assert.Equal(t, ErrNotDJ.Error(), send(b, s, "u", "!!pl save server mix"), "changing the server's playlists takes the DJ role")
+	assert.Nil(t, b.Close(), "error is supposed to be nil")
+
+	voices := &fakeVoices{}
+	b, err = New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer b.Close()
+	assert.Equal(t, "Your playlists:\nMix - 2 tracks", send(b, s, "u", "!!pl list"), "the playlists should survive restarts")
+	assert.Equal(t, "Your playlists are empty", send(b, s, "a", "!!pl list"), "the playlists should be personal")
+	assert.Equal(t, "Queued 2 tracks", send(b, s, "u", "!!pl load mix"))
+	gp := b.Manager.Get("1")
+	assert.Equal(t, "b", gp.Current().Title())
+	assert.Equal(t, []string{"c"}, titles(gp.Queue().Tracks()))
+
+	s.permissions["a"] = discordgo.PermissionManageServer
+	assert.Equal(t, "Saved 2 tracks to the playlist party", send(b, s, "a", "!!pl save server party"))
+	assert.Equal(t, "The server's playlists:\nparty - 2 tracks", send(b, s, "u", "!!pl list server"))
+	assert.Equal(t, "Deleted the playlist mix", send(b, s, "u", "!!pl delete mix"))
+	assert.Equal(t, "There is no playlist named mix", send(b, s, "u", "!!pl delete mix"))
+}
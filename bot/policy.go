@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PolicyError is returned when enqueuing a track the settings of the guild don't allow, it tells the user why.
+type PolicyError string
+
+func (e PolicyError) Error() string {
+	return string(e)
+}
+
+// Check returns a PolicyError if the settings don't allow queueing the track given after the current track and the queue.
+func (s Settings) Check(track, current *Track, queue []*Track) error {
+	if track.Info.IsStream && s.BlockStreams {
+		return PolicyError("Streams are not allowed")
+	}
+	if max := s.MaxTrackLength; max > 0 && !track.Info.IsStream && track.Length() > time.Duration(max) {
+		return PolicyError(fmt.Sprintf("Tracks can be up to %s long", FormatDuration(time.Duration(max))))
+	}
+	if term := s.blocked(track); term != "" {
+		return PolicyError(fmt.Sprintf("The track matches the blocked term %s", term))
+	}
+	if s.NoDuplicates {
+		key := trackKey(track)
+		if current != nil && trackKey(current) == key {
+			return PolicyError("The track is already playing")
+		}
+		for _, t := range queue {
+			if trackKey(t) == key {
+				return PolicyError("The track is already in the queue")
+			}
+		}
+	}
+	if max := s.MaxUserTracks; max > 0 && track.Requester != "" {
+		n := 0
+		for _, t := range queue {
+			if t.Requester == track.Requester {
+				n++
+			}
+		}
+		if n >= max {
+			return PolicyError(fmt.Sprintf("You can have up to %d tracks in the queue", max))
+		}
+	}
+	return nil
+}
+
+// blocked returns the term in the blocklist the track matches, empty if none.
+//
+// A term matches the identifier or url of a track exactly, or a part of its title or author.
+func (s Settings) blocked(track *Track) string {
+	title, author := strings.ToLower(track.Title()), strings.ToLower(track.Info.Author)
+	for _, term := range s.Blocklist {
+		if term == track.Info.Identifier || term == track.URL() {
+			return term
+		}
+		if lower := strings.ToLower(term); strings.Contains(title, lower) || strings.Contains(author, lower) {
+			return term
+		}
+	}
+	return ""
+}
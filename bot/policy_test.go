@@ -0,0 +1,71 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPolicies(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	s.voice["u"], s.voice["a"] = "voice", "voice"
+	s.permissions["u"] = discordgo.PermissionManageServer
+
+	assert.Equal(t, "Changed maxlength to 10s", send(b, s, "u", "!!settings maxlength 10s"))
+	assert.Equal(t, "Changed userlimit to 2", send(b, s, "u", "!!settings userlimit 2"))
+	assert.Equal(t, "Changed duplicates to off", send(b, s, "u", "!!settings duplicates off"))
+	assert.Equal(t, "Blocked Rick", send(b, s, "u", "!!settings blocklist add Rick"))
+	assert.Equal(t, "rick is already blocked", send(b, s, "u", "!!settings blocklist add rick"))
+	assert.Contains(t, send(b, s, "u", "!!settings"), "maxlength: 10s\nstreams: on\nuserlimit: 2\nduplicates: off\nblocklist: Rick")
+
+	assert.Equal(t, "Tracks can be up to 0:10 long", send(b, s, "a", "!!play a"), "the fake tracks are 20 seconds long")
+	assert.Equal(t, "Changed maxlength to 0s", send(b, s, "u", "!!settings maxlength 0s"))
+	send(b, s, "a", "!!play a")
+	assert.Equal(t, "The track is already playing", send(b, s, "a", "!!play a"))
+	assert.Equal(t, "Queued - b -  [#1]", send(b, s, "a", "!!play b"))
+	assert.Equal(t, "The track is already in the queue", send(b, s, "u", "!!play b"))
+	assert.Equal(t, "The track matches the blocked term Rick", send(b, s, "a", "!!play never gonna give you up by rick astley"))
+	send(b, s, "a", "!!play c")
+	assert.Equal(t, "You can have up to 2 tracks in the queue", send(b, s, "a", "!!play d"))
+	assert.Equal(t, "Queued - d -  [#3]", send(b, s, "u", "!!play d"), "the limit is per user")
+
+	assert.Equal(t, "Unblocked rick", send(b, s, "u", "!!settings blocklist remove rick"))
+	assert.Equal(t, "24/7 mode can be on or off", send(b, s, "u", "!!settings 247 maybe"))
+
+	assert.Equal(t, "Changed fair to on", send(b, s, "u", "!!settings fair on"))
+	assert.Equal(t, "Queued - e -  [#3]", send(b, s, "u", "!!play e"), "a is playing so u goes first")
+	assert.Contains(t, send(b, s, "u", "!!queue"), "1. d [0:20] - <@u>\n2. b [0:20] - <@a>\n3. e [0:20] - <@u>\n4. c [0:20] - <@a>")
+
+	stream := newTrack("radio", 1)
+	stream.Info.IsStream = true
+	settings := Settings{MaxTrackLength: Duration(time.Second)}
+	assert.Nil(t, settings.Check(stream, nil, nil), "streams have no length to limit")
+	settings.BlockStreams = true
+	assert.Equal(t, PolicyError("Streams are not allowed"), settings.Check(stream, nil, nil))
+}
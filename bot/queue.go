@@ -0,0 +1,203 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// ErrOutOfRange is returned when referring to a position outside of the queue.
+var ErrOutOfRange = errors.New("no track at that position")
+
+// Queue is a synchronized queue of the tracks waiting to be played.
+type Queue struct {
+	mu     sync.Mutex
+	tracks []*Track
+}
+
+// Push adds a track to the end of the queue and returns its position, starting at 1.
+func (q *Queue) Push(track *Track) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = append(q.tracks, track)
+	return len(q.tracks)
+}
+
+// PushFair adds a track to the queue so the requesters take turns and returns its position, starting at 1.
+//
+// The round of a track is how many tracks of its requester play up to and including it, counting the
+// current track. The track goes after the tracks of the rounds up to its own, which keeps the order of
+// the tracks of each requester and leaves the rest of the queue as it is.
+func (q *Queue) PushFair(track, current *Track) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rounds, counts := rounds(q.tracks, current)
+	round := counts[track.Requester] + 1
+	position := 0
+	for i, r := range rounds {
+		if r <= round {
+			position = i + 1
+		}
+	}
+	q.tracks = append(q.tracks, nil)
+	copy(q.tracks[position+1:], q.tracks[position:])
+	q.tracks[position] = track
+	return position + 1
+}
+
+// Interleave reorders the queue so the requesters take turns, keeping the order of the tracks of each.
+func (q *Queue) Interleave(current *Track) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rounds, _ := rounds(q.tracks, current)
+	order := make([]int, len(q.tracks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rounds[order[i]] < rounds[order[j]]
+	})
+	tracks := make([]*Track, len(q.tracks))
+	for i, j := range order {
+		tracks[i] = q.tracks[j]
+	}
+	q.tracks = tracks
+}
+
+// rounds returns the round of each of the tracks and the amount of tracks of each requester, see PushFair.
+func rounds(tracks []*Track, current *Track) ([]int, map[string]int) {
+	counts := make(map[string]int)
+	if current != nil {
+		counts[current.Requester]++
+	}
+	rounds := make([]int, len(tracks))
+	for i, track := range tracks {
+		counts[track.Requester]++
+		rounds[i] = counts[track.Requester]
+	}
+	return rounds, counts
+}
+
+// Insert inserts a track at the position given, starting at 1, and returns its position.
+//
+// Positions past the end of the queue add the track to its end.
+func (q *Queue) Insert(position int, track *Track) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if position < 1 {
+		position = 1
+	} else if position > len(q.tracks) {
+		position = len(q.tracks) + 1
+	}
+	q.tracks = append(q.tracks, nil)
+	copy(q.tracks[position:], q.tracks[position-1:])
+	q.tracks[position-1] = track
+	return position
+}
+
+// Pop removes and returns the first track in the queue, nil if the queue is empty.
+func (q *Queue) Pop() *Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tracks) == 0 {
+		return nil
+	}
+	track := q.tracks[0]
+	q.tracks[0] = nil
+	q.tracks = q.tracks[1:]
+	return track
+}
+
+// Len returns the amount of tracks in the queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tracks)
+}
+
+// Tracks returns a copy of the tracks in the queue.
+func (q *Queue) Tracks() []*Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*Track(nil), q.tracks...)
+}
+
+// Clear removes all of the tracks from the queue.
+func (q *Queue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = nil
+}
+
+// Remove removes and returns the track at the position given, starting at 1.
+func (q *Queue) Remove(position int) (*Track, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if position < 1 || position > len(q.tracks) {
+		return nil, ErrOutOfRange
+	}
+	track := q.tracks[position-1]
+	q.tracks = append(q.tracks[:position-1], q.tracks[position:]...)
+	return track, nil
+}
+
+// Move moves the track at the position from to the position to, both starting at 1.
+func (q *Queue) Move(from, to int) (*Track, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if from < 1 || from > len(q.tracks) || to < 1 || to > len(q.tracks) {
+		return nil, ErrOutOfRange
+	}
+	track := q.tracks[from-1]
+	q.tracks = append(q.tracks[:from-1], q.tracks[from:]...)
+	q.tracks = append(q.tracks[:to-1], append([]*Track{track}, q.tracks[to-1:]...)...)
+	return track, nil
+}
+
+// Drop removes the first n tracks of the queue and returns them.
+func (q *Queue) Drop(n int) []*Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if n > len(q.tracks) {
+		n = len(q.tracks)
+	} else if n < 0 {
+		n = 0
+	}
+	dropped := append([]*Track(nil), q.tracks[:n]...)
+	q.tracks = q.tracks[n:]
+	return dropped
+}
+
+// Shuffle shuffles the queue.
+func (q *Queue) Shuffle() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rand.Shuffle(len(q.tracks), func(i, j int) {
+		q.tracks[i], q.tracks[j] = q.tracks[j], q.tracks[i]
+	})
+}
@@ -0,0 +1,101 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// titles returns the titles of the tracks given.
+func titles(tracks []*Track) (titles []string) {
+	for _, track := range tracks {
+		titles = append(titles, track.Title())
+	}
+	return titles
+}
+
+func TestQueue(t *testing.T) {
+	var q Queue
+	for _, title := range []string{"a", "b", "c", "d"} {
+		q.Push(newTrack(title, 1))
+	}
+	track, err := q.Move(1, 3)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "a", track.Title())
+	assert.Equal(t, []string{"b", "c", "a", "d"}, titles(q.Tracks()))
+	_, _ = q.Move(4, 1)
+	assert.Equal(t, []string{"d", "b", "c", "a"}, titles(q.Tracks()))
+	track, _ = q.Remove(2)
+	assert.Equal(t, "b", track.Title())
+	_, err = q.Remove(4)
+	assert.Equal(t, ErrOutOfRange, err)
+	_, err = q.Move(0, 1)
+	assert.Equal(t, ErrOutOfRange, err)
+	assert.Len(t, q.Drop(2), 2)
+	assert.Equal(t, []string{"a"}, titles(q.Tracks()))
+	assert.Equal(t, 1, q.Insert(0, newTrack("e", 1)))
+	assert.Equal(t, 3, q.Insert(9, newTrack("f", 1)))
+	assert.Equal(t, 2, q.Insert(2, newTrack("g", 1)))
+	assert.Equal(t, []string{"e", "g", "a", "f"}, titles(q.Tracks()))
+
+	page, pages := QueuePage(nil, 1)
+	assert.Equal(t, 0, pages)
+	assert.Equal(t, "The queue is empty", page)
+	for i := 0; i < 15; i++ {
+		q.Push(newTrack("t", 1))
+	}
+	page, pages = QueuePage(q.Tracks(), 2)
+	assert.Equal(t, 2, pages)
+	assert.Contains(t, page, "page 2/2")
+	assert.Contains(t, page, "16. t")
+	assert.Equal(t, "1:02:03", FormatDuration(time.Hour+2*time.Minute+3*time.Second))
+}
+
+func TestQueue_Fair(t *testing.T) {
+	var q Queue
+	request := func(title, requester string) *Track {
+		track := newTrack(title, 1)
+		track.Requester = requester
+		return track
+	}
+	current := request("a0", "a")
+	for _, title := range []string{"a1", "a2", "a3"} {
+		q.Push(request(title, "a"))
+	}
+	assert.Equal(t, 1, q.PushFair(request("b1", "b"), current), "b should play before the next track of a")
+	assert.Equal(t, 3, q.PushFair(request("b2", "b"), current))
+	assert.Equal(t, 2, q.PushFair(request("c1", "c"), current))
+	assert.Equal(t, 7, q.PushFair(request("a4", "a"), current))
+	assert.Equal(t, []string{"b1", "c1", "a1", "b2", "a2", "a3", "a4"}, titles(q.Tracks()))
+
+	q.Clear()
+	for _, title := range []string{"a1", "a2", "a3", "b1", "b2", "c1"} {
+		q.Push(request(title, title[:1]))
+	}
+	q.Interleave(nil)
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2", "b2", "a3"}, titles(q.Tracks()))
+}
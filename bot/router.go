@@ -0,0 +1,527 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session is the part of a Discord session the commands use.
+type Session interface {
+	// SendMessage sends a message to a text channel and returns its id.
+	SendMessage(channelID, content string) (string, error)
+	// SendEmbed sends an embed to a text channel and returns the id of its message.
+	SendEmbed(channelID string, embed *Embed) (string, error)
+	// EditEmbed replaces the embed of a message the bot sent.
+	EditEmbed(channelID, messageID string, embed *Embed) error
+	// AddReaction reacts to a message with the emoji given.
+	AddReaction(channelID, messageID, emoji string) error
+	// RemoveReaction removes the reaction of a user from a message.
+	RemoveReaction(channelID, messageID, emoji, userID string) error
+	// UserVoiceChannel returns the voice channel the user is in, empty if none.
+	UserVoiceChannel(guildID, userID string) string
+	// UserPermissions returns the permissions the user has in the channel given.
+	UserPermissions(userID, channelID string) (int, error)
+	// MemberRoles returns the ids of the roles the user has in the guild.
+	MemberRoles(guildID, userID string) ([]string, error)
+	// VoiceListeners returns the ids of the users in the voice channel given, not including bots.
+	VoiceListeners(guildID, channelID string) []string
+}
+
+// Message is a message that may contain a command.
+type Message struct {
+	GuildID   string
+	ChannelID string
+	AuthorID  string
+	Content   string
+}
+
+// Embed is a message with rich content.
+type Embed struct {
+	Title       string
+	URL         string
+	Description string
+	// Thumbnail is the url of the image shown next to the content.
+	Thumbnail string
+	Color     int
+	Fields    []EmbedField
+}
+
+// EmbedField is a named value shown in an embed.
+type EmbedField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// ArgType is the type of a command argument.
+type ArgType int
+
+// The argument types.
+const (
+	// ArgString is a single word.
+	ArgString ArgType = iota
+	// ArgInt is an integer.
+	ArgInt
+	// ArgDuration is a duration like 1h2m3s or 1:02:03.
+	ArgDuration
+	// ArgURL is an http or https url.
+	ArgURL
+	// ArgRest is the rest of the line, it must be the last argument.
+	ArgRest
+)
+
+// Arg describes an argument of a command.
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+}
+
+// Requirement is a precondition checked before running a command.
+type Requirement int
+
+// The requirements, they can be combined.
+const (
+	// RequireVoice requires the user to be in a voice channel, the bot's channel if it is playing.
+	RequireVoice Requirement = 1 << iota
+	// RequireSameVoice requires the bot to be connected to the voice channel the user is in.
+	RequireSameVoice
+	// RequirePlaying requires a track to be playing.
+	RequirePlaying
+	// RequireDJ requires the user to have full control of the player, see Router.DJ.
+	RequireDJ
+)
+
+// Command is a command users can run by sending a message.
+type Command struct {
+	// Name is the name used to run the command.
+	Name string
+	// Aliases are other names the command can be run with.
+	Aliases []string
+	// Description is shown in the help.
+	Description string
+	// Args are the arguments of the command.
+	Args []Arg
+	// Permissions are the permissions the user needs in the channel to run the command.
+	Permissions int
+	// Requires are the preconditions of the command.
+	Requires Requirement
+	// Run runs the command, the error is reported to the user.
+	Run func(*Context) error
+}
+
+// Usage returns how the command is used.
+func (c *Command) Usage(prefix string) string {
+	var sb strings.Builder
+	sb.WriteString(prefix + c.Name)
+	for _, arg := range c.Args {
+		if arg.Optional {
+			fmt.Fprintf(&sb, " [%s]", arg.Name)
+		} else {
+			fmt.Fprintf(&sb, " <%s>", arg.Name)
+		}
+	}
+	return sb.String()
+}
+
+// Context is passed to the commands when they run.
+type Context struct {
+	Message
+	Session Session
+	Command *Command
+	Router  *Router
+	// Prefix is the prefix of the commands in the guild.
+	Prefix string
+	// Player is the player of the guild, it is never nil when the command requires voice or playing.
+	Player *GuildPlayer
+	// VoiceChannel is the voice channel the user is in, empty if none.
+	VoiceChannel string
+	args         []interface{}
+}
+
+// Reply sends a formatted message to the channel the command was sent in.
+func (ctx *Context) Reply(format string, a ...interface{}) error {
+	_, err := ctx.Session.SendMessage(ctx.ChannelID, fmt.Sprintf(format, a...))
+	return err
+}
+
+// RequirePermissions returns ErrMissingPermission unless the user has the permissions given in the channel.
+func (ctx *Context) RequirePermissions(permissions int) error {
+	if permissions == 0 {
+		return nil
+	}
+	perms, err := ctx.Session.UserPermissions(ctx.AuthorID, ctx.ChannelID)
+	if err != nil {
+		return err
+	}
+	if perms&permissions != permissions {
+		return ErrMissingPermission
+	}
+	return nil
+}
+
+// Require checks requirements the command doesn't always have, like those of one of its subcommands.
+//
+// Like the requirements checked before running, it sets the player and the voice channel of the context.
+func (ctx *Context) Require(req Requirement) error {
+	command := *ctx.Command
+	command.Requires |= req
+	original := ctx.Command
+	ctx.Command = &command
+	defer func() {
+		ctx.Command = original
+	}()
+	return ctx.Router.check(ctx)
+}
+
+// Has returns whether the argument at the index given was given.
+func (ctx *Context) Has(i int) bool {
+	return i < len(ctx.args) && ctx.args[i] != nil
+}
+
+// String returns the argument at the index given as a string, it works for ArgString, ArgURL and ArgRest.
+func (ctx *Context) String(i int) string {
+	s, _ := ctx.arg(i).(string)
+	return s
+}
+
+// Int returns the ArgInt at the index given.
+func (ctx *Context) Int(i int) int {
+	n, _ := ctx.arg(i).(int)
+	return n
+}
+
+// Duration returns the ArgDuration at the index given.
+func (ctx *Context) Duration(i int) time.Duration {
+	d, _ := ctx.arg(i).(time.Duration)
+	return d
+}
+
+func (ctx *Context) arg(i int) interface{} {
+	if i >= len(ctx.args) {
+		return nil
+	}
+	return ctx.args[i]
+}
+
+// UserError is an error whose message is meant to be shown to the user as is.
+type UserError string
+
+func (e UserError) Error() string {
+	return string(e)
+}
+
+// The errors reported when a requirement is not met.
+var (
+	ErrNotInVoice        = UserError("Please join a voice channel first")
+	ErrOtherVoice        = UserError("I'm playing in another voice channel")
+	ErrNotSameVoice      = UserError("You must be in my voice channel to do that")
+	ErrNothingPlaying    = UserError("Not playing anything")
+	ErrMissingPermission = UserError("You don't have permission to do that")
+	ErrNotDJ             = UserError("Only DJs, admins and the requester of the track can do that")
+)
+
+// ErrDuplicateCommand is returned when registering a name or an alias twice.
+var ErrDuplicateCommand = errors.New("command already registered")
+
+// Router dispatches messages to the commands they run.
+type Router struct {
+	// Prefix is the prefix of the commands.
+	Prefix string
+	// GuildPrefix returns the prefix of the commands in a guild, if nil Prefix is used in all guilds.
+	GuildPrefix func(guildID string) string
+	// DJ returns whether the user has full control of the player, if nil everyone does.
+	DJ func(ctx *Context) bool
+	// Manager provides the guild players the requirements are checked against.
+	Manager *GuildPlayerManager
+
+	commands []*Command
+	names    map[string]*Command
+}
+
+// NewRouter creates a router with the prefix given, it comes with a help command.
+func NewRouter(prefix string, manager *GuildPlayerManager) *Router {
+	r := &Router{Prefix: prefix, Manager: manager, names: make(map[string]*Command)}
+	_ = r.Register(&Command{
+		Name:        "help",
+		Description: "Shows the commands or how to use a command",
+		Args:        []Arg{{Name: "command", Type: ArgString, Optional: true}},
+		Run:         r.help,
+	})
+	return r
+}
+
+// Register adds commands to the router.
+func (r *Router) Register(commands ...*Command) error {
+	for _, c := range commands {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			if _, ok := r.names[name]; ok {
+				return ErrDuplicateCommand
+			}
+		}
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			r.names[name] = c
+		}
+		r.commands = append(r.commands, c)
+	}
+	return nil
+}
+
+// Command returns the command with the name or alias given, nil if none.
+func (r *Router) Command(name string) *Command {
+	return r.names[strings.ToLower(name)]
+}
+
+// Commands returns the registered commands sorted by name.
+func (r *Router) Commands() []*Command {
+	commands := append([]*Command(nil), r.commands...)
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// Handle runs the command in the message given, returning whether it contained one.
+func (r *Router) Handle(s Session, m Message) bool {
+	prefix := r.prefix(m.GuildID)
+	if !strings.HasPrefix(m.Content, prefix) {
+		return false
+	}
+	name, rest := nextWord(m.Content[len(prefix):])
+	c := r.Command(name)
+	if c == nil {
+		return false
+	}
+	r.Execute(s, m, c, rest)
+	return true
+}
+
+// Execute runs the command given with the arguments in rest as if the message ran it.
+//
+// It is used to run commands on behalf of users who didn't type them, like when picking a search result.
+func (r *Router) Execute(s Session, m Message, c *Command, rest string) {
+	if err := r.Run(s, m, c, rest); err != nil {
+		if ue, ok := err.(UserError); ok {
+			_, _ = s.SendMessage(m.ChannelID, string(ue))
+		} else {
+			_, _ = s.SendMessage(m.ChannelID, fmt.Sprintf("Error: %s", err))
+		}
+	}
+}
+
+// Run runs the command given like Execute does, but returns the error instead of replying with it.
+func (r *Router) Run(s Session, m Message, c *Command, rest string) error {
+	ctx := &Context{Message: m, Session: s, Command: c, Router: r, Prefix: r.prefix(m.GuildID)}
+	return r.run(ctx, rest)
+}
+
+// run checks the requirements, parses the arguments and runs the command.
+func (r *Router) run(ctx *Context, rest string) error {
+	c := ctx.Command
+	if err := ctx.RequirePermissions(c.Permissions); err != nil {
+		return err
+	}
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	args, err := parseArgs(c.Args, rest)
+	if err != nil {
+		return UserError(fmt.Sprintf("%s\nUsage: %s", err, c.Usage(ctx.Prefix)))
+	}
+	ctx.args = args
+	return c.Run(ctx)
+}
+
+// prefix returns the prefix of the commands in the guild given.
+func (r *Router) prefix(guildID string) string {
+	if r.GuildPrefix != nil {
+		if prefix := r.GuildPrefix(guildID); prefix != "" {
+			return prefix
+		}
+	}
+	return r.Prefix
+}
+
+// check checks the requirements of the command.
+func (r *Router) check(ctx *Context) error {
+	var gp *GuildPlayer
+	if r.Manager != nil {
+		gp = r.Manager.Get(ctx.GuildID)
+	}
+	ctx.Player = gp
+	req := ctx.Command.Requires
+	if req&(RequireVoice|RequireSameVoice) != 0 {
+		ctx.VoiceChannel = ctx.Session.UserVoiceChannel(ctx.GuildID, ctx.AuthorID)
+		if ctx.VoiceChannel == "" {
+			return ErrNotInVoice
+		}
+		botChannel := ""
+		if gp != nil {
+			botChannel = gp.VoiceChannel()
+		}
+		if req&RequireSameVoice != 0 && botChannel != ctx.VoiceChannel {
+			return ErrNotSameVoice
+		}
+		if botChannel != "" && botChannel != ctx.VoiceChannel && gp.Current() != nil {
+			return ErrOtherVoice
+		}
+	}
+	if req&RequirePlaying != 0 && (gp == nil || gp.Current() == nil) {
+		return ErrNothingPlaying
+	}
+	if req&RequireDJ != 0 && r.DJ != nil && !r.DJ(ctx) {
+		return ErrNotDJ
+	}
+	return nil
+}
+
+// help lists the commands or describes a single command.
+func (r *Router) help(ctx *Context) error {
+	if ctx.Has(0) {
+		c := r.Command(ctx.String(0))
+		if c == nil {
+			return UserError("Unknown command " + ctx.String(0))
+		}
+		text := fmt.Sprintf("%s\n%s", c.Usage(ctx.Prefix), c.Description)
+		if len(c.Aliases) > 0 {
+			text += "\nAliases: " + strings.Join(c.Aliases, ", ")
+		}
+		return ctx.Reply("%s", text)
+	}
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, c := range r.Commands() {
+		fmt.Fprintf(&sb, "%s - %s\n", c.Usage(ctx.Prefix), c.Description)
+	}
+	return ctx.Reply("%s", sb.String())
+}
+
+// nextWord splits the first word off the text given.
+func nextWord(text string) (string, string) {
+	text = strings.TrimLeft(text, " \t\n")
+	i := strings.IndexAny(text, " \t\n")
+	if i < 0 {
+		return text, ""
+	}
+	return text[:i], text[i+1:]
+}
+
+// parseArgs parses the arguments of a command.
+func parseArgs(specs []Arg, rest string) ([]interface{}, error) {
+	args := make([]interface{}, len(specs))
+	for i, spec := range specs {
+		var word string
+		if spec.Type == ArgRest {
+			word, rest = strings.TrimSpace(rest), ""
+		} else {
+			word, rest = nextWord(rest)
+		}
+		if word == "" {
+			if spec.Optional {
+				continue
+			}
+			return nil, UserError(fmt.Sprintf("Missing %s", spec.Name))
+		}
+		value, err := parseArg(spec, word)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, UserError("Too many arguments")
+	}
+	return args, nil
+}
+
+// parseArg parses a single argument.
+func parseArg(spec Arg, word string) (interface{}, error) {
+	switch spec.Type {
+	case ArgInt:
+		n, err := strconv.Atoi(word)
+		if err != nil {
+			return nil, UserError(fmt.Sprintf("%s must be a number", spec.Name))
+		}
+		return n, nil
+	case ArgDuration:
+		d, err := ParseDuration(word)
+		if err != nil {
+			return nil, UserError(fmt.Sprintf("%s must be a duration like 1:30 or 1m30s", spec.Name))
+		}
+		return d, nil
+	case ArgURL:
+		u, err := url.Parse(word)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, UserError(fmt.Sprintf("%s must be a link", spec.Name))
+		}
+		return word, nil
+	}
+	return word, nil
+}
+
+// durationPattern matches durations like 1h2m3s, each part is optional.
+var durationPattern = regexp.MustCompile("^(?:([0-9]{1,2})h)?(?:([0-9]{1,3})m)?(?:([0-9]{1,5})s)?$")
+
+// timestampPattern matches timestamps like 1:30 or 1:02:03, and plain seconds like 90.
+var timestampPattern = regexp.MustCompile("^(?:(?:([0-9]{1,2}):)?([0-9]{1,3}):)?([0-9]{1,5})$")
+
+// ErrInvalidDuration is returned when parsing an invalid duration.
+var ErrInvalidDuration = errors.New("invalid duration")
+
+// ParseDuration parses a duration like 1h2m3s, a timestamp like 1:30 or 1:02:03, or plain seconds like 90.
+//
+// The minutes and seconds of a timestamp must be two digits after a colon, so 1:5 is invalid.
+func ParseDuration(s string) (time.Duration, error) {
+	matches := timestampPattern.FindStringSubmatch(s)
+	if matches != nil {
+		for i := 2; i <= 3; i++ {
+			n, _ := strconv.Atoi(matches[i])
+			if matches[i-1] != "" && (len(matches[i]) != 2 || n >= 60) {
+				return 0, ErrInvalidDuration
+			}
+		}
+	} else {
+		matches = durationPattern.FindStringSubmatch(s)
+	}
+	if s == "" || matches == nil {
+		return 0, ErrInvalidDuration
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if matches[i+1] != "" {
+			n, _ := strconv.Atoi(matches[i+1])
+			d += time.Duration(n) * unit
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	specs := []Arg{{Name: "n", Type: ArgInt}, {Name: "at", Type: ArgDuration}, {Name: "url", Type: ArgURL}, {Name: "rest", Type: ArgRest, Optional: true}}
+	args, err := parseArgs(specs, " 3  1m30s https://example.com/a  the rest  of it ")
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, []interface{}{3, 90 * time.Second, "https://example.com/a", "the rest  of it"}, args)
+
+	args, err = parseArgs(specs, "3 1h https://example.com")
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Nil(t, args[3], "a missing optional argument should be nil")
+
+	for _, bad := range []string{"x 1m https://a.b", "3 soon https://a.b", "3 1m ftp://a.b", "3 1m"} {
+		_, err = parseArgs(specs, bad)
+		assert.NotNil(t, err, bad+" should not parse")
+	}
+	_, err = parseArgs([]Arg{{Name: "n", Type: ArgInt}}, "1 2")
+	assert.NotNil(t, err, "extra arguments should be rejected")
+}
+
+func TestRouter(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", Content: "hello"}), "messages without the prefix should be ignored")
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", Content: "!!nosuchcommand"}))
+
+	assert.Contains(t, send(b, s, "u", "!!help"), "!!play <url|query> - Plays a track")
+	assert.Contains(t, send(b, s, "u", "!!help np"), "Aliases: np")
+	assert.Equal(t, "Unknown command nope", send(b, s, "u", "!!help nope"))
+
+	assert.Equal(t, ErrNotInVoice.Error(), send(b, s, "u", "!!play https://example.com/a"))
+	s.voice["u"] = "voice"
+	assert.Equal(t, "Missing url|query\nUsage: !!play <url|query>", send(b, s, "u", "!!play"))
+	assert.Equal(t, ErrNothingPlaying.Error(), send(b, s, "u", "!!np"))
+
+	b.Router.Register(&Command{Name: "admin", Permissions: discordgo.PermissionManageServer, Run: func(ctx *Context) error {
+		return ctx.Reply("done")
+	}})
+	assert.Equal(t, ErrMissingPermission.Error(), send(b, s, "u", "!!admin"))
+	s.permissions["u"] = discordgo.PermissionManageServer
+	assert.Equal(t, "done", send(b, s, "u", "!!admin"))
+	assert.Equal(t, ErrDuplicateCommand, b.Router.Register(&Command{Name: "q"}))
+}
@@ -0,0 +1,206 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The defaults of the search settings.
+const (
+	DefaultSearchResults = 5
+	DefaultSearchTimeout = 30 * time.Second
+)
+
+// cancelEmoji cancels a search when reacted with.
+const cancelEmoji = "❌"
+
+// numberEmoji returns the keycap emoji of the digit given.
+func numberEmoji(n int) string {
+	return strconv.Itoa(n) + "\ufe0f\u20e3"
+}
+
+// Reaction is a reaction a user added to a message.
+type Reaction struct {
+	GuildID   string
+	ChannelID string
+	MessageID string
+	UserID    string
+	Emoji     string
+}
+
+// selection is a search waiting for its requester to pick one of the results.
+type selection struct {
+	channelID string
+	messageID string
+	tracks    []*Track
+	timer     *time.Timer
+}
+
+// selectionKey returns the key of the pending selection of a user in a guild.
+func selectionKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+// search shows the results matching the query and waits for the user to pick one.
+func (b *Bot) search(ctx *Context) error {
+	searcher, ok := b.Loader.(Searcher)
+	if !ok {
+		return UserError("Searching is not supported")
+	}
+	limit := b.SearchResults
+	if limit < 1 || limit > 9 {
+		limit = DefaultSearchResults
+	}
+	tracks, err := searcher.Search(ctx.String(0), limit)
+	if err != nil {
+		return err
+	}
+	if len(tracks) > limit {
+		tracks = tracks[:limit]
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Results for %s:", ctx.String(0))
+	for i, track := range tracks {
+		fmt.Fprintf(&sb, "\n%d. %s - %s [%s]", i+1, track.Title(), track.Info.Author, FormatLength(track))
+	}
+	fmt.Fprintf(&sb, "\nPick a track by its number within %d seconds, or type cancel", b.SearchTimeout/time.Second)
+	messageID, err := ctx.Session.SendMessage(ctx.ChannelID, sb.String())
+	if err != nil {
+		return err
+	}
+
+	key := selectionKey(ctx.GuildID, ctx.AuthorID)
+	sel := &selection{channelID: ctx.ChannelID, messageID: messageID, tracks: tracks}
+	b.selMu.Lock()
+	if old, ok := b.selections[key]; ok {
+		old.timer.Stop()
+	}
+	b.selections[key] = sel
+	sel.timer = time.AfterFunc(b.SearchTimeout, func() {
+		if b.takeSelection(key, sel) {
+			_, _ = b.session.SendMessage(sel.channelID, "Search timed out")
+		}
+	})
+	b.selMu.Unlock()
+
+	// Reacting takes a request per emoji, the user may pick by number meanwhile.
+	go func() {
+		for i := range tracks {
+			if ctx.Session.AddReaction(ctx.ChannelID, messageID, numberEmoji(i+1)) != nil {
+				return
+			}
+		}
+		_ = ctx.Session.AddReaction(ctx.ChannelID, messageID, cancelEmoji)
+	}()
+	return nil
+}
+
+// selection returns the pending selection of a user in a guild, nil if none.
+func (b *Bot) selection(guildID, userID string) *selection {
+	b.selMu.Lock()
+	defer b.selMu.Unlock()
+	return b.selections[selectionKey(guildID, userID)]
+}
+
+// takeSelection removes the selection given, returning false if it was already removed.
+func (b *Bot) takeSelection(key string, sel *selection) bool {
+	b.selMu.Lock()
+	defer b.selMu.Unlock()
+	if b.selections[key] != sel {
+		return false
+	}
+	sel.timer.Stop()
+	delete(b.selections, key)
+	return true
+}
+
+// pickMessage picks a search result if the message is the user's answer to their search.
+func (b *Bot) pickMessage(m Message) bool {
+	sel := b.selection(m.GuildID, m.AuthorID)
+	if sel == nil || sel.channelID != m.ChannelID {
+		return false
+	}
+	content := strings.TrimSpace(m.Content)
+	if strings.EqualFold(content, "cancel") {
+		b.cancel(m.GuildID, m.AuthorID, sel)
+		return true
+	}
+	n, err := strconv.Atoi(content)
+	if err != nil {
+		return false
+	}
+	if n < 1 || n > len(sel.tracks) {
+		_, _ = b.session.SendMessage(m.ChannelID, fmt.Sprintf("Pick a number between 1 and %d", len(sel.tracks)))
+		return true
+	}
+	b.pick(m, sel, n-1)
+	return true
+}
+
+// pickReaction picks a search result if the reaction is the user's answer to their search.
+func (b *Bot) pickReaction(r Reaction) bool {
+	sel := b.selection(r.GuildID, r.UserID)
+	if sel == nil || sel.messageID != r.MessageID {
+		return false
+	}
+	if r.Emoji == cancelEmoji {
+		b.cancel(r.GuildID, r.UserID, sel)
+		return true
+	}
+	for i := range sel.tracks {
+		if r.Emoji == numberEmoji(i+1) {
+			b.pick(Message{GuildID: r.GuildID, ChannelID: r.ChannelID, AuthorID: r.UserID}, sel, i)
+			return true
+		}
+	}
+	return false
+}
+
+// cancel cancels the selection of a user.
+func (b *Bot) cancel(guildID, userID string, sel *selection) {
+	if b.takeSelection(selectionKey(guildID, userID), sel) {
+		_, _ = b.session.SendMessage(sel.channelID, "Search cancelled")
+	}
+}
+
+// pick plays the result at the index given on behalf of the author of the message.
+//
+// It runs as the search command so the user must still meet its requirements.
+func (b *Bot) pick(m Message, sel *selection, i int) {
+	if !b.takeSelection(selectionKey(m.GuildID, m.AuthorID), sel) {
+		return
+	}
+	track := sel.tracks[i]
+	c := *b.Router.Command("search")
+	c.Args = nil
+	c.Run = func(ctx *Context) error {
+		return b.enqueue(ctx, []*Track{track})
+	}
+	b.Router.Execute(b.session, m, &c, "")
+}
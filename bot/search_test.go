@@ -0,0 +1,74 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+
+	assert.Equal(t, ErrNotInVoice.Error(), send(b, s, "u", "!!search song"))
+	s.voice["u"] = "voice"
+	assert.Equal(t, "No matches found", send(b, s, "u", "!!search missing"))
+
+	results := send(b, s, "u", "!!search song")
+	assert.Contains(t, results, "1. song 1 -  [")
+	assert.Contains(t, results, "5. song 5 -  [")
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", ChannelID: "text", AuthorID: "other", Content: "2"}), "only the requester can pick")
+	assert.Equal(t, "Pick a number between 1 and 5", send(b, s, "u", "7"))
+	send(b, s, "u", "2")
+	assert.Equal(t, "song 2", b.Manager.Get("1").Current().Title())
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", ChannelID: "text", AuthorID: "u", Content: "2"}), "the search should be over")
+
+	send(b, s, "u", "!!search other")
+	id := strconv.Itoa(len(s.messages))
+	assert.False(t, b.HandleReaction(Reaction{GuildID: "1", ChannelID: "text", MessageID: id, UserID: "other", Emoji: numberEmoji(3)}))
+	assert.True(t, b.HandleReaction(Reaction{GuildID: "1", ChannelID: "text", MessageID: id, UserID: "u", Emoji: numberEmoji(3)}))
+	assert.Equal(t, "Queued - other 3 -  [#1]", s.last())
+
+	send(b, s, "u", "!!search nothing")
+	assert.Equal(t, "Search cancelled", send(b, s, "u", "cancel"))
+
+	b.SearchTimeout = 50 * time.Millisecond
+	send(b, s, "u", "!!search slow")
+	id = strconv.Itoa(len(s.messages))
+	deadline := time.Now().Add(time.Second)
+	for s.last() != "Search timed out" {
+		if time.Now().After(deadline) {
+			t.Fatal("the search should time out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	assert.Equal(t, []string{numberEmoji(1), numberEmoji(2), numberEmoji(3), numberEmoji(4), numberEmoji(5), cancelEmoji}, s.reactions[id])
+	s.mu.Unlock()
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", ChannelID: "text", AuthorID: "u", Content: "1"}), "a timed out search can't be picked")
+}
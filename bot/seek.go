@@ -0,0 +1,89 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSeekStep is how far forward and rewind seek when no amount is given.
+const DefaultSeekStep = 10 * time.Second
+
+// ParseSeek parses the position of a seek, see ParseDuration.
+//
+// A leading + or - makes the position relative to the current position, in which case the offset returned
+// is negative when seeking backward.
+func ParseSeek(s string) (offset time.Duration, relative bool, err error) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "+") {
+		s, relative = s[1:], true
+	} else if strings.HasPrefix(s, "-") {
+		s, relative, sign = s[1:], true, -1
+	}
+	offset, err = ParseDuration(s)
+	return sign * offset, relative, err
+}
+
+// seek seeks the current track to the position given, or by the offset given relative to the current position.
+func (b *Bot) seek(ctx *Context) error {
+	offset, relative, err := ParseSeek(ctx.String(0))
+	if err != nil {
+		return UserError("The position must be a timestamp like 1:30, or like +30 or -1:00 to seek from the current position")
+	}
+	if relative {
+		return b.seekBy(ctx, offset)
+	}
+	return b.seekTo(ctx, offset)
+}
+
+// seekBy seeks the current track by the offset given, backward if it is negative.
+func (b *Bot) seekBy(ctx *Context, offset time.Duration) error {
+	return b.seekTo(ctx, ctx.Player.Player().Position()+offset)
+}
+
+// seekTo seeks the current track to the position given.
+//
+// Positions before the start of the track seek to the start, positions past its end are rejected.
+func (b *Bot) seekTo(ctx *Context, position time.Duration) error {
+	current := ctx.Player.Current()
+	if current == nil {
+		return ErrNothingPlaying
+	}
+	if current.Info.IsStream {
+		return UserError("Live streams can't be seeked")
+	}
+	if position < 0 {
+		position = 0
+	}
+	if length := current.Length(); length > 0 && position >= length {
+		return UserError(fmt.Sprintf("The track is only %s long", FormatDuration(length)))
+	}
+	if err := ctx.Player.Player().Seek(position); err != nil {
+		return UserError("Track is not seekable")
+	}
+	return ctx.Reply("Seeked to %s/%s", FormatDuration(position), FormatLength(current))
+}
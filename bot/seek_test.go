@@ -0,0 +1,83 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseSeek(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"90":      90 * time.Second,
+		"1:30":    90 * time.Second,
+		"1:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+		"1m30s":   90 * time.Second,
+		"0":       0,
+	} {
+		d, err := ParseDuration(s)
+		assert.Nil(t, err, "error is supposed to be nil")
+		assert.Equal(t, expected, d, s)
+	}
+	for _, bad := range []string{"", "1:5", "1:60", "1:02:03:04", "1m30", "-1", "soon"} {
+		_, err := ParseDuration(bad)
+		assert.Equal(t, ErrInvalidDuration, err, bad+" should not parse")
+	}
+
+	offset, relative, err := ParseSeek("-1:00")
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.True(t, relative, "a signed position is relative")
+	assert.Equal(t, -time.Minute, offset)
+	offset, relative, _ = ParseSeek("+30")
+	assert.Equal(t, 30*time.Second, offset)
+	assert.True(t, relative, "a signed position is relative")
+	_, _, err = ParseSeek("+")
+	assert.Equal(t, ErrInvalidDuration, err)
+}
+
+func TestSeek(t *testing.T) {
+	b, s, _ := newTestBot()
+	defer b.Close()
+	s.voice["u"] = "voice"
+
+	send(b, s, "u", "!!play a")
+	gp := b.Manager.Get("1")
+	waitFor(t, "the track to load", func() bool {
+		return gp.Player().Seek(0) == nil
+	})
+	send(b, s, "u", "!!pause")
+	assert.Equal(t, "Seeked to 0:10/0:20", send(b, s, "u", "!!seek 0:10"))
+	assert.Equal(t, "Seeked to 0:15/0:20", send(b, s, "u", "!!forward 5"))
+	assert.Equal(t, "Seeked to 0:05/0:20", send(b, s, "u", "!!rewind"))
+	assert.Equal(t, "Seeked to 0:00/0:20", send(b, s, "u", "!!seek -1:00"), "seeking before the start should seek to the start")
+	assert.Equal(t, "The track is only 0:20 long", send(b, s, "u", "!!seek +30"))
+	assert.Equal(t, "The track is only 0:20 long", send(b, s, "u", "!!seek 20"))
+	assert.Contains(t, send(b, s, "u", "!!seek soon"), "The position must be a timestamp")
+	assert.Equal(t, "Seeked to 0:00/0:20", send(b, s, "u", "!!replay"))
+
+	gp.Current().Info.IsStream = true
+	assert.Equal(t, "Live streams can't be seeked", send(b, s, "u", "!!forward"))
+}
@@ -0,0 +1,188 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SettingsStore keeps the settings of the guilds, saving them to a JSON file.
+//
+// Only the settings a guild changed are saved, the others follow the defaults even when the defaults
+// change later, and settings added later start at their defaults. It is safe for concurrent use.
+type SettingsStore struct {
+	path     string
+	defaults Settings
+
+	mu sync.Mutex
+	// The settings each guild changed by their JSON names.
+	overrides map[string]map[string]json.RawMessage
+	// The settings of the guilds that changed any, the overrides merged over the defaults.
+	guilds map[string]Settings
+}
+
+// OpenSettingsStore loads the settings saved in the file given, the file is created once they change.
+//
+// An empty path keeps the settings in memory only.
+func OpenSettingsStore(path string, defaults Settings) (*SettingsStore, error) {
+	s := &SettingsStore{
+		path:      path,
+		defaults:  defaults,
+		overrides: make(map[string]map[string]json.RawMessage),
+		guilds:    make(map[string]Settings),
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.overrides); err != nil {
+		return nil, err
+	}
+	for guildID, overrides := range s.overrides {
+		if s.guilds[guildID], err = s.merge(overrides); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// settingFields encodes each of the settings given by its JSON name.
+func settingFields(settings Settings) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	v := reflect.ValueOf(settings)
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		fields[name], _ = json.Marshal(v.Field(i).Interface())
+	}
+	return fields
+}
+
+// merge returns the defaults with the overrides given applied.
+func (s *SettingsStore) merge(overrides map[string]json.RawMessage) (Settings, error) {
+	fields := settingFields(s.defaults)
+	for name, value := range overrides {
+		fields[name] = value
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Settings{}, err
+	}
+	var settings Settings
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+// Defaults returns the settings of guilds that didn't change them.
+func (s *SettingsStore) Defaults() Settings {
+	return s.defaults
+}
+
+// Get returns the settings of the guild given.
+func (s *SettingsStore) Get(guildID string) Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if settings, ok := s.guilds[guildID]; ok {
+		return settings
+	}
+	return s.defaults
+}
+
+// Set changes the settings of the guild given and saves them.
+//
+// The settings that differ from the current ones become overrides, as well as those that already were.
+func (s *SettingsStore) Set(guildID string, settings Settings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.guilds[guildID]
+	if !ok {
+		current = s.defaults
+	}
+	before := settingFields(current)
+	overrides := make(map[string]json.RawMessage)
+	for name, value := range settingFields(settings) {
+		if _, overridden := s.overrides[guildID][name]; overridden || !bytes.Equal(value, before[name]) {
+			overrides[name] = value
+		}
+	}
+	if len(overrides) == 0 {
+		delete(s.overrides, guildID)
+		delete(s.guilds, guildID)
+	} else {
+		s.overrides[guildID] = overrides
+		s.guilds[guildID] = settings
+	}
+	return s.save()
+}
+
+// Reset changes the settings of the guild given back to the defaults.
+func (s *SettingsStore) Reset(guildID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.overrides, guildID)
+	delete(s.guilds, guildID)
+	return s.save()
+}
+
+// save writes the settings to the file, mu must be held.
+func (s *SettingsStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes the file through a temporary file so a crash never leaves a partial file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
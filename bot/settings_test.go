@@ -0,0 +1,119 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile = filepath.Join(dir, "settings.json")
+	config.StateFile, config.PlaylistFile = "", ""
+	s, voices := newFakeSession(), &fakeVoices{}
+	b, err := New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer b.Close()
+
+	assert.Contains(t, send(b, s, "u", "!!settings"), "prefix: !!\nvolume: 100% (informational)\ndj: none")
+	assert.Equal(t, ErrMissingPermission.Error(), send(b, s, "u", "!!settings prefix ?"))
+	s.permissions["u"] = discordgo.PermissionManageServer
+	assert.Equal(t, "Changed prefix to ?", send(b, s, "u", "!!settings prefix ?"))
+	assert.False(t, b.HandleMessage(Message{GuildID: "1", Content: "!!help"}), "the old prefix should stop working")
+	assert.Contains(t, send(b, s, "u", "?help settings"), "?settings [setting] [value]")
+	assert.True(t, b.HandleMessage(Message{GuildID: "2", Content: "!!help"}), "other guilds should keep the default prefix")
+
+	assert.Equal(t, "Changed dj to <@&123>", send(b, s, "u", "?settings dj <@&123>"))
+	assert.Equal(t, "Mention the channel or type none", send(b, s, "u", "?settings announce general"))
+	assert.Equal(t, "The volume must be between 0 and 200", send(b, s, "u", "?settings volume 300"))
+	assert.Equal(t, "Changed maxqueue to 1", send(b, s, "u", "?settings maxqueue 1"))
+	assert.Equal(t, "Changed idle to 1m", send(b, s, "u", "?settings idle 1m"))
+	assert.Contains(t, send(b, s, "u", "?settings"), "dj: <@&123>\nannounce: none\nmaxqueue: 1\nidle: 1m0s")
+
+	s.voice["u"] = "voice"
+	send(b, s, "u", "?play a")
+	send(b, s, "u", "?play b")
+	assert.Equal(t, "The queue is full, it can have up to 1 tracks", send(b, s, "u", "?play c"))
+
+	store, err := OpenSettingsStore(config.SettingsFile, config.GuildSettings())
+	assert.Nil(t, err, "error is supposed to be nil")
+	saved := store.Get("1")
+	assert.Equal(t, "?", saved.Prefix, "the settings should be saved")
+	assert.Equal(t, "123", saved.DJRole)
+	assert.Equal(t, Duration(time.Minute), saved.IdleTimeout)
+	assert.Equal(t, config.GuildSettings(), store.Get("2"))
+
+	assert.Equal(t, "The settings were reset", send(b, s, "u", "?settings reset"))
+	assert.Equal(t, DefaultSettings, b.Manager.Get("1").Settings(), "the player should get the new settings")
+}
+
+func TestSettingsStore_Overrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settings")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "settings.json")
+	store, err := OpenSettingsStore(path, DefaultSettings)
+	assert.Nil(t, err, "error is supposed to be nil")
+	settings := store.Get("1")
+	settings.Prefix = "?"
+	assert.Nil(t, store.Set("1", settings), "error is supposed to be nil")
+	settings.SkipVotes = DefaultSettings.SkipVotes + 10
+	assert.Nil(t, store.Set("1", settings), "error is supposed to be nil")
+	settings.SkipVotes = DefaultSettings.SkipVotes
+	assert.Nil(t, store.Set("1", settings), "error is supposed to be nil")
+	assert.Nil(t, store.Set("2", store.Get("2")), "error is supposed to be nil")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.JSONEq(t, `{"1": {"prefix": "?", "skipVotes": 50}}`, string(data), "only the changed settings should be saved")
+
+	defaults := DefaultSettings
+	defaults.Prefix = "!"
+	defaults.MaxQueueLength = 10
+	defaults.SkipVotes = 60
+	store, err = OpenSettingsStore(path, defaults)
+	assert.Nil(t, err, "error is supposed to be nil")
+	settings = store.Get("1")
+	assert.Equal(t, "?", settings.Prefix, "the changed settings should be kept")
+	assert.Equal(t, 50, settings.SkipVotes, "settings changed back to the old default should be kept")
+	assert.Equal(t, 10, settings.MaxQueueLength, "the other settings should follow the defaults")
+	assert.Equal(t, defaults, store.Get("2"))
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"1": {"prefix": "?", "removed": true}}`), 0644), "error is supposed to be nil")
+	store, err = OpenSettingsStore(path, defaults)
+	assert.Nil(t, err, "error is supposed to be nil")
+	settings = store.Get("1")
+	assert.Equal(t, "?", settings.Prefix)
+	assert.Equal(t, defaults.Volume, settings.Volume, "missing settings should get the defaults")
+}
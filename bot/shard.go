@@ -0,0 +1,179 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Shard is a gateway shard of the bot, it serves the guilds ShardOf maps to its id.
+//
+// The zero value serves every guild, like a bot that isn't sharded.
+type Shard struct {
+	ID    int
+	Count int
+}
+
+// ShardOf returns the id of the shard out of the number given that serves the guild given, like Discord does.
+func ShardOf(guildID string, count int) int {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil || count < 1 {
+		return 0
+	}
+	return int((id >> 22) % uint64(count))
+}
+
+// Owns returns whether the shard serves the guild given.
+func (s Shard) Owns(guildID string) bool {
+	return s.Count <= 1 || ShardOf(guildID, s.Count) == s.ID
+}
+
+// ShardConnector returns the session and the voice joiner of the shard given.
+type ShardConnector func(shard Shard) (Session, VoiceJoiner, error)
+
+// Supervisor runs several shards of the bot in one process.
+//
+// Every shard has a bot of its own, with its own players and state file. The shards share the settings and
+// the playlists.
+type Supervisor struct {
+	// Shards are the bots of the shards, in the order they were given.
+	Shards []*Bot
+	// Settings keeps the settings of the guilds of all shards.
+	Settings *SettingsStore
+	// Playlists keeps the saved playlists of all shards, nil if they are disabled.
+	Playlists *PlaylistStore
+}
+
+// NewSupervisor creates the bots of the shards given, connecting each of them using connect.
+//
+// The stores are opened at the paths of config.ForProcess.
+func NewSupervisor(config Config, shards []Shard, connect ShardConnector, loader Loader) (*Supervisor, error) {
+	config, err := config.ForProcess()
+	if err != nil {
+		return nil, err
+	}
+	settings, playlists, err := openStores(config)
+	if err != nil {
+		return nil, err
+	}
+	s := &Supervisor{Settings: settings, Playlists: playlists}
+	for _, shard := range shards {
+		session, join, err := connect(shard)
+		if err == nil {
+			var b *Bot
+			b, err = newBot(config.ForShard(shard), settings, playlists, session, join, loader)
+			s.Shards = append(s.Shards, b)
+		}
+		if err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Bot returns the bot of the shard serving the guild given, nil if it isn't run by the supervisor.
+func (s *Supervisor) Bot(guildID string) *Bot {
+	return botOf(s.Shards, guildID)
+}
+
+// botOf returns the bot out of the bots given whose shard serves the guild given, nil if there is none.
+func botOf(bots []*Bot, guildID string) *Bot {
+	for _, b := range bots {
+		if b.Shard.Owns(guildID) {
+			return b
+		}
+	}
+	return nil
+}
+
+// Ready returns whether all of the shards are ready.
+func (s *Supervisor) Ready() bool {
+	for _, b := range s.Shards {
+		if !b.Ready() {
+			return false
+		}
+	}
+	return true
+}
+
+// API creates an API controlling the players of all of the shards.
+func (s *Supervisor) API(token string) *API {
+	return &API{Token: token, bots: s.Shards}
+}
+
+// MetricsHandler creates a handler serving the metrics given along with the checks of all of the shards, see
+// NewMetricsHandler.
+func (s *Supervisor) MetricsHandler(metrics http.Handler) http.Handler {
+	return newMetricsHandler(metrics, s.Shards)
+}
+
+// RestoreState restores the players of all of the shards, returning the first error.
+func (s *Supervisor) RestoreState() error {
+	return s.each(func(b *Bot) error {
+		return b.RestoreState()
+	})
+}
+
+// Close shuts all of the shards down, waiting as long as it takes, see Shutdown.
+func (s *Supervisor) Close() error {
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown shuts all of the shards down concurrently, see Bot.Shutdown, then closes the playlists.
+func (s *Supervisor) Shutdown(ctx context.Context) error {
+	err := s.each(func(b *Bot) error {
+		return b.Shutdown(ctx)
+	})
+	if s.Playlists != nil {
+		if perr := s.Playlists.Close(); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// each calls f with the bots of all of the shards concurrently, returning the first error.
+func (s *Supervisor) each(f func(*Bot) error) error {
+	errs := make([]error, len(s.Shards))
+	var wg sync.WaitGroup
+	for i, b := range s.Shards {
+		wg.Add(1)
+		go func(i int, b *Bot) {
+			defer wg.Done()
+			errs[i] = f(b)
+		}(i, b)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
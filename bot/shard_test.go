@@ -0,0 +1,175 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShards(t *testing.T) {
+	assert.Equal(t, 0, ShardOf("1", 2))
+	assert.Equal(t, 1, ShardOf("4194304", 2))
+	assert.Equal(t, 2, ShardOf("81384788765712384", 16))
+	assert.True(t, Shard{}.Owns("4194304"), "the zero shard should serve every guild")
+	assert.False(t, Shard{ID: 0, Count: 2}.Owns("4194304"))
+
+	config := DefaultConfig()
+	shards, err := config.Shards.Shards(1)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, []Shard{{ID: 0, Count: 1}}, shards)
+	assert.Equal(t, "state.json", config.ForShard(shards[0]).StateFile, "a single shard should keep the state file")
+	config.Shards.IDs = []int{2, 0}
+	shards, err = config.Shards.Shards(4)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, []Shard{{ID: 2, Count: 4}, {ID: 0, Count: 4}}, shards)
+	assert.Equal(t, "state.2.json", config.ForShard(shards[0]).StateFile)
+	_, err = config.Shards.Shards(2)
+	assert.NotNil(t, err, "shards out of the count should be rejected")
+	config.Shards.IDs = []int{1, 1}
+	_, err = config.Shards.Shards(2)
+	assert.NotNil(t, err, "shards listed twice should be rejected")
+
+	config = DefaultConfig()
+	process, err := config.ForProcess()
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, config, process, "a process running all of the shards should keep the stores")
+	config.Shards.IDs = []int{10, 2}
+	_, err = config.ForProcess()
+	assert.Equal(t, ErrSharedPlaylists, err, "the playlists of the users can't be split between processes")
+	config.PlaylistFile = ""
+	process, err = config.ForProcess()
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "settings.2-10.json", process.SettingsFile, "each process should keep its own settings")
+	assert.Equal(t, "", process.PlaylistFile, "disabled playlists should stay disabled")
+}
+
+func TestSupervisor_Processes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shards")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile = filepath.Join(dir, "settings.json")
+	config.StateFile = filepath.Join(dir, "state.json")
+	config.PlaylistFile = filepath.Join(dir, "playlists.db")
+	config.Shards = ShardConfig{Count: 2, IDs: []int{0}}
+	connect := func(shard Shard) (Session, VoiceJoiner, error) {
+		return newFakeSession(), (&fakeVoices{}).join, nil
+	}
+	_, err = NewSupervisor(config, []Shard{{ID: 0, Count: 2}}, connect, fakeLoader{packets: 1000})
+	assert.Equal(t, ErrSharedPlaylists, err, "a process running some of the shards should refuse playlists")
+	_, err = os.Stat(config.PlaylistFile)
+	assert.True(t, os.IsNotExist(err), "the playlist database should not be created")
+
+	config.PlaylistFile = ""
+	var sups []*Supervisor
+	for id := 0; id < 2; id++ {
+		config.Shards.IDs = []int{id}
+		shards, err := config.Shards.Shards(2)
+		assert.Nil(t, err, "error is supposed to be nil")
+		sup, err := NewSupervisor(config, shards, connect, fakeLoader{packets: 1000})
+		assert.Nil(t, err, "error is supposed to be nil")
+		sups = append(sups, sup)
+	}
+	assert.Nil(t, sups[0].Settings.Set("1", Settings{Prefix: "?"}), "error is supposed to be nil")
+	assert.Nil(t, sups[1].Settings.Set("4194304", Settings{Prefix: "$"}), "error is supposed to be nil")
+	for _, sup := range sups {
+		assert.Nil(t, sup.Close(), "error is supposed to be nil")
+	}
+	settings, err := OpenSettingsStore(filepath.Join(dir, "settings.0.json"), DefaultSettings)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "?", settings.Get("1").Prefix, "the processes should not overwrite each other's settings")
+
+	path := filepath.Join(dir, "playlists.db")
+	store, err := OpenPlaylistStore(path)
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer store.Close()
+	_, err = OpenPlaylistStore(path)
+	assert.Contains(t, fmt.Sprint(err), "used by another process", "a database in use should fail clearly")
+}
+
+func TestSupervisor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shards")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile = filepath.Join(dir, "settings.json")
+	config.StateFile = filepath.Join(dir, "state.json")
+	config.PlaylistFile = filepath.Join(dir, "playlists.db")
+	config.Shards.Count = 2
+	shards, err := config.Shards.Shards(2)
+	assert.Nil(t, err, "error is supposed to be nil")
+	sessions := make(map[int]*fakeSession)
+	voices := make(map[int]*fakeVoices)
+	connect := func(shard Shard) (Session, VoiceJoiner, error) {
+		sessions[shard.ID], voices[shard.ID] = newFakeSession(), &fakeVoices{}
+		return sessions[shard.ID], voices[shard.ID].join, nil
+	}
+	sup, err := NewSupervisor(config, shards, connect, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	server := httptest.NewServer(sup.API(""))
+	defer server.Close()
+
+	guilds := map[int]string{0: "1", 1: "4194304"}
+	for id, guildID := range guilds {
+		b := sup.Shards[id]
+		assert.Equal(t, b, sup.Bot(guildID), "the guild should be served by its shard")
+		assert.False(t, sup.Shards[1-id].HandleMessage(Message{GuildID: guildID, ChannelID: "text", AuthorID: "u", Content: "!!play a"}),
+			"the guilds of other shards should be ignored")
+		sessions[id].voice["u"] = "voice"
+		assert.True(t, b.HandleMessage(Message{GuildID: guildID, ChannelID: "text", AuthorID: "u", Content: "!!play a"}))
+	}
+	assert.True(t, sup.Shards[0].Settings == sup.Shards[1].Settings, "the shards should share the settings")
+	assert.True(t, sup.Shards[0].Playlists == sup.Shards[1].Playlists, "the shards should share the playlists")
+	for id, guildID := range guilds {
+		for voices[id].get(guildID) == nil || voices[id].get(guildID).count() < 20 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	var players []APIPlayer
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "", "GET", "/v1/guilds", "", &players))
+	assert.Len(t, players, 2, "the players of all shards should be listed")
+	var player APIPlayer
+	assert.Equal(t, http.StatusOK, apiRequest(t, server, "", "GET", "/v1/guilds/4194304", "", &player))
+	assert.Equal(t, "4194304", player.GuildID)
+	assert.Nil(t, sup.Close(), "error is supposed to be nil")
+
+	for id, guildID := range guilds {
+		data, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("state.%d.json", id)))
+		assert.Nil(t, err, "error is supposed to be nil")
+		var state State
+		assert.Nil(t, json.Unmarshal(data, &state), "error is supposed to be nil")
+		assert.Len(t, state.Guilds, 1, "each shard should save its own players")
+		assert.Equal(t, guildID, state.Guilds[0].GuildID)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/lavalink"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// ErrNotResolvable is returned when restoring the state using a loader that can't resolve tracks.
+var ErrNotResolvable = errors.New("the loader can't resolve tracks")
+
+// TrackState is a track saved in the state file.
+type TrackState struct {
+	// Track is the track encoded like Lavalink does.
+	Track     string `json:"track"`
+	Requester string `json:"requester,omitempty"`
+}
+
+// PlayerState is the state of a guild player saved across restarts.
+//
+// The settings of the guild are saved by the SettingsStore.
+type PlayerState struct {
+	GuildID      string   `json:"guildId"`
+	VoiceChannel string   `json:"voiceChannel"`
+	TextChannel  string   `json:"textChannel"`
+	Loop         LoopMode `json:"loop"`
+	Paused       bool     `json:"paused"`
+	// Current is the track that was playing, nil if none.
+	Current *TrackState `json:"current,omitempty"`
+	// Position is the position in the current track.
+	Position Duration     `json:"position"`
+	Queue    []TrackState `json:"queue"`
+}
+
+// State is the state of all of the guild players.
+type State struct {
+	Guilds []PlayerState `json:"guilds"`
+}
+
+// trackState encodes a track into a TrackState.
+func trackState(track *Track) (TrackState, error) {
+	encoded, err := lavalink.EncodeTrack(track.Info)
+	if err != nil {
+		return TrackState{}, err
+	}
+	return TrackState{Track: encoded, Requester: track.Requester}, nil
+}
+
+// State returns the state of the player, ok is false if it isn't connected to a voice channel.
+func (gp *GuildPlayer) State() (state PlayerState, ok bool, err error) {
+	state = PlayerState{
+		GuildID:      gp.guildID,
+		VoiceChannel: gp.VoiceChannel(),
+		TextChannel:  gp.TextChannel(),
+		Loop:         gp.Loop(),
+		Paused:       gp.player.Paused(),
+		Queue:        []TrackState{},
+	}
+	if state.VoiceChannel == "" {
+		return state, false, nil
+	}
+	if current := gp.Current(); current != nil {
+		ts, err := trackState(current)
+		if err != nil {
+			return state, false, err
+		}
+		state.Current = &ts
+		state.Position = Duration(gp.player.Position())
+	}
+	for _, track := range gp.queue.Tracks() {
+		ts, err := trackState(track)
+		if err != nil {
+			return state, false, err
+		}
+		state.Queue = append(state.Queue, ts)
+	}
+	return state, true, nil
+}
+
+// State returns the state of all of the players connected to voice channels.
+func (b *Bot) State() (State, error) {
+	state := State{Guilds: []PlayerState{}}
+	for _, gp := range b.Manager.Guilds() {
+		ps, ok, err := gp.State()
+		if err != nil {
+			return state, err
+		}
+		if ok {
+			state.Guilds = append(state.Guilds, ps)
+		}
+	}
+	return state, nil
+}
+
+// SaveState writes the state of the players to the state file.
+func (b *Bot) SaveState() error {
+	if b.StateFile == "" {
+		return nil
+	}
+	state, err := b.State()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.writeState(b.StateFile, data)
+}
+
+// RestoreState rejoins the voice channels saved in the state file and resumes playing where the players stopped.
+//
+// The tracks are resolved again, so their stream urls are fresh. Tracks that can't be resolved are logged and skipped,
+// guilds whose voice channel can't be joined are skipped and the first error is returned.
+func (b *Bot) RestoreState() error {
+	if b.StateFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(b.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	resolver, ok := b.Loader.(Resolver)
+	if !ok {
+		return ErrNotResolvable
+	}
+	var first error
+	for _, ps := range state.Guilds {
+		if !b.Shard.Owns(ps.GuildID) {
+			continue
+		}
+		if err := b.restore(resolver, ps); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// resolveTrack decodes a track encoded like Lavalink does and resolves it using the resolver given.
+func resolveTrack(resolver Resolver, encoded string) (*Track, error) {
+	info, err := lavalink.DecodeTrack(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.Resolve(info)
+}
+
+// restore restores the state of a single player.
+func (b *Bot) restore(resolver Resolver, ps PlayerState) error {
+	logger := core.With(b.Manager.Logger, core.F(core.KeyGuild, ps.GuildID))
+	resolve := func(ts TrackState) *Track {
+		track, err := resolveTrack(resolver, ts.Track)
+		if err != nil {
+			identifier := ts.Track
+			if info, err := lavalink.DecodeTrack(ts.Track); err == nil {
+				identifier = info.Identifier
+			}
+			logger.Log(core.LevelWarn, "restoring a track failed", core.F(core.KeyTrack, identifier), core.F(core.KeyError, err))
+			return nil
+		}
+		track.Requester = ts.Requester
+		return track
+	}
+	gp := b.Manager.GetOrCreate(ps.GuildID)
+	if err := gp.Join(ps.VoiceChannel); err != nil {
+		b.Manager.Remove(ps.GuildID)
+		return err
+	}
+	gp.BindTextChannel(ps.TextChannel)
+	if mode, ok := ParseLoopMode(string(ps.Loop)); ok {
+		gp.SetLoop(mode)
+	}
+	for _, ts := range ps.Queue {
+		if track := resolve(ts); track != nil {
+			gp.Queue().Push(track)
+		}
+	}
+	gp.Player().Pause(ps.Paused)
+	if ps.Current != nil {
+		if track := resolve(*ps.Current); track != nil {
+			return gp.PlayFrom(track, time.Duration(ps.Position))
+		}
+	}
+	// The current track is gone, play the next one instead.
+	if next := gp.Queue().Pop(); next != nil {
+		_, err := gp.Enqueue(next)
+		return err
+	}
+	return nil
+}
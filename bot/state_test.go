@@ -0,0 +1,131 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"encoding/json"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile, config.PlaylistFile = "", ""
+	config.StateFile = filepath.Join(dir, "state.json")
+	s, voices := newFakeSession(), &fakeVoices{}
+	b, err := New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+
+	s.voice["u"] = "voice"
+	for _, track := range []string{"a", "b", "c"} {
+		send(b, s, "u", "!!play "+track)
+	}
+	send(b, s, "u", "!!loop queue")
+	for voices.get("1").count() < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Nil(t, b.Close(), "error is supposed to be nil")
+
+	data, err := ioutil.ReadFile(config.StateFile)
+	assert.Nil(t, err, "error is supposed to be nil")
+	var state State
+	assert.Nil(t, json.Unmarshal(data, &state), "error is supposed to be nil")
+	assert.Len(t, state.Guilds, 1)
+	saved := state.Guilds[0]
+	assert.Equal(t, "voice", saved.VoiceChannel)
+	assert.Equal(t, LoopQueue, saved.Loop)
+	assert.Equal(t, "u", saved.Current.Requester)
+	assert.True(t, saved.Position > 0, "the position should be saved")
+	assert.Len(t, saved.Queue, 2)
+
+	voices = &fakeVoices{}
+	b, err = New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer b.Close()
+	assert.Nil(t, b.RestoreState(), "error is supposed to be nil")
+	gp := b.Manager.Get("1")
+	assert.Equal(t, "voice", voices.get("1").ChannelID(), "the voice channel should be joined again")
+	assert.Equal(t, "a", gp.Current().Title())
+	assert.Equal(t, "u", gp.Current().Requester)
+	assert.Equal(t, LoopQueue, gp.Loop())
+	assert.Equal(t, []string{"b", "c"}, titles(gp.Queue().Tracks()))
+	waitFor(t, "the track should resume from its position", func() bool {
+		return gp.Player().Position() >= time.Duration(saved.Position)
+	})
+}
+
+func TestState_Unresolvable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.SettingsFile, config.PlaylistFile = "", ""
+	config.StateFile = filepath.Join(dir, "state.json")
+	encode := func(identifier, title string) TrackState {
+		encoded, err := lavalink.EncodeTrack(lavalink.TrackInfo{Identifier: identifier, Title: title})
+		assert.Nil(t, err, "error is supposed to be nil")
+		return TrackState{Track: encoded}
+	}
+	current := encode("m1", "missing")
+	state := State{Guilds: []PlayerState{{
+		GuildID:      "1",
+		VoiceChannel: "voice",
+		Current:      &current,
+		Queue:        []TrackState{{Track: "broken"}, encode("m2", "missing too"), encode("b", "b")},
+	}}}
+	data, err := json.Marshal(state)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Nil(t, ioutil.WriteFile(config.StateFile, data, 0644), "error is supposed to be nil")
+
+	s, voices, logger := newFakeSession(), &fakeVoices{}, &fakeLogger{}
+	b, err := New(config, s, voices.join, fakeLoader{packets: 1000})
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer b.Close()
+	b.Manager.Logger = logger
+	assert.Nil(t, b.RestoreState(), "error is supposed to be nil")
+	gp := b.Manager.Get("1")
+	assert.Equal(t, "b", gp.Current().Title(), "the tracks that resolve should still be restored")
+
+	var failed []string
+	for _, event := range logger.get() {
+		if strings.HasPrefix(event, "warn restoring a track failed") {
+			failed = append(failed, event)
+		}
+	}
+	if assert.Len(t, failed, 3, "each track that failed should be logged") {
+		assert.Contains(t, failed[0], "guild=1 track=broken")
+		assert.Contains(t, failed[1], "guild=1 track=m2")
+		assert.Contains(t, failed[2], "guild=1 track=m1")
+	}
+}
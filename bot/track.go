@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package bot
+
+import (
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/dondish/lionplayer/youtube"
+	"time"
+)
+
+// Track is a track requested in a guild.
+//
+// The info describes the track to the users and identifies it across restarts.
+type Track struct {
+	core.Track
+	Info lavalink.TrackInfo
+	// Requester is the id of the user who requested the track.
+	Requester string
+}
+
+// NewYoutubeTrack creates a Track of a youtube track requested by the user given.
+func NewYoutubeTrack(track *youtube.Track, requester string) *Track {
+	return &Track{Track: track, Info: lavalink.YoutubeTrackInfo(track), Requester: requester}
+}
+
+// Title returns the title of the track.
+func (t *Track) Title() string {
+	return t.Info.Title
+}
+
+// Length returns the length of the track, zero if it is a stream.
+func (t *Track) Length() time.Duration {
+	if t.Info.IsStream {
+		return 0
+	}
+	return time.Duration(t.Info.Length) * time.Millisecond
+}
+
+// Artwork returns the url of the track's artwork, empty if unknown.
+func (t *Track) Artwork() string {
+	if t.Info.SourceName == "youtube" {
+		return "https://i.ytimg.com/vi/" + t.Info.Identifier + "/hqdefault.jpg"
+	}
+	return ""
+}
+
+// URL returns the url of the track, empty if unknown.
+func (t *Track) URL() string {
+	if t.Info.URI == nil {
+		return ""
+	}
+	return *t.Info.URI
+}
@@ -0,0 +1,91 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package main launches a Lavalink compatible audio node backed by lionplayer.
+package main
+
+import (
+	"flag"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/lavalink"
+	"github.com/dondish/lionplayer/voice"
+	"github.com/dondish/lionplayer/youtube"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	addr     string
+	password string
+	level    string
+)
+
+func init() {
+	flag.StringVar(&addr, "addr", ":2333", "The address to listen on")
+	flag.StringVar(&password, "password", "youshallnotpass", "The password clients must authorize with")
+	flag.StringVar(&level, "log", "info", "The minimum level of the events logged: debug, info, warn or error")
+	flag.Parse()
+}
+
+// dialVoice connects a player to a Discord voice server.
+func dialVoice(guildID, userID string, state lavalink.VoiceState) (lavalink.VoiceConnection, error) {
+	return voice.Dial(voice.Options{
+		GuildID:   guildID,
+		UserID:    userID,
+		SessionID: state.SessionID,
+		Token:     state.Token,
+		Endpoint:  state.Endpoint,
+	})
+}
+
+func main() {
+	logger := core.StdLogger{Logger: log.New(os.Stderr, "", log.LstdFlags), Level: core.LevelInfo}
+	if l, ok := core.ParseLevel(level); ok {
+		logger.Level = l
+	} else {
+		logger.Log(core.LevelWarn, "unknown log level, logging from info", core.F("level", level))
+	}
+	core.DefaultLogger = logger
+
+	node := lavalink.NewNode(password, dialVoice, lavalink.NewYoutubeSource(youtube.New(nil)))
+	srv := &http.Server{Addr: addr, Handler: node}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log(core.LevelError, "serving failed", core.F(core.KeyError, err))
+			os.Exit(1)
+		}
+	}()
+
+	// Wait here until CTRL-C or other term signal is received.
+	logger.Log(core.LevelInfo, "Lionnode is now listening, press CTRL-C to exit", core.F("address", addr))
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	<-sc
+
+	_ = srv.Close()
+}
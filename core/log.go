@@ -0,0 +1,176 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Level is the severity of a logged event.
+type Level int
+
+// The levels, from the least to the most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// The keys of the fields common to the events of several packages.
+const (
+	// KeyGuild is the id of the guild the event is about.
+	KeyGuild = "guild"
+	// KeyTrack is the identifier of the track the event is about.
+	KeyTrack = "track"
+	// KeyOffset is the byte offset in the stream the event happened at.
+	KeyOffset = "offset"
+	// KeyError is the error that occurred.
+	KeyError = "error"
+)
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses the name of a level, returning false if it isn't one.
+func ParseLevel(name string) (Level, bool) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, true
+		}
+	}
+	return LevelInfo, false
+}
+
+// Field is a piece of structured information about a logged event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives the events the packages of lionplayer log.
+//
+// The packages never print on their own, they log to the logger they were given or to DefaultLogger.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	// Log logs an event of the level given described by the message and the fields.
+	Log(level Level, msg string, fields ...Field)
+}
+
+// DefaultLogger is used by the packages that weren't given a logger, it discards everything by default.
+var DefaultLogger Logger = NopLogger{}
+
+// LoggerOr returns the logger given, or DefaultLogger if it is nil.
+func LoggerOr(l Logger) Logger {
+	if l == nil {
+		return DefaultLogger
+	}
+	return l
+}
+
+// NopLogger discards everything.
+type NopLogger struct{}
+
+// Log implements Logger.
+func (NopLogger) Log(Level, string, ...Field) {}
+
+// fieldLogger adds fields to the events of another logger.
+type fieldLogger struct {
+	Logger
+	fields []Field
+}
+
+// Log implements Logger.
+func (l fieldLogger) Log(level Level, msg string, fields ...Field) {
+	l.Logger.Log(level, msg, append(l.fields[:len(l.fields):len(l.fields)], fields...)...)
+}
+
+// With returns a logger adding the fields given to the events it logs, nil is DefaultLogger.
+//
+// The fields are added when the events are logged, so loggers created before DefaultLogger is set use it.
+func With(l Logger, fields ...Field) Logger {
+	if fl, ok := l.(fieldLogger); ok {
+		return fieldLogger{Logger: fl.Logger, fields: append(fl.fields[:len(fl.fields):len(fl.fields)], fields...)}
+	}
+	if l == nil {
+		l = defaultLogger{}
+	}
+	return fieldLogger{Logger: l, fields: fields}
+}
+
+// defaultLogger logs to whatever DefaultLogger is when logging.
+type defaultLogger struct{}
+
+// Log implements Logger.
+func (defaultLogger) Log(level Level, msg string, fields ...Field) {
+	DefaultLogger.Log(level, msg, fields...)
+}
+
+// StdLogger logs the events of a minimum level to a standard library logger, one per line like:
+//
+//	warn wrong cues id guild=1234 track=dQw4w9WgXcQ offset=4096
+type StdLogger struct {
+	Logger *log.Logger
+	// Level is the minimum level of the events logged.
+	Level Level
+}
+
+// Log implements Logger.
+func (l StdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.Level {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(level.String())
+	sb.WriteByte(' ')
+	sb.WriteString(msg)
+	for _, f := range fields {
+		value := fmt.Sprint(f.Value)
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&sb, " %s=%s", f.Key, value)
+	}
+	_ = l.Logger.Output(2, sb.String())
+}
@@ -0,0 +1,67 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := StdLogger{Logger: log.New(&buf, "", 0), Level: LevelInfo}
+	logger.Log(LevelDebug, "hidden")
+	assert.Empty(t, buf.String(), "events below the level should be discarded")
+
+	With(logger, F(KeyGuild, "1"), F(KeyTrack, "abc")).Log(LevelWarn, "wrong cues id", F(KeyOffset, 4096))
+	assert.Equal(t, "warn wrong cues id guild=1 track=abc offset=4096\n", buf.String())
+
+	buf.Reset()
+	logger.Log(LevelError, "failed", F(KeyError, errors.New("connection reset")))
+	assert.Equal(t, "error failed error=\"connection reset\"\n", buf.String(), "values with spaces should be quoted")
+}
+
+func TestWith(t *testing.T) {
+	defer func(l Logger) { DefaultLogger = l }(DefaultLogger)
+	var buf bytes.Buffer
+	logger := With(nil, F(KeyGuild, "1"))
+	parent := With(logger, F(KeyTrack, "a"))
+	child := With(parent, F(KeyTrack, "b"))
+	DefaultLogger = StdLogger{Logger: log.New(&buf, "", 0)}
+	parent.Log(LevelInfo, "parent")
+	child.Log(LevelInfo, "child")
+	assert.Equal(t, "info parent guild=1 track=a\ninfo child guild=1 track=a track=b\n", buf.String(), "loggers should use the DefaultLogger set after they were created")
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("WARN")
+	assert.True(t, ok, "the level is supposed to be known")
+	assert.Equal(t, LevelWarn, level)
+	_, ok = ParseLevel("verbose")
+	assert.False(t, ok, "the level is supposed to be unknown")
+}
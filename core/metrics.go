@@ -0,0 +1,108 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package core
+
+// The metrics the packages of lionplayer measure.
+const (
+	// MetricLoadSeconds is a histogram of the time loading a track took, labelled by source and stage.
+	MetricLoadSeconds = "lionplayer_load_seconds"
+	// MetricLoadFailures counts the tracks that failed to load, labelled by source and reason.
+	MetricLoadFailures = "lionplayer_load_failures_total"
+	// MetricActivePlayers is a gauge of the players that exist, labelled by shard.
+	MetricActivePlayers = "lionplayer_active_players"
+	// MetricPacketsSent counts the packets sent to the sinks of the players.
+	MetricPacketsSent = "lionplayer_packets_sent_total"
+	// MetricUnderruns counts the times a track had no packet ready when its sink wanted the next one.
+	MetricUnderruns = "lionplayer_underruns_total"
+	// MetricSeeks counts the seeks of the players.
+	MetricSeeks = "lionplayer_seeks_total"
+	// MetricHTTPRequests counts the requests of the HTTP streams, labelled by code.
+	MetricHTTPRequests = "lionplayer_http_requests_total"
+	// MetricHTTPBytes counts the bytes the HTTP streams received.
+	MetricHTTPBytes = "lionplayer_http_bytes_total"
+	// MetricHTTPRetries counts the requests of the HTTP streams retried after failing.
+	MetricHTTPRetries = "lionplayer_http_retries_total"
+)
+
+// The names of the labels of the metrics.
+const (
+	// LabelSource is the source of the track, like youtube.
+	LabelSource = "source"
+	// LabelStage is the stage of loading the track, like resolve or stream.
+	LabelStage = "stage"
+	// LabelReason is the reason of the failure.
+	LabelReason = "reason"
+	// LabelCode is the status code of the response, or error if there was none.
+	LabelCode = "code"
+	// LabelShard is the id of the gateway shard.
+	LabelShard = "shard"
+)
+
+// Label is a name and value pair telling apart the series of a metric.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// L creates a Label.
+func L(name, value string) Label {
+	return Label{Name: name, Value: value}
+}
+
+// Metrics receives the measurements the packages of lionplayer take.
+//
+// The packages measure into the metrics they were given or into DefaultMetrics.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Add adds delta to the counter of the name given.
+	Add(name string, delta float64, labels ...Label)
+	// Set sets the gauge of the name given.
+	Set(name string, value float64, labels ...Label)
+	// Observe adds a sample to the histogram of the name given.
+	Observe(name string, value float64, labels ...Label)
+}
+
+// DefaultMetrics is used by the packages that weren't given metrics, it discards everything by default.
+var DefaultMetrics Metrics = NopMetrics{}
+
+// MetricsOr returns the metrics given, or DefaultMetrics if they are nil.
+func MetricsOr(m Metrics) Metrics {
+	if m == nil {
+		return DefaultMetrics
+	}
+	return m
+}
+
+// NopMetrics discards everything.
+type NopMetrics struct{}
+
+// Add implements Metrics.
+func (NopMetrics) Add(string, float64, ...Label) {}
+
+// Set implements Metrics.
+func (NopMetrics) Set(string, float64, ...Label) {}
+
+// Observe implements Metrics.
+func (NopMetrics) Observe(string, float64, ...Label) {}
@@ -4,9 +4,10 @@ require (
 	github.com/bwmarrin/discordgo v0.20.1
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/ebml-go/ebml v0.0.0-20160925193348-ca8851a10894
-	github.com/gorilla/websocket v1.4.1 // indirect
+	github.com/gorilla/websocket v1.4.1
 	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	golang.org/x/text v0.3.2
 )
 
@@ -0,0 +1,383 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Package lavalink implements an audio node speaking the Lavalink (v4) protocol backed by lionplayer.
+
+Clients load and decode tracks using the REST endpoints, control the players of
+their session using the players endpoints and receive events over the websocket.
+
+See: https://lavalink.dev/api/
+*/
+package lavalink
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/player"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The version of the Lavalink protocol implemented.
+const (
+	semver       = "4.0.0"
+	versionMajor = 4
+	versionMinor = 0
+	versionPatch = 0
+)
+
+// VoiceConnection is a connection to a Discord voice server the packets of a player are sent to.
+type VoiceConnection interface {
+	player.Sink
+	io.Closer
+}
+
+// VoiceDialer connects to the voice server of a guild on behalf of the user given.
+type VoiceDialer func(guildID, userID string, state VoiceState) (VoiceConnection, error)
+
+// Node is an http.Handler serving the Lavalink REST endpoints and websocket.
+type Node struct {
+	// Password is the password clients must send in the Authorization header, empty disables authorization.
+	Password string
+	// Sources are the sources used to load tracks, in order.
+	Sources []Source
+	// Dial connects players to voice servers.
+	Dial VoiceDialer
+	// PlayerUpdateInterval is the interval of the playerUpdate messages.
+	PlayerUpdateInterval time.Duration
+	// StatsInterval is the interval of the stats messages.
+	StatsInterval time.Duration
+	// Logger logs the sessions and the failures of their players, nil for core.DefaultLogger.
+	Logger core.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	started  time.Time
+	upgrader websocket.Upgrader
+}
+
+// NewNode creates a new Node using the dialer and sources given.
+func NewNode(password string, dial VoiceDialer, sources ...Source) *Node {
+	return &Node{
+		Password:             password,
+		Sources:              sources,
+		Dial:                 dial,
+		PlayerUpdateInterval: 5 * time.Second,
+		StatsInterval:        time.Minute,
+		sessions:             make(map[string]*session),
+		started:              time.Now(),
+	}
+}
+
+// errNotFound is returned when a session or a player does not exist.
+var errNotFound = errors.New("not found")
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, status, Error{
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Status:    status,
+		Error:     http.StatusText(status),
+		Message:   message,
+		Path:      r.URL.Path,
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (n *Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if n.Password != "" && r.Header.Get("Authorization") != n.Password {
+		writeError(w, r, http.StatusUnauthorized, "invalid password")
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/version":
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, semver)
+	case path == "/v4/websocket":
+		n.serveWebsocket(w, r)
+	case path == "/v4/info":
+		n.serveInfo(w, r)
+	case path == "/v4/stats":
+		writeJSON(w, http.StatusOK, n.Stats())
+	case path == "/v4/loadtracks":
+		writeJSON(w, http.StatusOK, n.LoadTracks(r.URL.Query().Get("identifier")))
+	case path == "/v4/decodetrack":
+		n.serveDecodeTrack(w, r)
+	case path == "/v4/decodetracks":
+		n.serveDecodeTracks(w, r)
+	case strings.HasPrefix(path, "/v4/sessions/"):
+		n.serveSessions(w, r, strings.Split(strings.TrimPrefix(path, "/v4/sessions/"), "/"))
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+func (n *Node) serveInfo(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(n.Sources))
+	for _, s := range n.Sources {
+		names = append(names, s.Name())
+	}
+	writeJSON(w, http.StatusOK, Info{
+		Version: Version{
+			Semver: semver,
+			Major:  versionMajor,
+			Minor:  versionMinor,
+			Patch:  versionPatch,
+		},
+		BuildTime:      0,
+		Git:            map[string]interface{}{},
+		JVM:            runtime.Version(),
+		Lavaplayer:     "lionplayer",
+		SourceManagers: names,
+		Filters:        []string{},
+		Plugins:        []map[string]interface{}{},
+	})
+}
+
+func (n *Node) serveDecodeTrack(w http.ResponseWriter, r *http.Request) {
+	encoded := r.URL.Query().Get("encodedTrack")
+	if encoded == "" {
+		encoded = r.URL.Query().Get("track")
+	}
+	track, err := DecodeEncodedTrack(encoded)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, track)
+}
+
+func (n *Node) serveDecodeTracks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var encoded []string
+	if err := json.NewDecoder(r.Body).Decode(&encoded); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	tracks := make([]Track, 0, len(encoded))
+	for _, e := range encoded {
+		track, err := DecodeEncodedTrack(e)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		tracks = append(tracks, track)
+	}
+	writeJSON(w, http.StatusOK, tracks)
+}
+
+// DecodeEncodedTrack decodes an encoded track into a Track.
+func DecodeEncodedTrack(encoded string) (Track, error) {
+	info, err := DecodeTrack(encoded)
+	if err != nil {
+		return Track{}, err
+	}
+	return Track{
+		Encoded:    encoded,
+		Info:       info,
+		PluginInfo: map[string]interface{}{},
+		UserData:   map[string]interface{}{},
+	}, nil
+}
+
+// LoadTracks loads the identifier using the first source that matches it.
+func (n *Node) LoadTracks(identifier string) LoadResult {
+	for _, s := range n.Sources {
+		res, err := s.Load(identifier)
+		if err == ErrNoMatches {
+			continue
+		}
+		if err != nil {
+			core.LoggerOr(n.Logger).Log(core.LevelWarn, "loading failed", core.F("identifier", identifier),
+				core.F("source", s.Name()), core.F(core.KeyError, err))
+			return LoadResult{LoadType: LoadError, Data: Exception{
+				Message:  err.Error(),
+				Severity: SeverityCommon,
+				Cause:    err.Error(),
+			}}
+		}
+		return res
+	}
+	return LoadResult{LoadType: LoadEmpty, Data: struct{}{}}
+}
+
+// source returns the source with the name given.
+func (n *Node) source(name string) Source {
+	for _, s := range n.Sources {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Stats returns the statistics of the node.
+func (n *Node) Stats() Stats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := Stats{
+		Uptime: int64(time.Since(n.started) / time.Millisecond),
+		Memory: Memory{
+			Free:       mem.Sys - mem.HeapAlloc,
+			Used:       mem.HeapAlloc,
+			Allocated:  mem.Sys,
+			Reservable: mem.Sys,
+		},
+		CPU: CPU{Cores: runtime.NumCPU()},
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, s := range n.sessions {
+		players, playing := s.count()
+		stats.Players += players
+		stats.PlayingPlayers += playing
+	}
+	return stats
+}
+
+// newSessionID generates a random session id.
+func newSessionID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// session returns the session with the id given.
+func (n *Node) session(id string) (*session, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s, ok := n.sessions[id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return s, nil
+}
+
+// removeSession removes a session from the node.
+func (n *Node) removeSession(s *session) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sessions[s.id] == s {
+		delete(n.sessions, s.id)
+	}
+}
+
+func (n *Node) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("User-Id")
+	if userID == "" {
+		writeError(w, r, http.StatusBadRequest, "missing User-Id header")
+		return
+	}
+	var s *session
+	resumed := false
+	if id := r.Header.Get("Session-Id"); id != "" {
+		if existing, err := n.session(id); err == nil && existing.resumable() {
+			s, resumed = existing, true
+		}
+	}
+	conn, err := n.upgrader.Upgrade(w, r, nil)
+	if err != nil { // The upgrader already replied with the error.
+		core.LoggerOr(n.Logger).Log(core.LevelDebug, "websocket upgrade failed", core.F(core.KeyError, err))
+		return
+	}
+	if s == nil {
+		s = newSession(n, newSessionID(), userID)
+		n.mu.Lock()
+		n.sessions[s.id] = s
+		n.mu.Unlock()
+	}
+	s.attach(conn, resumed)
+}
+
+func (n *Node) serveSessions(w http.ResponseWriter, r *http.Request, parts []string) {
+	s, err := n.session(parts[0])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "session not found")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		var update UpdateSession
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.update(update))
+	case len(parts) == 2 && parts[1] == "players" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.players())
+	case len(parts) == 3 && parts[1] == "players":
+		n.servePlayer(w, r, s, parts[2])
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+	}
+}
+
+func (n *Node) servePlayer(w http.ResponseWriter, r *http.Request, s *session, guildID string) {
+	switch r.Method {
+	case http.MethodGet:
+		p, err := s.player(guildID, false)
+		if err != nil {
+			writeError(w, r, http.StatusNotFound, "player not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, p.info())
+	case http.MethodPatch:
+		var update UpdatePlayer
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		p, _ := s.player(guildID, true)
+		if err := p.update(update, r.URL.Query().Get("noReplace") == "true"); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, p.info())
+	case http.MethodDelete:
+		s.destroyPlayer(guildID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
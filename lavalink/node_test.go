@@ -0,0 +1,275 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lavalink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const password = "youshallnotpass"
+
+// fakePlayable plays a fixed amount of silent packets.
+type fakePlayable struct {
+	packets int
+	c       chan core.Packet
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newFakePlayable(packets int) *fakePlayable {
+	return &fakePlayable{packets: packets, c: make(chan core.Packet), closed: make(chan struct{})}
+}
+
+func (f *fakePlayable) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakePlayable) Chan() <-chan core.Packet { return f.c }
+func (f *fakePlayable) Pause(bool)               {}
+func (f *fakePlayable) SampleRate() int          { return 48000 }
+func (f *fakePlayable) Channels() int            { return 2 }
+func (f *fakePlayable) Codec() string            { return "opus" }
+
+func (f *fakePlayable) Play() {
+	defer close(f.c)
+	for i := 0; i < f.packets; i++ {
+		select {
+		case f.c <- core.Packet{Timecode: time.Duration(i) * 20 * time.Millisecond, Data: opus.Silence}:
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// fakeSource loads identifiers in the form of fake:<title>.
+type fakeSource struct {
+	packets int
+}
+
+func (s fakeSource) Name() string { return "fake" }
+
+func (s fakeSource) Load(identifier string) (LoadResult, error) {
+	if !strings.HasPrefix(identifier, "fake:") {
+		return LoadResult{}, ErrNoMatches
+	}
+	t, err := NewTrack(TrackInfo{
+		Identifier: identifier,
+		Title:      strings.TrimPrefix(identifier, "fake:"),
+		Author:     "lionplayer",
+		Length:     int64(s.packets * 20),
+		IsSeekable: true,
+		SourceName: "fake",
+	})
+	return LoadResult{LoadType: LoadTrack, Data: t}, err
+}
+
+func (s fakeSource) Open(info TrackInfo) (core.Playable, error) {
+	return newFakePlayable(s.packets), nil
+}
+
+// fakeVoice is a voice endpoint that counts the frames it receives.
+type fakeVoice struct {
+	mu     sync.Mutex
+	frames int
+	state  VoiceState
+}
+
+func (v *fakeVoice) WriteOpus(frame []byte) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.frames++
+	return nil
+}
+
+func (v *fakeVoice) Close() error { return nil }
+
+func (v *fakeVoice) count() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.frames
+}
+
+// voiceState returns the voice state the endpoint was dialed with.
+func (v *fakeVoice) voiceState() VoiceState {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.state
+}
+
+// newTestNode creates a node with a fake source and voice endpoint.
+func newTestNode(voice *fakeVoice) (*Node, *httptest.Server) {
+	node := NewNode(password, func(guildID, userID string, state VoiceState) (VoiceConnection, error) {
+		voice.mu.Lock()
+		voice.state = state
+		voice.mu.Unlock()
+		return voice, nil
+	}, fakeSource{packets: 50})
+	return node, httptest.NewServer(node)
+}
+
+// request sends an authorized request and decodes the response into v.
+func request(t *testing.T, method, url string, body, v interface{}) int {
+	var buf bytes.Buffer
+	if body != nil {
+		assert.Nil(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req, _ := http.NewRequest(method, url, &buf)
+	req.Header.Set("Authorization", password)
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer res.Body.Close()
+	if v != nil {
+		assert.Nil(t, json.NewDecoder(res.Body).Decode(v))
+	}
+	return res.StatusCode
+}
+
+// readEvent reads websocket messages until an event of the type given is received.
+func readEvent(t *testing.T, conn *websocket.Conn, typ string) EventMessage {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg EventMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Op == OpEvent && msg.Type == typ {
+			return msg
+		}
+	}
+}
+
+func TestEncodeTrack(t *testing.T) {
+	uri := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	artwork := "https://i.ytimg.com/vi/dQw4w9WgXcQ/maxresdefault.jpg"
+	isrc := "GBARL9300135"
+	info := TrackInfo{
+		Identifier: "dQw4w9WgXcQ",
+		IsSeekable: true,
+		Author:     "RickAstleyVEVO",
+		Length:     212000,
+		Title:      "Rick Astley - Never Gonna Give You Up (Video)",
+		URI:        &uri,
+		ArtworkURL: &artwork,
+		ISRC:       &isrc,
+		SourceName: "youtube",
+		Position:   30000,
+	}
+	encoded, err := EncodeTrack(info)
+	assert.Nil(t, err, "error is supposed to be nil")
+	decoded, err := DecodeTrack(encoded)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, info, decoded, "the track should survive a round trip")
+	data, _ := base64.StdEncoding.DecodeString(encoded)
+	assert.Equal(t, byte(3), data[4], "tracks should be written using version 3")
+
+	_, err = DecodeTrack(encoded[:len(encoded)-8])
+	assert.NotNil(t, err, "a truncated track should not decode")
+}
+
+func TestNode_Unauthorized(t *testing.T) {
+	_, ts := newTestNode(&fakeVoice{})
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/v4/info")
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestNode_LoadTracks(t *testing.T) {
+	_, ts := newTestNode(&fakeVoice{})
+	defer ts.Close()
+
+	var res struct {
+		LoadType string `json:"loadType"`
+		Data     Track  `json:"data"`
+	}
+	request(t, "GET", ts.URL+"/v4/loadtracks?identifier=fake:song", nil, &res)
+	assert.Equal(t, LoadTrack, res.LoadType)
+	assert.Equal(t, "song", res.Data.Info.Title)
+
+	var decoded Track
+	request(t, "GET", ts.URL+"/v4/decodetrack?encodedTrack="+res.Data.Encoded, nil, &decoded)
+	assert.Equal(t, res.Data.Info, decoded.Info, "decoding should return the loaded info")
+
+	var tracks []Track
+	request(t, "POST", ts.URL+"/v4/decodetracks", []string{res.Data.Encoded, res.Data.Encoded}, &tracks)
+	assert.Len(t, tracks, 2)
+
+	var empty LoadResult
+	request(t, "GET", ts.URL+"/v4/loadtracks?identifier=other", nil, &empty)
+	assert.Equal(t, LoadEmpty, empty.LoadType)
+}
+
+func TestNode_Playback(t *testing.T) {
+	voice := &fakeVoice{}
+	_, ts := newTestNode(voice)
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", password)
+	header.Set("User-Id", "1")
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/v4/websocket", header)
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer conn.Close()
+
+	var ready ReadyMessage
+	assert.Nil(t, conn.ReadJSON(&ready))
+	assert.Equal(t, OpReady, ready.Op)
+	assert.NotEmpty(t, ready.SessionID)
+
+	identifier := "fake:song"
+	state := VoiceState{Token: "token", Endpoint: "localhost", SessionID: "voice"}
+	var p Player
+	status := request(t, "PATCH", ts.URL+"/v4/sessions/"+ready.SessionID+"/players/42", UpdatePlayer{
+		Track: &UpdatePlayerTrack{Identifier: &identifier},
+		Voice: &state,
+	}, &p)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "42", p.GuildID)
+
+	start := readEvent(t, conn, EventTrackStart)
+	assert.Equal(t, "song", start.Track.Info.Title)
+	end := readEvent(t, conn, EventTrackEnd)
+	assert.Equal(t, "finished", end.Reason)
+	assert.Equal(t, 50, voice.count(), "all of the frames should reach the voice endpoint")
+	assert.Equal(t, state, voice.voiceState())
+
+	status = request(t, "DELETE", ts.URL+"/v4/sessions/"+ready.SessionID+"/players/42", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status = request(t, "GET", ts.URL+"/v4/sessions/"+ready.SessionID+"/players/42", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
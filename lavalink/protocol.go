@@ -0,0 +1,260 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lavalink
+
+import "encoding/json"
+
+// The load types of a LoadResult.
+const (
+	LoadTrack    = "track"
+	LoadPlaylist = "playlist"
+	LoadSearch   = "search"
+	LoadEmpty    = "empty"
+	LoadError    = "error"
+)
+
+// The severities of an Exception.
+const (
+	SeverityCommon     = "common"
+	SeveritySuspicious = "suspicious"
+	SeverityFault      = "fault"
+)
+
+// Track is a track as sent over the protocol.
+type Track struct {
+	Encoded    string                 `json:"encoded"`
+	Info       TrackInfo              `json:"info"`
+	PluginInfo map[string]interface{} `json:"pluginInfo"`
+	UserData   map[string]interface{} `json:"userData"`
+}
+
+// PlaylistInfo describes a loaded playlist.
+type PlaylistInfo struct {
+	Name          string `json:"name"`
+	SelectedTrack int    `json:"selectedTrack"`
+}
+
+// Playlist is the data of a playlist LoadResult.
+type Playlist struct {
+	Info       PlaylistInfo           `json:"info"`
+	PluginInfo map[string]interface{} `json:"pluginInfo"`
+	Tracks     []Track                `json:"tracks"`
+}
+
+// Exception describes an error that happened while loading or playing a track.
+type Exception struct {
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	Cause    string `json:"cause"`
+}
+
+// LoadResult is the response of the loadtracks endpoint.
+//
+// Data is a Track, a Playlist, a slice of Track, an Exception or an empty object depending on LoadType.
+type LoadResult struct {
+	LoadType string      `json:"loadType"`
+	Data     interface{} `json:"data"`
+}
+
+// VoiceState contains the information needed to connect to a Discord voice server.
+type VoiceState struct {
+	Token     string `json:"token"`
+	Endpoint  string `json:"endpoint"`
+	SessionID string `json:"sessionId"`
+}
+
+// PlayerState is the state of a player.
+type PlayerState struct {
+	Time      int64 `json:"time"`
+	Position  int64 `json:"position"`
+	Connected bool  `json:"connected"`
+	Ping      int64 `json:"ping"`
+}
+
+// Player is a player as sent over the protocol.
+type Player struct {
+	GuildID string                 `json:"guildId"`
+	Track   *Track                 `json:"track"`
+	Volume  int                    `json:"volume"`
+	Paused  bool                   `json:"paused"`
+	State   PlayerState            `json:"state"`
+	Voice   VoiceState             `json:"voice"`
+	Filters map[string]interface{} `json:"filters"`
+}
+
+// UpdatePlayerTrack is the track field of an UpdatePlayer request.
+type UpdatePlayerTrack struct {
+	// Encoded is the track to play, an explicit null in the request body stops the player.
+	Encoded    *string                `json:"encoded,omitempty"`
+	Identifier *string                `json:"identifier,omitempty"`
+	UserData   map[string]interface{} `json:"userData"`
+	// Whether the encoded field was present, used to tell null apart from a missing field.
+	encodedSet bool
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *UpdatePlayerTrack) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	type plain UpdatePlayerTrack
+	if err := json.Unmarshal(data, (*plain)(u)); err != nil {
+		return err
+	}
+	_, u.encodedSet = raw["encoded"]
+	return nil
+}
+
+// UpdatePlayer is the body of the update player request.
+type UpdatePlayer struct {
+	Track    *UpdatePlayerTrack     `json:"track"`
+	Position *int64                 `json:"position"`
+	EndTime  *int64                 `json:"endTime"`
+	Volume   *int                   `json:"volume"`
+	Paused   *bool                  `json:"paused"`
+	Filters  map[string]interface{} `json:"filters"`
+	Voice    *VoiceState            `json:"voice"`
+}
+
+// UpdateSession is the body of the update session request.
+type UpdateSession struct {
+	Resuming *bool  `json:"resuming"`
+	Timeout  *int64 `json:"timeout"`
+}
+
+// Memory contains the memory statistics of the node.
+type Memory struct {
+	Free       uint64 `json:"free"`
+	Used       uint64 `json:"used"`
+	Allocated  uint64 `json:"allocated"`
+	Reservable uint64 `json:"reservable"`
+}
+
+// CPU contains the cpu statistics of the node.
+type CPU struct {
+	Cores        int     `json:"cores"`
+	SystemLoad   float64 `json:"systemLoad"`
+	LavalinkLoad float64 `json:"lavalinkLoad"`
+}
+
+// FrameStats contains the frame statistics of the node's players.
+type FrameStats struct {
+	Sent    int64 `json:"sent"`
+	Nulled  int64 `json:"nulled"`
+	Deficit int64 `json:"deficit"`
+}
+
+// Stats contains the statistics of the node.
+type Stats struct {
+	Players        int         `json:"players"`
+	PlayingPlayers int         `json:"playingPlayers"`
+	Uptime         int64       `json:"uptime"`
+	Memory         Memory      `json:"memory"`
+	CPU            CPU         `json:"cpu"`
+	FrameStats     *FrameStats `json:"frameStats"`
+}
+
+// Version describes the version of the node.
+type Version struct {
+	Semver     string `json:"semver"`
+	Major      int    `json:"major"`
+	Minor      int    `json:"minor"`
+	Patch      int    `json:"patch"`
+	PreRelease string `json:"preRelease,omitempty"`
+}
+
+// Info is the response of the info endpoint.
+type Info struct {
+	Version        Version                  `json:"version"`
+	BuildTime      int64                    `json:"buildTime"`
+	Git            map[string]interface{}   `json:"git"`
+	JVM            string                   `json:"jvm"`
+	Lavaplayer     string                   `json:"lavaplayer"`
+	SourceManagers []string                 `json:"sourceManagers"`
+	Filters        []string                 `json:"filters"`
+	Plugins        []map[string]interface{} `json:"plugins"`
+}
+
+// Error is the body of error responses.
+type Error struct {
+	Timestamp int64  `json:"timestamp"`
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	Path      string `json:"path"`
+}
+
+// The websocket operations sent by the node.
+const (
+	OpReady        = "ready"
+	OpPlayerUpdate = "playerUpdate"
+	OpStats        = "stats"
+	OpEvent        = "event"
+)
+
+// The event types sent by the node.
+const (
+	EventTrackStart      = "TrackStartEvent"
+	EventTrackEnd        = "TrackEndEvent"
+	EventTrackException  = "TrackExceptionEvent"
+	EventTrackStuck      = "TrackStuckEvent"
+	EventWebSocketClosed = "WebSocketClosedEvent"
+)
+
+// ReadyMessage is sent once a websocket connection is established.
+type ReadyMessage struct {
+	Op        string `json:"op"`
+	Resumed   bool   `json:"resumed"`
+	SessionID string `json:"sessionId"`
+}
+
+// PlayerUpdateMessage is sent periodically with the state of a player.
+type PlayerUpdateMessage struct {
+	Op      string      `json:"op"`
+	GuildID string      `json:"guildId"`
+	State   PlayerState `json:"state"`
+}
+
+// StatsMessage is sent periodically with the statistics of the node.
+type StatsMessage struct {
+	Op string `json:"op"`
+	Stats
+}
+
+// EventMessage is sent when an event occurs in a player.
+//
+// Only the fields relevant to the event type are set.
+type EventMessage struct {
+	Op        string     `json:"op"`
+	Type      string     `json:"type"`
+	GuildID   string     `json:"guildId"`
+	Track     *Track     `json:"track,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Exception *Exception `json:"exception,omitempty"`
+	Threshold int64      `json:"thresholdMs,omitempty"`
+	Code      int        `json:"code,omitempty"`
+	ByRemote  bool       `json:"byRemote,omitempty"`
+}
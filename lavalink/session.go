@@ -0,0 +1,466 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lavalink
+
+import (
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/player"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+// session is a client session, it owns the players created by the client.
+//
+// A session outlives its websocket connection only if resuming was enabled.
+type session struct {
+	id     string
+	userID string
+	node   *Node
+	logger core.Logger
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	guilds   map[string]*guildPlayer
+	resuming bool
+	timeout  time.Duration
+	// Fires when a disconnected session should be destroyed.
+	expire *time.Timer
+
+	// Serializes writes to the websocket connection.
+	writeMu sync.Mutex
+}
+
+// newSession creates a new session.
+func newSession(n *Node, id, userID string) *session {
+	return &session{
+		id:      id,
+		userID:  userID,
+		node:    n,
+		logger:  core.With(n.Logger, core.F("session", id)),
+		guilds:  make(map[string]*guildPlayer),
+		timeout: 60 * time.Second,
+	}
+}
+
+// resumable returns whether the session is disconnected and waiting to be resumed.
+func (s *session) resumable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resuming && s.conn == nil
+}
+
+// attach attaches a websocket connection to the session and serves it until it is closed.
+func (s *session) attach(conn *websocket.Conn, resumed bool) {
+	s.mu.Lock()
+	s.conn = conn
+	if s.expire != nil {
+		s.expire.Stop()
+		s.expire = nil
+	}
+	s.mu.Unlock()
+	s.logger.Log(core.LevelInfo, "client connected", core.F("resumed", resumed))
+
+	s.send(ReadyMessage{Op: OpReady, Resumed: resumed, SessionID: s.id})
+	s.send(StatsMessage{Op: OpStats, Stats: s.node.Stats()})
+
+	closed := make(chan struct{})
+	go s.ticker(closed)
+	for {
+		// Clients are not expected to send anything, reading only detects the closure.
+		if _, _, err := conn.ReadMessage(); err != nil {
+			s.logger.Log(core.LevelInfo, "client disconnected", core.F(core.KeyError, err))
+			break
+		}
+	}
+	close(closed)
+	s.detach(conn)
+}
+
+// detach handles the closure of the websocket connection given.
+func (s *session) detach(conn *websocket.Conn) {
+	_ = conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != conn {
+		return
+	}
+	s.conn = nil
+	if s.resuming {
+		s.expire = time.AfterFunc(s.timeout, s.destroy)
+		return
+	}
+	go s.destroy()
+}
+
+// destroy destroys all of the session's players and removes it from the node.
+func (s *session) destroy() {
+	s.node.removeSession(s)
+	s.mu.Lock()
+	guilds := s.guilds
+	s.guilds = make(map[string]*guildPlayer)
+	s.mu.Unlock()
+	for _, p := range guilds {
+		p.destroy()
+	}
+}
+
+// ticker sends the periodic playerUpdate and stats messages until closed is closed.
+func (s *session) ticker(closed <-chan struct{}) {
+	updates := time.NewTicker(s.node.PlayerUpdateInterval)
+	defer updates.Stop()
+	stats := time.NewTicker(s.node.StatsInterval)
+	defer stats.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-updates.C:
+			s.mu.Lock()
+			guilds := make([]*guildPlayer, 0, len(s.guilds))
+			for _, p := range s.guilds {
+				guilds = append(guilds, p)
+			}
+			s.mu.Unlock()
+			for _, p := range guilds {
+				s.send(PlayerUpdateMessage{Op: OpPlayerUpdate, GuildID: p.guildID, State: p.state()})
+			}
+		case <-stats.C:
+			s.send(StatsMessage{Op: OpStats, Stats: s.node.Stats()})
+		}
+	}
+}
+
+// send sends a message over the websocket, messages are dropped while disconnected.
+func (s *session) send(v interface{}) {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if err := conn.WriteJSON(v); err != nil { // The read loop notices the closure.
+		s.logger.Log(core.LevelDebug, "sending a message failed", core.F(core.KeyError, err))
+	}
+}
+
+// update applies an UpdateSession request.
+func (s *session) update(u UpdateSession) UpdateSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.Resuming != nil {
+		s.resuming = *u.Resuming
+	}
+	if u.Timeout != nil {
+		s.timeout = time.Duration(*u.Timeout) * time.Second
+	}
+	timeout := int64(s.timeout / time.Second)
+	resuming := s.resuming
+	return UpdateSession{Resuming: &resuming, Timeout: &timeout}
+}
+
+// count returns the amount of players and the amount of players that are playing.
+func (s *session) count() (players, playing int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.guilds {
+		players++
+		if p.Track() != nil && !p.Paused() {
+			playing++
+		}
+	}
+	return
+}
+
+// player returns the player of the guild given, creating it if create is set.
+func (s *session) player(guildID string, create bool) (*guildPlayer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.guilds[guildID]; ok {
+		return p, nil
+	}
+	if !create {
+		return nil, errNotFound
+	}
+	p := &guildPlayer{
+		Player:  player.New(nil),
+		guildID: guildID,
+		session: s,
+		logger:  core.With(s.logger, core.F(core.KeyGuild, guildID)),
+	}
+	p.OnEvent = p.onEvent
+	p.Logger = p.logger
+	s.guilds[guildID] = p
+	return p, nil
+}
+
+// players returns the info of all of the session's players.
+func (s *session) players() []Player {
+	s.mu.Lock()
+	guilds := make([]*guildPlayer, 0, len(s.guilds))
+	for _, p := range s.guilds {
+		guilds = append(guilds, p)
+	}
+	s.mu.Unlock()
+	players := make([]Player, 0, len(guilds))
+	for _, p := range guilds {
+		players = append(players, p.info())
+	}
+	return players
+}
+
+// destroyPlayer destroys the player of the guild given.
+func (s *session) destroyPlayer(guildID string) {
+	s.mu.Lock()
+	p, ok := s.guilds[guildID]
+	delete(s.guilds, guildID)
+	s.mu.Unlock()
+	if ok {
+		p.destroy()
+	}
+}
+
+// guildPlayer is the player of a single guild.
+type guildPlayer struct {
+	*player.Player
+	guildID string
+	session *session
+	logger  core.Logger
+
+	mu      sync.Mutex
+	voice   VoiceState
+	conn    VoiceConnection
+	filters map[string]interface{}
+}
+
+// errUnknownSource is returned when playing a track of a source the node does not have.
+var errUnknownSource = errors.New("unknown source")
+
+// errNotTrack is returned when an identifier did not resolve to a single track.
+var errNotTrack = errors.New("identifier did not resolve to a track")
+
+// update applies an UpdatePlayer request.
+func (p *guildPlayer) update(u UpdatePlayer, noReplace bool) error {
+	if u.Voice != nil {
+		p.connect(*u.Voice)
+	}
+	if u.Volume != nil {
+		p.SetVolume(*u.Volume)
+	}
+	if u.Paused != nil {
+		p.Pause(*u.Paused)
+	}
+	if u.Filters != nil {
+		p.mu.Lock()
+		p.filters = u.Filters
+		p.mu.Unlock()
+	}
+	var start, end time.Duration
+	if u.Position != nil {
+		start = time.Duration(*u.Position) * time.Millisecond
+	}
+	if u.EndTime != nil {
+		end = time.Duration(*u.EndTime) * time.Millisecond
+	}
+	if u.Track != nil && (u.Track.encodedSet || u.Track.Identifier != nil) {
+		if u.Track.encodedSet && u.Track.Encoded == nil {
+			p.Stop()
+			return nil
+		}
+		track, err := p.resolve(u.Track)
+		if err != nil {
+			return err
+		}
+		if noReplace && p.Track() != nil {
+			return nil
+		}
+		p.Play(track, start, end)
+		return nil
+	}
+	if u.Position != nil && p.Track() != nil {
+		return p.Seek(start)
+	}
+	return nil
+}
+
+// resolve resolves the track of an update request.
+func (p *guildPlayer) resolve(u *UpdatePlayerTrack) (*sourceTrack, error) {
+	var track Track
+	if u.Encoded != nil {
+		t, err := DecodeEncodedTrack(*u.Encoded)
+		if err != nil {
+			return nil, err
+		}
+		track = t
+	} else {
+		res := p.session.node.LoadTracks(*u.Identifier)
+		t, ok := res.Data.(Track)
+		if !ok {
+			return nil, errNotTrack
+		}
+		track = t
+	}
+	if u.UserData != nil {
+		track.UserData = u.UserData
+	}
+	source := p.session.node.source(track.Info.SourceName)
+	if source == nil {
+		return nil, errUnknownSource
+	}
+	return &sourceTrack{Track: track, source: source}, nil
+}
+
+// connect connects to the voice server in the background, replacing the current connection.
+func (p *guildPlayer) connect(state VoiceState) {
+	p.mu.Lock()
+	p.voice = state
+	old := p.conn
+	p.conn = nil
+	p.mu.Unlock()
+	p.SetSink(nil)
+	if old != nil {
+		p.closeVoice(old)
+	}
+	dial := p.session.node.Dial
+	if dial == nil {
+		return
+	}
+	go func() {
+		conn, err := dial(p.guildID, p.session.userID, state)
+		if err != nil {
+			p.logger.Log(core.LevelWarn, "connecting to the voice server failed", core.F(core.KeyError, err))
+			p.session.send(EventMessage{
+				Op:      OpEvent,
+				Type:    EventWebSocketClosed,
+				GuildID: p.guildID,
+				Code:    4000,
+				Reason:  err.Error(),
+			})
+			return
+		}
+		p.mu.Lock()
+		if p.voice != state {
+			p.mu.Unlock()
+			p.closeVoice(conn)
+			return
+		}
+		p.conn = conn
+		p.mu.Unlock()
+		p.SetSink(conn)
+	}()
+}
+
+// destroy stops the player and closes its voice connection.
+func (p *guildPlayer) destroy() {
+	_ = p.Close()
+	p.mu.Lock()
+	conn := p.conn
+	p.conn = nil
+	p.voice = VoiceState{}
+	p.mu.Unlock()
+	if conn != nil {
+		p.closeVoice(conn)
+	}
+}
+
+// closeVoice closes a voice connection that is no longer used.
+func (p *guildPlayer) closeVoice(conn VoiceConnection) {
+	if err := conn.Close(); err != nil {
+		p.logger.Log(core.LevelDebug, "closing the voice connection failed", core.F(core.KeyError, err))
+	}
+}
+
+// state returns the current state of the player.
+func (p *guildPlayer) state() PlayerState {
+	p.mu.Lock()
+	connected := p.conn != nil
+	p.mu.Unlock()
+	ping := int64(-1)
+	if connected {
+		ping = 0
+	}
+	return PlayerState{
+		Time:      time.Now().UnixNano() / int64(time.Millisecond),
+		Position:  int64(p.Position() / time.Millisecond),
+		Connected: connected,
+		Ping:      ping,
+	}
+}
+
+// info returns the player as sent over the protocol.
+func (p *guildPlayer) info() Player {
+	info := Player{
+		GuildID: p.guildID,
+		Volume:  p.Volume(),
+		Paused:  p.Paused(),
+		State:   p.state(),
+		Filters: map[string]interface{}{},
+	}
+	if t, ok := p.Track().(*sourceTrack); ok {
+		track := t.Track
+		track.Info.Position = info.State.Position
+		info.Track = &track
+	}
+	p.mu.Lock()
+	info.Voice = p.voice
+	if p.filters != nil {
+		info.Filters = p.filters
+	}
+	p.mu.Unlock()
+	return info
+}
+
+// onEvent forwards the player's events to the session.
+func (p *guildPlayer) onEvent(e player.Event) {
+	msg := EventMessage{Op: OpEvent, GuildID: p.guildID}
+	if t, ok := e.EventTrack().(*sourceTrack); ok {
+		track := t.Track
+		msg.Track = &track
+	}
+	switch e := e.(type) {
+	case player.TrackStartEvent:
+		msg.Type = EventTrackStart
+	case player.TrackEndEvent:
+		msg.Type = EventTrackEnd
+		msg.Reason = string(e.Reason)
+	case player.TrackExceptionEvent:
+		msg.Type = EventTrackException
+		msg.Exception = &Exception{
+			Message:  e.Err.Error(),
+			Severity: SeverityCommon,
+			Cause:    e.Err.Error(),
+		}
+	case player.TrackStuckEvent:
+		msg.Type = EventTrackStuck
+		msg.Threshold = int64(e.Threshold / time.Millisecond)
+	default:
+		// Voice failures are reported by the voice connection itself.
+		return
+	}
+	p.session.send(msg)
+}
@@ -0,0 +1,146 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lavalink
+
+import (
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/youtube"
+	"time"
+)
+
+// ErrNoMatches is returned by a Source when it can't load the identifier given.
+var ErrNoMatches = errors.New("no matches")
+
+// Source resolves identifiers into tracks and opens the tracks it resolved.
+type Source interface {
+	// Name returns the name of the source, stored in the encoded tracks.
+	Name() string
+	// Load loads the identifier given, returning ErrNoMatches if it doesn't belong to this source.
+	Load(identifier string) (LoadResult, error)
+	// Open returns a Playable of the track given.
+	Open(info TrackInfo) (core.Playable, error)
+}
+
+// sourceTrack is a core.Track that is opened by the source that loaded it.
+type sourceTrack struct {
+	Track
+	source Source
+}
+
+// Playable returns a new Playable matching this track.
+func (t *sourceTrack) Playable() (core.Playable, error) {
+	return t.source.Open(t.Info)
+}
+
+// Bitrate returns the bitrate, which is unknown before the track is opened.
+func (t *sourceTrack) Bitrate() int {
+	return 0
+}
+
+// Codec returns the codec.
+func (t *sourceTrack) Codec() string {
+	return "opus"
+}
+
+// Duration returns the duration of the track.
+func (t *sourceTrack) Duration() time.Duration {
+	return time.Duration(t.Info.Length) * time.Millisecond
+}
+
+// NewTrack encodes the info given into a Track.
+func NewTrack(info TrackInfo) (Track, error) {
+	encoded, err := EncodeTrack(info)
+	if err != nil {
+		return Track{}, err
+	}
+	return Track{
+		Encoded:    encoded,
+		Info:       info,
+		PluginInfo: map[string]interface{}{},
+		UserData:   map[string]interface{}{},
+	}, nil
+}
+
+// YoutubeSource is a Source loading youtube videos.
+type YoutubeSource struct {
+	*youtube.Source
+}
+
+// NewYoutubeSource creates a new YoutubeSource using the youtube source given.
+func NewYoutubeSource(source *youtube.Source) *YoutubeSource {
+	return &YoutubeSource{Source: source}
+}
+
+// Name implements Source.
+func (yt *YoutubeSource) Name() string {
+	return "youtube"
+}
+
+// YoutubeTrackInfo converts a youtube track into a TrackInfo.
+func YoutubeTrackInfo(track *youtube.Track) TrackInfo {
+	uri := "https://www.youtube.com/watch?v=" + track.VideoId
+	artwork := "https://i.ytimg.com/vi/" + track.VideoId + "/hqdefault.jpg"
+	length := int64(track.Length / time.Millisecond)
+	if track.IsStream {
+		length = 1<<63 - 1
+	}
+	return TrackInfo{
+		Identifier: track.VideoId,
+		IsSeekable: !track.IsStream,
+		Author:     track.Author,
+		Length:     length,
+		IsStream:   track.IsStream,
+		Title:      track.Title,
+		URI:        &uri,
+		ArtworkURL: &artwork,
+		SourceName: "youtube",
+	}
+}
+
+// Load implements Source.
+func (yt *YoutubeSource) Load(identifier string) (LoadResult, error) {
+	if !yt.CheckVideoUrl(identifier) {
+		return LoadResult{}, ErrNoMatches
+	}
+	track, err := yt.PlayVideoUrl(identifier)
+	if err != nil {
+		return LoadResult{}, err
+	}
+	t, err := NewTrack(YoutubeTrackInfo(track))
+	if err != nil {
+		return LoadResult{}, err
+	}
+	return LoadResult{LoadType: LoadTrack, Data: t}, nil
+}
+
+// Open implements Source.
+func (yt *YoutubeSource) Open(info TrackInfo) (core.Playable, error) {
+	track, err := yt.PlayVideo(info.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	return track.PlaySeekable()
+}
@@ -0,0 +1,202 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package lavalink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// trackVersion is the version of the encoded track format written.
+const trackVersion = 3
+
+// versionedFlag marks a message header that contains a version byte.
+const versionedFlag = 1
+
+// ErrInvalidTrack is returned when decoding a malformed encoded track.
+var ErrInvalidTrack = errors.New("invalid encoded track")
+
+// TrackInfo contains the metadata of a track.
+//
+// See: https://lavalink.dev/api/rest.html#track-info
+type TrackInfo struct {
+	Identifier string  `json:"identifier"`
+	IsSeekable bool    `json:"isSeekable"`
+	Author     string  `json:"author"`
+	Length     int64   `json:"length"`
+	IsStream   bool    `json:"isStream"`
+	Position   int64   `json:"position"`
+	Title      string  `json:"title"`
+	URI        *string `json:"uri"`
+	ArtworkURL *string `json:"artworkUrl"`
+	ISRC       *string `json:"isrc"`
+	SourceName string  `json:"sourceName"`
+}
+
+// trackWriter writes the fields of an encoded track in the format used by lavaplayer (Java's DataOutput).
+type trackWriter struct {
+	bytes.Buffer
+}
+
+func (w *trackWriter) writeUTF(s string) {
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(s)))
+	w.Write(l[:])
+	w.WriteString(s)
+}
+
+func (w *trackWriter) writeNullableUTF(s *string) {
+	w.writeBool(s != nil)
+	if s != nil {
+		w.writeUTF(*s)
+	}
+}
+
+func (w *trackWriter) writeBool(b bool) {
+	if b {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+}
+
+func (w *trackWriter) writeLong(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.Write(b[:])
+}
+
+// EncodeTrack encodes the track info given into the base64 format used by Lavalink.
+func EncodeTrack(info TrackInfo) (string, error) {
+	var body trackWriter
+	body.WriteByte(trackVersion)
+	body.writeUTF(info.Title)
+	body.writeUTF(info.Author)
+	body.writeLong(info.Length)
+	body.writeUTF(info.Identifier)
+	body.writeBool(info.IsStream)
+	body.writeNullableUTF(info.URI)
+	body.writeNullableUTF(info.ArtworkURL)
+	body.writeNullableUTF(info.ISRC)
+	body.writeUTF(info.SourceName)
+	body.writeLong(info.Position)
+	if body.Len() > 1<<30-1 {
+		return "", ErrInvalidTrack
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(body.Len())|versionedFlag<<30)
+	return base64.StdEncoding.EncodeToString(append(header[:], body.Bytes()...)), nil
+}
+
+// trackReader reads the fields of an encoded track, keeping the first error encountered.
+type trackReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (r *trackReader) read(n int) []byte {
+	if r.err != nil {
+		return make([]byte, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.err = ErrInvalidTrack
+	}
+	return b
+}
+
+func (r *trackReader) readUTF() string {
+	l := binary.BigEndian.Uint16(r.read(2))
+	return string(r.read(int(l)))
+}
+
+func (r *trackReader) readNullableUTF() *string {
+	if !r.readBool() {
+		return nil
+	}
+	s := r.readUTF()
+	return &s
+}
+
+func (r *trackReader) readBool() bool {
+	return r.read(1)[0] != 0
+}
+
+func (r *trackReader) readLong() int64 {
+	return int64(binary.BigEndian.Uint64(r.read(8)))
+}
+
+// DecodeTrack decodes a track encoded by Lavalink or by EncodeTrack.
+//
+// Versions 1 to 3 of the format are supported.
+func DecodeTrack(encoded string) (TrackInfo, error) {
+	var info TrackInfo
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return info, ErrInvalidTrack
+	}
+	if len(data) < 4 {
+		return info, ErrInvalidTrack
+	}
+	header := binary.BigEndian.Uint32(data)
+	if int(header&(1<<30-1)) != len(data)-4 {
+		return info, ErrInvalidTrack
+	}
+	r := &trackReader{r: bytes.NewReader(data[4:])}
+	version := 1
+	if header>>30&versionedFlag != 0 {
+		version = int(r.read(1)[0])
+	}
+	if version < 1 || version > 3 {
+		return info, ErrInvalidTrack
+	}
+	info.Title = r.readUTF()
+	info.Author = r.readUTF()
+	info.Length = r.readLong()
+	info.Identifier = r.readUTF()
+	info.IsStream = r.readBool()
+	if version >= 2 {
+		info.URI = r.readNullableUTF()
+	}
+	if version >= 3 {
+		info.ArtworkURL = r.readNullableUTF()
+		info.ISRC = r.readNullableUTF()
+	}
+	info.SourceName = r.readUTF()
+	// Source specific fields would be here, none of the supported sources has any.
+	if r.r.Len() < 8 {
+		return info, ErrInvalidTrack
+	}
+	_, _ = r.r.Seek(-8, io.SeekEnd)
+	info.Position = r.readLong()
+	if r.err != nil {
+		return info, r.err
+	}
+	info.IsSeekable = !info.IsStream
+	return info, nil
+}
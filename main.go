@@ -26,71 +26,194 @@ SOFTWARE.
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"github.com/bwmarrin/discordgo"
+	"github.com/dondish/lionplayer/bot"
 	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/metrics"
 	"github.com/dondish/lionplayer/youtube"
+	"log"
+	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
-	"strconv"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
-var (
-	seekPattern, _ = regexp.Compile("(?:([0-9]{1,2})h)?(?:([0-9]{1,2})m)?(?:([0-9]{1,2})s)?") // A pattern to seek
-)
-
 func init() {
-	flag.StringVar(&token, "t", "", "Bot Token")
+	flag.StringVar(&configPath, "c", "config.json", "The config file")
+	flag.StringVar(&token, "t", "", "Bot Token, overrides the one in the config file")
 	flag.Parse()
 }
 
+var configPath string
 var token string
 
-var ytsrc = youtube.New(nil)
-var tracks = make(map[string]core.Playable)
-var lastpacket core.Packet
+// identifyInterval is the time Discord requires between opening the sessions of two shards.
+const identifyInterval = 5 * time.Second
+
+var lion *bot.Supervisor
+
+// logger logs to the standard error, the level is set once the config file is read.
+var logger = &core.StdLogger{Logger: log.New(os.Stderr, "", log.LstdFlags), Level: core.LevelInfo}
+
+// restored makes sure the saved players of each shard are restored only on its first ready event.
+var restored sync.Map
 
 func main() {
-	if token == "" {
-		fmt.Println("No token provided. Please run: airhorn -t <bot token>")
+	config, err := bot.LoadConfig(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Log(core.LevelError, "reading the config file failed", core.F(core.KeyError, err))
+		return
+	}
+	logger.Level = config.Level()
+	core.DefaultLogger = logger
+
+	// Every package that isn't given its own metrics measures into the registry served.
+	registry := metrics.New()
+	core.DefaultMetrics = registry
+	if token != "" {
+		config.Token = token
+	}
+	if config.Token == "" {
+		logger.Log(core.LevelError, "no token provided, run lionplayer -t <bot token> or set the token in the config file", core.F("config", configPath))
+		return
+	}
+
+	// Every source that isn't given its own client uses the configured one.
+	client, err := config.HTTP.Client()
+	if err != nil {
+		logger.Log(core.LevelError, "creating the HTTP client failed", core.F(core.KeyError, err))
 		return
 	}
+	core.DefaultHTTPClient = client
 
-	// Create a new Discord session using the provided bot token.
-	dg, err := discordgo.New("Bot " + token)
+	// Discord recommends a number of shards unless it is set.
+	count := config.Shards.Count
+	if count == 0 {
+		if count, err = bot.RecommendedShards(config.Token); err != nil {
+			logger.Log(core.LevelError, "getting the recommended number of shards failed", core.F(core.KeyError, err))
+			return
+		}
+	}
+	shards, err := config.Shards.Shards(count)
 	if err != nil {
-		fmt.Println("Error creating Discord session: ", err)
+		logger.Log(core.LevelError, "reading the shards failed", core.F(core.KeyError, err))
 		return
 	}
 
+	// Every shard has a Discord session and a bot of its own, which owns the voice connection, player and queue
+	// of every guild of the shard.
+	var sessions []*discordgo.Session
+	connect := func(shard bot.Shard) (bot.Session, bot.VoiceJoiner, error) {
+		dg, err := discordgo.New("Bot " + config.Token)
+		if err != nil {
+			return nil, nil, err
+		}
+		dg.ShardID, dg.ShardCount = shard.ID, shard.Count
+		addHandlers(dg)
+		sessions = append(sessions, dg)
+		return bot.NewDiscordSession(dg), bot.DiscordVoice(dg), nil
+	}
+	lion, err = bot.NewSupervisor(config, shards, connect, bot.YoutubeLoader{Source: youtube.New(client)})
+	if err != nil {
+		logger.Log(core.LevelError, "creating the bot failed", core.F(core.KeyError, err))
+		return
+	}
+
+	// Serve the API dashboards control the players with.
+	var api *http.Server
+	if config.API.Address != "" {
+		if config.API.Token == "" {
+			logger.Log(core.LevelWarn, "not serving the API, it needs a token")
+		} else {
+			api = &http.Server{Addr: config.API.Address, Handler: lion.API(config.API.Token)}
+			go func() {
+				if err := api.ListenAndServe(); err != http.ErrServerClosed {
+					logger.Log(core.LevelError, "serving the API failed", core.F(core.KeyError, err))
+				}
+			}()
+		}
+	}
+
+	// Serve the metrics and the health checks.
+	var metricsServer *http.Server
+	if config.Metrics.Address != "" {
+		metricsServer = &http.Server{Addr: config.Metrics.Address, Handler: lion.MetricsHandler(registry)}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Log(core.LevelError, "serving the metrics failed", core.F(core.KeyError, err))
+			}
+		}()
+	}
+
+	// Open the websockets and begin listening, Discord allows identifying a shard every identifyInterval.
+	for i, dg := range sessions {
+		if i > 0 {
+			time.Sleep(identifyInterval)
+		}
+		if err := dg.Open(); err != nil {
+			logger.Log(core.LevelError, "opening the Discord session failed", core.F("shard", dg.ShardID), core.F(core.KeyError, err))
+		}
+	}
+
+	// Wait here until CTRL-C or other term signal is received.
+	logger.Log(core.LevelInfo, "Lionplayer is now running, press CTRL-C to exit", core.F("shards", len(shards)))
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
+	<-sc
+
+	// Shut the shards down, they stop handling commands, save the players and leave all of the voice channels
+	// before the API and the Discord sessions are closed.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout))
+	defer cancel()
+	if err := lion.Shutdown(ctx); err != nil {
+		logger.Log(core.LevelError, "shutting down failed", core.F(core.KeyError, err))
+	}
+	if api != nil && api.Shutdown(ctx) != nil {
+		_ = api.Close()
+	}
+	if metricsServer != nil && metricsServer.Shutdown(ctx) != nil {
+		_ = metricsServer.Close()
+	}
+	for _, dg := range sessions {
+		_ = dg.Close()
+	}
+}
+
+// addHandlers registers the handlers of the events of a shard's Discord session.
+func addHandlers(dg *discordgo.Session) {
 	// Register ready as a callback for the ready events.
 	dg.AddHandler(ready)
 
 	// Register messageCreate as a callback for the messageCreate events.
 	dg.AddHandler(messageCreate)
 
+	// Register messageReactionAdd so search results can be picked by reacting.
+	dg.AddHandler(messageReactionAdd)
+
 	// Register guildCreate as a callback for the guildCreate events.
 	dg.AddHandler(guildCreate)
 
-	// Open the websocket and begin listening.
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("Error opening Discord session: ", err)
-	}
+	// Register guildDelete and voiceStateUpdate to clean up after leaving.
+	dg.AddHandler(guildDelete)
+	dg.AddHandler(voiceStateUpdate)
 
-	// Wait here until CTRL-C or other term signal is received.
-	fmt.Println("Lionplayer is now running.  Press CTRL-C to exit.")
-	sc := make(chan os.Signal, 1)
-	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
-	<-sc
+	// Register disconnect and resumed to report whether the shard is ready.
+	dg.AddHandler(disconnect)
+	dg.AddHandler(resumed)
+}
 
-	// Cleanly close down the Discord session.
-	dg.Close()
+// shard returns the bot of the shard of the Discord session given.
+func shard(s *discordgo.Session) *bot.Bot {
+	for _, b := range lion.Shards {
+		if b.Shard.ID == s.ShardID {
+			return b
+		}
+	}
+	return nil
 }
 
 // This function will be called (due to AddHandler above) when the bot receives
@@ -99,6 +222,30 @@ func ready(s *discordgo.Session, event *discordgo.Ready) {
 
 	// Set the playing status.
 	s.UpdateStatus(0, "Playing music using Go only!")
+
+	b := shard(s)
+	b.SetReady(true)
+
+	// Rejoin the voice channels and resume the players saved before the last shutdown.
+	if _, loaded := restored.LoadOrStore(s.ShardID, true); !loaded {
+		go func() {
+			if err := b.RestoreState(); err != nil {
+				logger.Log(core.LevelError, "restoring the state failed", core.F("shard", s.ShardID), core.F(core.KeyError, err))
+			}
+		}()
+	}
+}
+
+// This function will be called (due to AddHandler above) when the connection
+// to Discord is lost.
+func disconnect(s *discordgo.Session, event *discordgo.Disconnect) {
+	shard(s).SetReady(false)
+}
+
+// This function will be called (due to AddHandler above) when the connection
+// to Discord is resumed after it was lost.
+func resumed(s *discordgo.Session, event *discordgo.Resumed) {
+	shard(s).SetReady(true)
 }
 
 // This function will be called (due to AddHandler above) every time a new
@@ -110,121 +257,17 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	// check if the message is "!airhorn"
-	track, ok := tracks[m.GuildID]
-	if strings.HasPrefix(m.Content, "!!play") && !ok {
-		// Find the channel that the message came from.
-		c, err := s.State.Channel(m.ChannelID)
-		if err != nil {
-			// Could not find channel.
-			return
-		}
-
-		splut := strings.Split(m.Content, " ")
-
-		if len(splut) == 1 || !ytsrc.CheckVideoUrl(strings.TrimSpace(splut[1])) {
-			_, err := s.ChannelMessageSend(c.ID, "Please provide a correct url")
-			if err != nil {
-				return
-			}
-			return
-		}
-
-		videoID, err := ytsrc.ExtractVideoId(strings.TrimSpace(splut[1]))
-
-		if err != nil {
-			return
-		}
-
-		// Find the guild for that channel.
-		g, err := s.State.Guild(c.GuildID)
-		if err != nil {
-			// Could not find guild.
-			return
-		}
-
-		// Look for the message sender in that guild's current voice states.
-		for _, vs := range g.VoiceStates {
-			if vs.UserID == m.Author.ID {
-				err = playSound(s, g.ID, vs.ChannelID, videoID, c.ID)
-				if err != nil {
-					fmt.Println("Error playing sound:", err)
-				}
-
-				return
-			}
-		}
-	} else if strings.HasPrefix(m.Content, "!!stop") {
-		if track != nil {
-			track.Close()
-		}
-	} else if strings.HasPrefix(m.Content, "!!seek") {
-		// Find the channel that the message came from.
-		c, err := s.State.Channel(m.ChannelID)
-		if err != nil {
-			// Could not find channel.
-			return
-		}
-
-		if track == nil {
-			_, err := s.ChannelMessageSend(c.ID, "Not playing anything")
-			if err != nil {
-				return
-			}
-			return
-
-		}
-
-		splut := strings.Split(m.Content, " ")
-
-		if len(splut) == 1 || !seekPattern.MatchString(strings.TrimSpace(splut[1])) {
-			_, err := s.ChannelMessageSend(c.ID, "Please provide a correct seek")
-			if err != nil {
-				return
-			}
-			return
-		}
-		matches := seekPattern.FindStringSubmatch(strings.TrimSpace(splut[1]))
-		var hour, minute, second int
-		if matches[1] != "" {
-			hour, _ = strconv.Atoi(matches[1])
-		}
-		if matches[2] != "" {
-			minute, _ = strconv.Atoi(matches[2])
-		}
-		if matches[3] != "" {
-			second, _ = strconv.Atoi(matches[3])
-		}
-		ms := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
-		trackseek, ok := track.(core.PlaySeekable)
-		if ok {
-			_ = trackseek.Seek(ms)
-		} else {
-			_, _ = s.ChannelMessageSend(c.ID, "Track is not seekable")
-			return
-		}
-	} else if strings.HasPrefix(m.Content, "!!pause") {
-		if track != nil {
-			track.Pause(true)
-		}
-	} else if strings.HasPrefix(m.Content, "!!unpause") || strings.HasPrefix(m.Content, "!resume") {
-		if track != nil {
-			track.Pause(false)
-		}
-	} else if strings.HasPrefix(m.Content, "!!position") {
-		c, err := s.State.Channel(m.ChannelID)
-		if err != nil {
-			// Could not find channel.
-			return
-		}
+	shard(s).HandleMessage(bot.DiscordMessage(m.Message))
+}
 
-		if track != nil {
-			_, err = s.ChannelMessageSend(c.ID, lastpacket.Timecode.String())
-			if err != nil {
-				return
-			}
-		}
+// This function will be called (due to AddHandler above) every time a
+// reaction is added to a message.
+func messageReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.State.User.ID {
+		return
 	}
+
+	shard(s).HandleReaction(bot.DiscordReaction(r.MessageReaction))
 }
 
 // This function will be called (due to AddHandler above) every time a new
@@ -237,75 +280,26 @@ func guildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
 
 	for _, channel := range event.Guild.Channels {
 		if channel.ID == event.Guild.ID {
-			_, _ = s.ChannelMessageSend(channel.ID, "Airhorn is ready! Type !airhorn while in a voice channel to play a sound.")
+			_, _ = s.ChannelMessageSend(channel.ID, "Lionplayer is ready! Type "+lion.Settings.Get(event.Guild.ID).Prefix+"help to see what it can do.")
 			return
 		}
 	}
 }
 
-// loadSound attempts to load an encoded sound file from disk.
-
-// playSound plays the current buffer to the provided channel.
-func playSound(s *discordgo.Session, guildID, channelID, videoID, msgchannel string) (err error) {
-
-	// Join the provided voice channel.
-	vc, err := s.ChannelVoiceJoin(guildID, channelID, false, true)
-	if err != nil {
-		return err
+// guildDelete destroys the player of a guild the bot was removed from.
+func guildDelete(s *discordgo.Session, event *discordgo.GuildDelete) {
+	if !event.Unavailable {
+		shard(s).Manager.Remove(event.ID)
 	}
+}
 
-	// Sleep for a specified amount of time before playing the sound
-	time.Sleep(250 * time.Millisecond)
-
-	// Start speaking.
-	vc.Speaking(true)
-
-	defer func() {
-		// Stop speaking
-		vc.Speaking(false)
-
-		// Sleep for a specificed amount of time before ending.
-		time.Sleep(250 * time.Millisecond)
-
-		// Disconnect from the provided voice channel.
-		vc.Disconnect()
-	}()
-
-	trac, err := ytsrc.PlayVideo(videoID)
-	if err != nil {
-		return err
-	}
-
-	if trac.IsStream {
-		_, err = s.ChannelMessageSend(msgchannel, fmt.Sprintf("Now Playing - %s - %s [LIVE]", trac.Title, trac.Author))
-	} else {
-		_, err = s.ChannelMessageSend(msgchannel, fmt.Sprintf("Now Playing - %s - %s [%s]", trac.Title, trac.Author, trac.Length))
-	}
-	if err != nil {
-		return err
-	}
-	file, err := trac.PlaySeekable()
-
-	if err != nil {
-		return err
-	}
-	tracks[guildID] = file
-	go file.Play()
-	c := file.Chan()
-	for {
-		packet, ok := <-c
-		lastpacket = packet
-		// If this is the end of the file, just return.
-		if !ok {
-			_ = file.Close()
-			break
-		}
-
-		// Append encoded pcm data to the buffer.
-		vc.OpusSend <- packet.Data
-	}
-
-	delete(tracks, guildID)
-
-	return nil
+// voiceStateUpdate lets the bot know when it was moved or disconnected, and when users join
+// or leave so it can pause and leave when nobody listens.
+func voiceStateUpdate(s *discordgo.Session, event *discordgo.VoiceStateUpdate) {
+	shard(s).HandleVoiceState(bot.VoiceState{
+		GuildID:   event.GuildID,
+		UserID:    event.UserID,
+		ChannelID: event.ChannelID,
+		Self:      event.UserID == s.State.User.ID,
+	})
 }
@@ -0,0 +1,334 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package metrics collects the measurements of lionplayer and exposes them in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"github.com/dondish/lionplayer/core"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind is the type of a metric.
+type Kind int
+
+// The kinds of metrics.
+const (
+	Counter Kind = iota
+	Gauge
+	Histogram
+)
+
+// String returns the name Prometheus uses for the kind.
+func (k Kind) String() string {
+	switch k {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case Histogram:
+		return "histogram"
+	}
+	return "untyped"
+}
+
+// DefaultBuckets are the upper bounds of the buckets of histograms that don't set theirs, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Desc describes a metric.
+type Desc struct {
+	Name string
+	Help string
+	Kind Kind
+	// Buckets are the upper bounds of the buckets of a histogram, DefaultBuckets if nil.
+	Buckets []float64
+}
+
+// Descs describes the metrics the packages of lionplayer measure.
+var Descs = []Desc{
+	{Name: core.MetricLoadSeconds, Help: "Time loading a track took in seconds.", Kind: Histogram},
+	{Name: core.MetricLoadFailures, Help: "Tracks that failed to load.", Kind: Counter},
+	{Name: core.MetricActivePlayers, Help: "Players that exist.", Kind: Gauge},
+	{Name: core.MetricPacketsSent, Help: "Packets sent to voice connections.", Kind: Counter},
+	{Name: core.MetricUnderruns, Help: "Times a track had no packet ready when its voice connection wanted one.", Kind: Counter},
+	{Name: core.MetricSeeks, Help: "Seeks of the players.", Kind: Counter},
+	{Name: core.MetricHTTPRequests, Help: "Requests of HTTP streams.", Kind: Counter},
+	{Name: core.MetricHTTPBytes, Help: "Bytes HTTP streams received.", Kind: Counter},
+	{Name: core.MetricHTTPRetries, Help: "Requests of HTTP streams retried after failing.", Kind: Counter},
+}
+
+// series is a metric with a set of labels.
+type series struct {
+	labels []core.Label
+	value  float64
+	// The counts of the buckets of a histogram, not cumulative, and the count and sum of its samples.
+	buckets []uint64
+	count   uint64
+}
+
+// family is a metric with all of its series.
+type family struct {
+	Desc
+	series map[string]*series
+}
+
+// Registry collects measurements, it implements core.Metrics and serves them as http.Handler.
+//
+// Measurements of metrics that weren't described create them, with the kind the measurement implies.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// New creates a Registry describing Descs.
+func New() *Registry {
+	r := &Registry{families: make(map[string]*family)}
+	for _, d := range Descs {
+		r.Describe(d)
+	}
+	return r
+}
+
+// Describe adds a metric to the registry, replacing the description of a metric with the same name.
+//
+// Changing the kind or the buckets of a metric drops its series, since their values can't be converted.
+func (r *Registry) Describe(d Desc) {
+	if d.Kind == Histogram && d.Buckets == nil {
+		d.Buckets = DefaultBuckets
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[d.Name]; ok {
+		if f.Kind != d.Kind || !equalBuckets(f.Buckets, d.Buckets) {
+			f.series = make(map[string]*series)
+		}
+		f.Desc = d
+		return
+	}
+	r.families[d.Name] = &family{Desc: d, series: make(map[string]*series)}
+}
+
+// equalBuckets reports whether two histograms have the same buckets.
+func equalBuckets(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the series of the labels given, creating it if needed, mu must be held.
+func (r *Registry) get(name string, kind Kind, labels []core.Label) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{Desc: Desc{Name: name, Kind: kind}, series: make(map[string]*series)}
+		if kind == Histogram {
+			f.Buckets = DefaultBuckets
+		}
+		r.families[name] = f
+	}
+	labels = append([]core.Label(nil), labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	var key strings.Builder
+	for _, l := range labels {
+		key.WriteString(l.Name)
+		key.WriteByte(0)
+		key.WriteString(l.Value)
+		key.WriteByte(0)
+	}
+	s, ok := f.series[key.String()]
+	if !ok {
+		s = &series{labels: labels}
+		if f.Kind == Histogram {
+			s.buckets = make([]uint64, len(f.Buckets))
+		}
+		f.series[key.String()] = s
+	}
+	return s
+}
+
+// Add implements core.Metrics.
+func (r *Registry) Add(name string, delta float64, labels ...core.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, Counter, labels).value += delta
+}
+
+// Set implements core.Metrics.
+func (r *Registry) Set(name string, value float64, labels ...core.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, Gauge, labels).value = value
+}
+
+// Observe implements core.Metrics.
+func (r *Registry) Observe(name string, value float64, labels ...core.Label) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.get(name, Histogram, labels)
+	if s.buckets == nil { // Not a histogram
+		return
+	}
+	buckets := r.families[name].Buckets
+	if i := sort.SearchFloat64s(buckets, value); i < len(s.buckets) {
+		s.buckets[i]++
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		if f.Help != "" {
+			cw.write("# HELP ", name, " ", escapeHelp(f.Help), "\n")
+		}
+		cw.write("# TYPE ", name, " ", f.Kind.String(), "\n")
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.Kind != Histogram {
+				cw.write(name, formatLabels(s.labels, ""), " ", formatFloat(s.value), "\n")
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range f.Buckets {
+				cumulative += s.buckets[i]
+				cw.write(name, "_bucket", formatLabels(s.labels, formatFloat(bound)), " ", strconv.FormatUint(cumulative, 10), "\n")
+			}
+			cw.write(name, "_bucket", formatLabels(s.labels, "+Inf"), " ", strconv.FormatUint(s.count, 10), "\n")
+			cw.write(name, "_sum", formatLabels(s.labels, ""), " ", formatFloat(s.value), "\n")
+			cw.write(name, "_count", formatLabels(s.labels, ""), " ", strconv.FormatUint(s.count, 10), "\n")
+		}
+	}
+	r.mu.Unlock()
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// countingWriter writes strings, counting the bytes written and keeping the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// write writes the strings given one after another.
+func (cw *countingWriter) write(parts ...string) {
+	for _, part := range parts {
+		if cw.err != nil {
+			return
+		}
+		n, err := cw.w.WriteString(part)
+		cw.n += int64(n)
+		cw.err = err
+	}
+}
+
+// formatLabels formats labels like {a="b",c="d"}, adding the le label of histogram buckets unless it is empty.
+func formatLabels(labels []core.Label, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l.Name)
+		sb.WriteString(`="`)
+		sb.WriteString(labelEscaper.Replace(l.Value))
+		sb.WriteByte('"')
+	}
+	if le != "" {
+		if len(labels) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`le="`)
+		sb.WriteString(le)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// escapeHelp escapes the help text of a metric.
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+// formatFloat formats a value the way Prometheus parses it.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,109 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"github.com/dondish/lionplayer/core"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{families: make(map[string]*family)}
+	r.Describe(Desc{Name: "loads", Help: "Loads.\nIn seconds.", Kind: Histogram, Buckets: []float64{0.1, 1}})
+	r.Observe("loads", 0.05, core.L("source", "youtube"))
+	r.Observe("loads", 0.5, core.L("source", "youtube"))
+	r.Observe("loads", 3, core.L("source", "youtube"))
+	r.Add("requests", 1, core.L("code", "200"), core.L("a", `"quoted"`))
+	r.Add("requests", 2, core.L("a", `"quoted"`), core.L("code", "200"))
+	r.Set("players", 2)
+	r.Set("players", 1)
+	r.Observe("players", 1)
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, int64(buf.Len()), n, "the bytes written should be counted")
+	assert.Equal(t, `# HELP loads Loads.\nIn seconds.
+# TYPE loads histogram
+loads_bucket{source="youtube",le="0.1"} 1
+loads_bucket{source="youtube",le="1"} 2
+loads_bucket{source="youtube",le="+Inf"} 3
+loads_sum{source="youtube"} 3.55
+loads_count{source="youtube"} 3
+# TYPE players gauge
+players 1
+# TYPE requests counter
+requests{a="\"quoted\"",code="200"} 3
+`, buf.String())
+}
+
+func TestRegistry_Describe(t *testing.T) {
+	r := &Registry{families: make(map[string]*family)}
+	r.Describe(Desc{Name: "loads", Kind: Histogram, Buckets: []float64{1}})
+	r.Observe("loads", 0.5)
+	r.Describe(Desc{Name: "loads", Help: "Loads.", Kind: Histogram, Buckets: []float64{1}})
+	r.Describe(Desc{Name: "players", Kind: Gauge})
+	r.Set("players", 2)
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Contains(t, buf.String(), "# HELP loads Loads.\n# TYPE loads histogram\nloads_bucket{le=\"1\"} 1\n", "the series should be kept")
+
+	r.Describe(Desc{Name: "loads", Kind: Histogram, Buckets: []float64{0.1, 1, 10}})
+	r.Describe(Desc{Name: "players", Kind: Histogram})
+	r.Observe("loads", 5)
+	buf.Reset()
+	_, err = r.WriteTo(&buf)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, `# TYPE loads histogram
+loads_bucket{le="0.1"} 0
+loads_bucket{le="1"} 0
+loads_bucket{le="10"} 1
+loads_bucket{le="+Inf"} 1
+loads_sum 5
+loads_count 1
+# TYPE players histogram
+`, buf.String())
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := New()
+	r.Add(core.MetricPacketsSent, 50)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "# TYPE lionplayer_packets_sent_total counter\nlionplayer_packets_sent_total 50\n")
+	assert.Contains(t, rec.Body.String(), "# TYPE lionplayer_active_players gauge\n", "described metrics should be listed before being measured")
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -25,11 +25,14 @@ SOFTWARE.
 package mpeg
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
 )
 
+// errNotSeeker is returned when seeking a reader that can't seek.
+var errNotSeeker = errors.New("the reader can't seek")
+
 /**
 Taken from https://github.com/ebml-go/ebml
 No need for a dependency just for the reader
@@ -40,7 +43,7 @@ type limitedReadSeeker struct {
 }
 
 func newLimitedReadSeeker(rs io.ReadSeeker, limit int64) *limitedReadSeeker {
-	return &limitedReadSeeker{&io.LimitedReader{rs, limit}}
+	return &limitedReadSeeker{&io.LimitedReader{R: rs, N: limit}}
 }
 
 func (lrs *limitedReadSeeker) String() string {
@@ -48,24 +51,23 @@ func (lrs *limitedReadSeeker) String() string {
 }
 
 func (lrs *limitedReadSeeker) Seek(offset int64, whence int) (ret int64, err error) {
-	//	log.Println("seek0", lrs, offset, whence)
-	s := lrs.LimitedReader.R.(io.Seeker)
+	s, ok := lrs.LimitedReader.R.(io.Seeker)
+	if !ok {
+		return 0, errNotSeeker
+	}
 	prevN := lrs.LimitedReader.N
 	var curr int64
-	curr, err = s.Seek(0, 1)
+	curr, err = s.Seek(0, io.SeekCurrent)
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
 	ret, err = s.Seek(offset, whence)
 	if err != nil {
-		log.Panic(err)
+		return 0, err
 	}
 	lrs.LimitedReader.N += curr - ret
-	if offset == 0 && whence == 1 {
-		if lrs.LimitedReader.N != prevN {
-			log.Panic(lrs.LimitedReader.N, prevN, curr, ret)
-		}
+	if offset == 0 && whence == io.SeekCurrent && lrs.LimitedReader.N != prevN {
+		return ret, fmt.Errorf("inconsistent seek at offset %d: %d bytes left instead of %d", ret, lrs.LimitedReader.N, prevN)
 	}
-	//	log.Println("seek1", lrs, offset, whence)
 	return
 }
@@ -258,8 +258,8 @@ func (p *Parser) handleMoov(track *Track, moov *Element) error {
 }
 
 // Parse parses the headers and returns a playable.
-// The playable will also implement PlaySeekable if seeking is possible.
-// The playable can be either FragmentedTrack or StandardTrack
+//
+// Playing is not implemented yet, so once the headers are parsed ErrNotSupported is returned.
 func (p *Parser) Parse() (core.Playable, error) {
 	ftyp, err := p.Next()
 	if err != nil {
@@ -292,8 +292,5 @@ func (p *Parser) Parse() (core.Playable, error) {
 		err = el.Skip()
 	}
 Finish:
-	if p.isFragmented {
-		return p.ft, nil
-	}
-	return p.st, nil
+	return nil, ErrNotSupported
 }
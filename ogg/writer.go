@@ -0,0 +1,147 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package ogg implements a minimal Ogg page writer for Opus streams.
+package ogg
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/dondish/lionplayer/opus"
+	"io"
+)
+
+const (
+	headerBOS = 0x02 // Beginning of stream
+	headerEOS = 0x04 // End of stream
+
+	maxSegments = 255
+)
+
+// ErrPacketTooLarge is returned when a packet does not fit in a single page.
+var ErrPacketTooLarge = errors.New("packet too large for a single ogg page")
+
+// crcTable is the lookup table of the CRC32 variant used by Ogg (polynomial 0x04c11db7, not reflected).
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return
+}()
+
+// checksum calculates the Ogg CRC32 of the data given.
+func checksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// Writer writes Opus packets into an Ogg logical bitstream.
+//
+// Every packet is written in its own page to keep the latency low when streaming.
+type Writer struct {
+	w       io.Writer
+	serial  uint32
+	seq     uint32
+	granule uint64
+	page    []byte
+}
+
+// NewWriter creates a new Writer writing a logical bitstream with the serial given to w.
+func NewWriter(w io.Writer, serial uint32) *Writer {
+	return &Writer{
+		w:      w,
+		serial: serial,
+		page:   make([]byte, 0, 27+maxSegments+4096),
+	}
+}
+
+// WriteHeaders writes the OpusHead and OpusTags pages.
+//
+// It must be called once before any call to WritePacket.
+func (ow *Writer) WriteHeaders(channels, sampleRate int, comments ...string) error {
+	if err := ow.writePage(opus.Head(channels, sampleRate, 0), 0, headerBOS); err != nil {
+		return err
+	}
+	return ow.writePage(opus.Tags("lionplayer", comments...), 0, 0)
+}
+
+// WritePacket writes an Opus packet, advancing the granule position by the packet's duration.
+func (ow *Writer) WritePacket(data []byte) error {
+	samples, err := opus.PacketSamples(data)
+	if err != nil {
+		return err
+	}
+	ow.granule += uint64(samples)
+	return ow.writePage(data, ow.granule, 0)
+}
+
+// Granule returns the current granule position, which is the amount of samples written.
+func (ow *Writer) Granule() uint64 {
+	return ow.granule
+}
+
+// Close writes an empty page marking the end of the stream.
+//
+// Close does not close the underlying writer.
+func (ow *Writer) Close() error {
+	return ow.writePage(nil, ow.granule, headerEOS)
+}
+
+// writePage writes a single page containing one packet.
+func (ow *Writer) writePage(packet []byte, granule uint64, flags byte) error {
+	segments := len(packet)/255 + 1
+	if segments > maxSegments {
+		return ErrPacketTooLarge
+	}
+	p := ow.page[:27]
+	copy(p, "OggS")
+	p[4] = 0 // version
+	p[5] = flags
+	binary.LittleEndian.PutUint64(p[6:], granule)
+	binary.LittleEndian.PutUint32(p[14:], ow.serial)
+	binary.LittleEndian.PutUint32(p[18:], ow.seq)
+	binary.LittleEndian.PutUint32(p[22:], 0) // checksum placeholder
+	p[26] = byte(segments)
+	for i := 0; i < segments-1; i++ {
+		p = append(p, 255)
+	}
+	p = append(p, byte(len(packet)%255))
+	p = append(p, packet...)
+	binary.LittleEndian.PutUint32(p[22:], checksum(p))
+	ow.page = p
+	ow.seq++
+	_, err := ow.w.Write(p)
+	return err
+}
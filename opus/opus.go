@@ -0,0 +1,134 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package opus contains small helpers for working with raw Opus packets.
+//
+// It does not decode or encode audio, it only inspects packet headers and builds
+// the identification headers needed by the containers lionplayer writes.
+package opus
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// SampleRate is the rate Opus granule positions and timestamps are measured in.
+const SampleRate = 48000
+
+// Silence is a single 20ms Opus frame of silence.
+//
+// Discord expects a few of these after the last packet to avoid interpolation.
+var Silence = []byte{0xF8, 0xFF, 0xFE}
+
+// frameSamples maps each TOC configuration to the frame size in samples at 48kHz.
+var frameSamples = [32]int{
+	480, 960, 1920, 2880, // SILK NB
+	480, 960, 1920, 2880, // SILK MB
+	480, 960, 1920, 2880, // SILK WB
+	480, 960, // Hybrid SWB
+	480, 960, // Hybrid FB
+	120, 240, 480, 960, // CELT NB
+	120, 240, 480, 960, // CELT WB
+	120, 240, 480, 960, // CELT SWB
+	120, 240, 480, 960, // CELT FB
+}
+
+// ErrInvalidPacket is returned when a packet is too short to contain a valid TOC.
+var ErrInvalidPacket = errors.New("invalid opus packet")
+
+// PacketSamples returns the amount of samples (at 48kHz) the packet given contains.
+//
+// See: https://tools.ietf.org/html/rfc6716#section-3.1
+func PacketSamples(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrInvalidPacket
+	}
+	toc := data[0]
+	var frames int
+	switch toc & 3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(data) < 2 {
+			return 0, ErrInvalidPacket
+		}
+		frames = int(data[1] & 0x3F)
+	}
+	return frames * frameSamples[toc>>3], nil
+}
+
+// PacketDuration returns the duration of the audio in the packet given.
+func PacketDuration(data []byte) (time.Duration, error) {
+	samples, err := PacketSamples(data)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(samples) * time.Second / SampleRate, nil
+}
+
+// Head builds an OpusHead identification header.
+//
+// It is used as the first Ogg packet and as the CodecPrivate of Matroska tracks.
+//
+// See: https://tools.ietf.org/html/rfc7845#section-5.1
+func Head(channels, inputSampleRate int, preSkip uint16) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	binary.LittleEndian.PutUint32(head[12:], uint32(inputSampleRate))
+	// Output gain (2 bytes) and channel mapping family (1 byte) stay zero.
+	return head
+}
+
+// Tags builds an OpusTags comment header with the vendor and comments given.
+//
+// Comments should be in the form of KEY=value.
+//
+// See: https://tools.ietf.org/html/rfc7845#section-5.2
+func Tags(vendor string, comments ...string) []byte {
+	tags := append([]byte{}, "OpusTags"...)
+	tags = appendString(tags, vendor)
+	tags = appendUint32(tags, uint32(len(comments)))
+	for _, c := range comments {
+		tags = appendString(tags, c)
+	}
+	return tags
+}
+
+// appendUint32 appends a little endian unsigned integer.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendString appends a length-prefixed string.
+func appendString(b []byte, s string) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
@@ -0,0 +1,107 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package player
+
+import (
+	"github.com/dondish/lionplayer/core"
+	"time"
+)
+
+// EndReason is the reason a track stopped playing.
+type EndReason string
+
+// The reasons a track can end for, named after the Lavalink protocol.
+const (
+	// Finished means the track reached its end.
+	Finished EndReason = "finished"
+	// LoadFailed means the track could not be loaded.
+	LoadFailed EndReason = "loadFailed"
+	// Stopped means the track was stopped.
+	Stopped EndReason = "stopped"
+	// Replaced means another track started playing.
+	Replaced EndReason = "replaced"
+	// Cleanup means the player was closed.
+	Cleanup EndReason = "cleanup"
+)
+
+// MayStartNext returns whether the next track should be started after a track ended with this reason.
+func (r EndReason) MayStartNext() bool {
+	return r == Finished || r == LoadFailed
+}
+
+// Event is an event emitted by a Player.
+//
+// It is one of TrackStartEvent, TrackEndEvent, TrackExceptionEvent, TrackStuckEvent and SinkErrorEvent.
+type Event interface {
+	// EventTrack returns the track the event is about.
+	EventTrack() core.Track
+}
+
+// TrackStartEvent is emitted when a track starts playing.
+type TrackStartEvent struct {
+	Track core.Track
+}
+
+// TrackEndEvent is emitted when a track stops playing.
+type TrackEndEvent struct {
+	Track  core.Track
+	Reason EndReason
+}
+
+// TrackExceptionEvent is emitted when a track fails to load or play.
+type TrackExceptionEvent struct {
+	Track core.Track
+	Err   error
+}
+
+// TrackStuckEvent is emitted when a track did not provide any packet for Threshold.
+type TrackStuckEvent struct {
+	Track     core.Track
+	Threshold time.Duration
+}
+
+// SinkErrorEvent is emitted when the sink fails to write a frame.
+//
+// The sink is detached and the playback halts until another sink is set.
+type SinkErrorEvent struct {
+	Track core.Track
+	Sink  Sink
+	Err   error
+}
+
+// EventTrack implements Event.
+func (e TrackStartEvent) EventTrack() core.Track { return e.Track }
+
+// EventTrack implements Event.
+func (e TrackEndEvent) EventTrack() core.Track { return e.Track }
+
+// EventTrack implements Event.
+func (e TrackExceptionEvent) EventTrack() core.Track { return e.Track }
+
+// EventTrack implements Event.
+func (e TrackStuckEvent) EventTrack() core.Track { return e.Track }
+
+// EventTrack implements Event.
+func (e SinkErrorEvent) EventTrack() core.Track { return e.Track }
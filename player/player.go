@@ -0,0 +1,420 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package player plays tracks into a voice connection and reports what happens while doing so.
+package player
+
+import (
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"sync"
+	"time"
+)
+
+// DefaultStuckThreshold is the time without any packet after which a track is reported stuck.
+const DefaultStuckThreshold = 10 * time.Second
+
+// ErrNotPlaying is returned when an operation requires a track to be playing.
+var ErrNotPlaying = errors.New("not playing anything")
+
+// ErrNotSeekable is returned when seeking a track that does not support seeking.
+var ErrNotSeekable = errors.New("track is not seekable")
+
+// Sink receives the packets of the playing track, usually a voice connection.
+type Sink interface {
+	// WriteOpus sends a single opus frame.
+	//
+	// Implementations are expected to pace the frames, blocking until the frame can be sent.
+	WriteOpus(frame []byte) error
+}
+
+// Player plays a single track at a time into a Sink.
+//
+// A Player never discards packets, while it is paused or has no Sink the track simply does not advance.
+// When the Sink fails to write a frame the Player detaches it and keeps the frame until a new Sink is set.
+type Player struct {
+	// StuckThreshold is the time without packets after which a TrackStuckEvent is emitted.
+	StuckThreshold time.Duration
+	// OnEvent is called with each event of the player, it must not block nor play or stop tracks before returning.
+	OnEvent func(Event)
+	// Metrics measures the packets sent, underruns and seeks, nil for core.DefaultMetrics.
+	Metrics core.Metrics
+	// Logger logs the failures that aren't reported as events, nil for core.DefaultLogger.
+	Logger core.Logger
+
+	// Serializes starting and stopping tracks, so a playback is never replaced while it is being stopped.
+	playMu sync.Mutex
+
+	mu       sync.Mutex
+	sink     Sink
+	track    core.Track
+	playable core.Playable
+	paused   bool
+	position time.Duration
+	volume   int
+	// The stop channel of the current playback, nil if not playing.
+	stop chan EndReason
+	// Closed when the current playback goroutine exits.
+	done chan struct{}
+	// Notifies the playback goroutine of a state change.
+	wake chan struct{}
+}
+
+// New creates a new Player that plays into the sink given, the sink can be set later using SetSink.
+func New(sink Sink) *Player {
+	return &Player{
+		StuckThreshold: DefaultStuckThreshold,
+		sink:           sink,
+		volume:         100,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// notify wakes up the playback goroutine.
+func (p *Player) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// emit calls the event handler.
+func (p *Player) emit(e Event) {
+	if p.OnEvent != nil {
+		p.OnEvent(e)
+	}
+}
+
+// Play starts playing the track given from the position given, replacing the current track.
+//
+// If end is positive the track is stopped when reaching it.
+// Play returns immediately, loading failures are reported using a TrackExceptionEvent.
+func (p *Player) Play(track core.Track, start, end time.Duration) {
+	p.playMu.Lock()
+	defer p.playMu.Unlock()
+	p.stopCurrent(Replaced)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stop := make(chan EndReason, 1)
+	done := make(chan struct{})
+	p.track = track
+	p.playable = nil
+	p.position = start
+	p.stop = stop
+	p.done = done
+	go p.run(track, start, end, stop, done)
+}
+
+// stopCurrent stops the current track with the reason given and waits for it to stop, playMu must be held.
+//
+// Returns whether a track was playing.
+func (p *Player) stopCurrent(reason EndReason) bool {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.track, p.playable = nil, nil
+	p.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	stop <- reason
+	<-done
+	return true
+}
+
+// Stop stops the current track.
+func (p *Player) Stop() bool {
+	p.playMu.Lock()
+	defer p.playMu.Unlock()
+	return p.stopCurrent(Stopped)
+}
+
+// Close stops the current track and releases the sink.
+func (p *Player) Close() error {
+	p.playMu.Lock()
+	p.stopCurrent(Cleanup)
+	p.playMu.Unlock()
+	p.SetSink(nil)
+	return nil
+}
+
+// SetSink changes the sink the packets are sent to, nil halts the playback until a sink is set.
+func (p *Player) SetSink(sink Sink) {
+	p.mu.Lock()
+	p.sink = sink
+	p.mu.Unlock()
+	p.notify()
+}
+
+// Sink returns the current sink.
+func (p *Player) Sink() Sink {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sink
+}
+
+// Pause pauses or resumes the playback.
+func (p *Player) Pause(paused bool) {
+	p.mu.Lock()
+	p.paused = paused
+	p.mu.Unlock()
+	p.notify()
+}
+
+// Paused returns whether the player is paused.
+func (p *Player) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// Seek seeks the current track to the position given.
+//
+// The playable is seeked without holding the lock, as it may wait for the playback goroutine.
+func (p *Player) Seek(position time.Duration) error {
+	p.mu.Lock()
+	if p.track == nil {
+		p.mu.Unlock()
+		return ErrNotPlaying
+	}
+	playable, stop := p.playable, p.stop
+	p.mu.Unlock()
+	if playable == nil { // Still loading
+		return ErrNotSeekable
+	}
+	seekable, ok := playable.(core.PlaySeekable)
+	if !ok {
+		return ErrNotSeekable
+	}
+	if err := seekable.Seek(position); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if p.stop == stop { // Still the same playback
+		p.position = position
+	}
+	p.mu.Unlock()
+	core.MetricsOr(p.Metrics).Add(core.MetricSeeks, 1)
+	return nil
+}
+
+// Track returns the track currently playing, nil if not playing.
+func (p *Player) Track() core.Track {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.track
+}
+
+// Position returns the position of the current track.
+func (p *Player) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position
+}
+
+// SetVolume stores the volume of the player in percents.
+//
+// The packets are not re-encoded so the volume is only kept for clients to query.
+func (p *Player) SetVolume(volume int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volume = volume
+}
+
+// Volume returns the volume of the player in percents.
+func (p *Player) Volume() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.volume
+}
+
+// state returns the sink if the player should send packets, nil otherwise.
+func (p *Player) state() Sink {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return nil
+	}
+	return p.sink
+}
+
+// detach removes the sink after it failed to write a frame, unless it was replaced meanwhile.
+func (p *Player) detach(track core.Track, sink Sink, err error) {
+	p.mu.Lock()
+	current := p.sink == sink
+	if current {
+		p.sink = nil
+	}
+	p.mu.Unlock()
+	if current {
+		p.emit(SinkErrorEvent{Track: track, Sink: sink, Err: err})
+	}
+}
+
+// finish clears the current track if the playback given is still the current one.
+func (p *Player) finish(stop chan EndReason) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop == stop {
+		p.stop, p.done = nil, nil
+		p.track, p.playable = nil, nil
+	}
+}
+
+// drain closes the playable and drains its channel so its goroutine can exit.
+func (p *Player) drain(playable core.Playable) {
+	go func() {
+		for range playable.Chan() {
+		}
+	}()
+	p.close(playable)
+}
+
+// close closes the playable, it has already ended so failing to close it is only logged.
+func (p *Player) close(playable core.Playable) {
+	if err := playable.Close(); err != nil {
+		core.LoggerOr(p.Logger).Log(core.LevelDebug, "closing the track failed", core.F(core.KeyError, err))
+	}
+}
+
+// resetTimer stops, drains and resets the timer given.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// run loads and plays the track, it is the playback goroutine.
+func (p *Player) run(track core.Track, start, end time.Duration, stop chan EndReason, done chan struct{}) {
+	defer close(done)
+	playable, err := track.Playable()
+	if err != nil {
+		p.finish(stop)
+		p.emit(TrackExceptionEvent{Track: track, Err: err})
+		p.emit(TrackEndEvent{Track: track, Reason: LoadFailed})
+		return
+	}
+	if seekable, ok := playable.(core.PlaySeekable); ok && start > 0 {
+		if err := seekable.Seek(start); err != nil {
+			core.LoggerOr(p.Logger).Log(core.LevelWarn, "seeking to the start failed, playing from the beginning",
+				core.F("position", start), core.F(core.KeyError, err))
+		}
+	}
+	p.mu.Lock()
+	if p.stop == stop {
+		p.playable = playable
+	}
+	p.mu.Unlock()
+	c := playable.Chan()
+	go playable.Play()
+	p.emit(TrackStartEvent{Track: track})
+
+	threshold := p.StuckThreshold
+	if threshold <= 0 {
+		threshold = DefaultStuckThreshold
+	}
+	stuck := time.NewTimer(threshold)
+	defer stuck.Stop()
+	metrics := core.MetricsOr(p.Metrics)
+	// pending is a frame the sink failed to write, it is written first once there is a sink.
+	var pending []byte
+	// sent is whether a packet was just sent, if the next one isn't ready the track underran.
+	var sent bool
+	for {
+		sink := p.state()
+		if sink == nil { // Paused or disconnected, wait for a change.
+			sent = false
+			select {
+			case reason := <-stop:
+				p.drain(playable)
+				p.emit(TrackEndEvent{Track: track, Reason: reason})
+				return
+			case <-p.wake:
+				resetTimer(stuck, threshold)
+				continue
+			}
+		}
+		if pending != nil {
+			if err := sink.WriteOpus(pending); err != nil {
+				p.detach(track, sink, err)
+			} else {
+				pending = nil
+			}
+			continue
+		}
+		var packet core.Packet
+		var ok bool
+		select {
+		case reason := <-stop:
+			p.drain(playable)
+			p.emit(TrackEndEvent{Track: track, Reason: reason})
+			return
+		case packet, ok = <-c:
+		default:
+			if sent {
+				metrics.Add(core.MetricUnderruns, 1)
+			}
+			sent = false
+			select {
+			case reason := <-stop:
+				p.drain(playable)
+				p.emit(TrackEndEvent{Track: track, Reason: reason})
+				return
+			case <-p.wake:
+				continue
+			case <-stuck.C:
+				p.emit(TrackStuckEvent{Track: track, Threshold: threshold})
+				stuck.Reset(threshold)
+				continue
+			case packet, ok = <-c:
+			}
+		}
+		if !ok || (end > 0 && packet.Timecode >= end) {
+			if ok {
+				p.drain(playable)
+			} else {
+				p.close(playable)
+			}
+			p.finish(stop)
+			p.emit(TrackEndEvent{Track: track, Reason: Finished})
+			return
+		}
+		resetTimer(stuck, threshold)
+		p.mu.Lock()
+		p.position = packet.Timecode
+		p.mu.Unlock()
+		if err := sink.WriteOpus(packet.Data); err != nil {
+			pending = packet.Data
+			sent = false
+			p.detach(track, sink, err)
+		} else {
+			sent = true
+			metrics.Add(core.MetricPacketsSent, 1)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package player
+
+import (
+	"github.com/dondish/lionplayer/core"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endlessPlayable sends packets tagged with its id until it is closed.
+type endlessPlayable struct {
+	id     byte
+	c      chan core.Packet
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (f *endlessPlayable) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *endlessPlayable) Chan() <-chan core.Packet { return f.c }
+func (f *endlessPlayable) Pause(bool)               {}
+func (f *endlessPlayable) SampleRate() int          { return 48000 }
+func (f *endlessPlayable) Channels() int            { return 2 }
+func (f *endlessPlayable) Codec() string            { return "opus" }
+
+func (f *endlessPlayable) Play() {
+	defer close(f.c)
+	for i := 0; ; i++ {
+		select {
+		case f.c <- core.Packet{Timecode: time.Duration(i) * 20 * time.Millisecond, Data: []byte{f.id}}:
+		case <-f.closed:
+			return
+		}
+	}
+}
+
+// endlessTrack is a track that never ends.
+type endlessTrack struct {
+	id byte
+}
+
+func (t endlessTrack) Playable() (core.Playable, error) {
+	return &endlessPlayable{id: t.id, c: make(chan core.Packet), closed: make(chan struct{})}, nil
+}
+
+func (t endlessTrack) Bitrate() int            { return 0 }
+func (t endlessTrack) Codec() string           { return "opus" }
+func (t endlessTrack) Duration() time.Duration { return 0 }
+
+// recordingSink records the ids of the tracks it receives frames from.
+type recordingSink struct {
+	mu  sync.Mutex
+	ids map[byte]int
+}
+
+func (s *recordingSink) WriteOpus(frame []byte) error {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[frame[0]]++
+	return nil
+}
+
+// reset returns the ids received since the last reset.
+func (s *recordingSink) reset() map[byte]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.ids
+	s.ids = make(map[byte]int)
+	return ids
+}
+
+func TestPlayer_ConcurrentPlay(t *testing.T) {
+	sink := &recordingSink{ids: make(map[byte]int)}
+	p := New(sink)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			p.Play(endlessTrack{id: id}, 0, 0)
+		}(byte(i))
+	}
+	wg.Wait()
+
+	time.Sleep(50 * time.Millisecond)
+	sink.reset()
+	time.Sleep(50 * time.Millisecond)
+	ids := sink.reset()
+	current := p.Track().(endlessTrack)
+	assert.Len(t, ids, 1, "only a single playback should write to the sink")
+	assert.NotZero(t, ids[current.id], "the last track played should be the one writing")
+
+	assert.Nil(t, p.Close(), "error is supposed to be nil")
+	sink.reset()
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, sink.reset(), "nothing should be written after closing")
+}
@@ -0,0 +1,103 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package record
+
+import (
+	"github.com/dondish/lionplayer/voice"
+	"sort"
+	"time"
+)
+
+// DefaultDepth is the default amount of packets held back to reorder them, 100ms of 20ms frames.
+const DefaultDepth = 5
+
+// entry is a packet waiting in the jitter buffer.
+type entry struct {
+	voice.Packet
+	arrival time.Time
+}
+
+// jitterBuffer reorders the packets of a single SSRC by their sequence number.
+//
+// Packets are held back until depth packets are waiting, missing packets are
+// skipped at that point and packets arriving after their turn are dropped.
+type jitterBuffer struct {
+	depth   int
+	started bool
+	// Whether a packet was released, the first packet may still be preceded until then.
+	released bool
+	next     uint16
+	waiting  []entry
+}
+
+// before returns whether the sequence number a comes before b, handling the wrap around.
+func before(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+// push adds a packet to the buffer and returns the packets that are ready in order.
+func (j *jitterBuffer) push(p voice.Packet, arrival time.Time) []entry {
+	if j.started && before(p.Sequence, j.next) {
+		if j.released {
+			return nil // Late or duplicated.
+		}
+		j.next = p.Sequence
+	}
+	for _, e := range j.waiting {
+		if e.Sequence == p.Sequence {
+			return nil
+		}
+	}
+	if !j.started {
+		j.started = true
+		j.next = p.Sequence
+	}
+	j.waiting = append(j.waiting, entry{Packet: p, arrival: arrival})
+	sort.Slice(j.waiting, func(a, b int) bool {
+		return before(j.waiting[a].Sequence, j.waiting[b].Sequence)
+	})
+	return j.release(j.depth)
+}
+
+// release returns the packets in order until a gap is reached while at most depth packets are waiting.
+func (j *jitterBuffer) release(depth int) []entry {
+	var ready []entry
+	for len(j.waiting) > 0 {
+		first := j.waiting[0]
+		if first.Sequence != j.next && len(j.waiting) <= depth {
+			break
+		}
+		ready = append(ready, first)
+		j.released = true
+		j.waiting = j.waiting[1:]
+		j.next = first.Sequence + 1
+	}
+	return ready
+}
+
+// flush returns all of the waiting packets in order.
+func (j *jitterBuffer) flush() []entry {
+	return j.release(0)
+}
@@ -0,0 +1,226 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package record records the audio users send to a voice channel into a separate Ogg Opus file per user.
+//
+// The packets of each user are reordered by a small jitter buffer and gaps are
+// filled with silence, so all of the files start when the recording started and
+// stay in sync with each other.
+package record
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/ogg"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/dondish/lionplayer/voice"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// frameDuration is the duration of the silence frames the gaps are filled with.
+const frameDuration = 20 * time.Millisecond
+
+// maxGap is the largest timestamp gap trusted, larger gaps are measured using the arrival times.
+const maxGap = 10 * time.Minute
+
+// ErrClosed is returned when writing to a closed recorder.
+var ErrClosed = errors.New("recorder closed")
+
+// speaker is the recording of a single SSRC.
+type speaker struct {
+	path    string
+	file    *os.File
+	buf     *bufio.Writer
+	ogg     *ogg.Writer
+	jitter  jitterBuffer
+	last    entry
+	written bool
+}
+
+// Recorder writes the audio received from a voice connection into per-user Ogg Opus files.
+type Recorder struct {
+	// Depth is the amount of packets held back to reorder them, it must be set before writing.
+	Depth int
+	// Logger logs the files created and the packets that can't be recorded, nil for core.DefaultLogger.
+	Logger core.Logger
+
+	dir     string
+	started time.Time
+
+	mu       sync.Mutex
+	users    map[uint32]string
+	speakers map[uint32]*speaker
+	names    map[string]int
+	closed   bool
+}
+
+// New creates a recorder writing into the directory given, which is created if needed.
+//
+// The recording starts right away, users who start speaking later are padded with silence.
+func New(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		Depth:    DefaultDepth,
+		dir:      dir,
+		started:  time.Now(),
+		users:    make(map[uint32]string),
+		speakers: make(map[uint32]*speaker),
+		names:    make(map[string]int),
+	}, nil
+}
+
+// Dir returns the directory the files are written to.
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// SetUser maps an SSRC to the user sending it, the files are named after the users.
+func (r *Recorder) SetUser(ssrc uint32, userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[ssrc] = userID
+}
+
+// Write records a received packet.
+func (r *Recorder) Write(p voice.Packet) error {
+	return r.write(p, time.Now())
+}
+
+// write records a packet which arrived at the time given.
+func (r *Recorder) write(p voice.Packet, arrival time.Time) error {
+	if _, err := opus.PacketSamples(p.Opus); err != nil { // Not audio we can record, most likely a corrupted packet.
+		core.LoggerOr(r.Logger).Log(core.LevelDebug, "dropped a packet that isn't opus", core.F("ssrc", p.SSRC), core.F(core.KeyError, err))
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	s, ok := r.speakers[p.SSRC]
+	if !ok {
+		s = &speaker{jitter: jitterBuffer{depth: r.Depth}}
+		r.speakers[p.SSRC] = s
+	}
+	for _, e := range s.jitter.push(p, arrival) {
+		if err := r.writeEntry(s, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntry writes an in order packet, preceded by the silence filling the gap before it.
+func (r *Recorder) writeEntry(s *speaker, e entry) error {
+	var gap time.Duration
+	if !s.written {
+		if err := r.open(s, e.SSRC); err != nil {
+			return err
+		}
+		gap = e.arrival.Sub(r.started)
+	} else {
+		samples, _ := opus.PacketSamples(s.last.Opus)
+		delta := int32(e.Timestamp - s.last.Timestamp - uint32(samples))
+		gap = time.Duration(delta) * time.Second / opus.SampleRate
+		if delta < 0 || gap > maxGap {
+			gap = e.arrival.Sub(s.last.arrival) - time.Duration(samples)*time.Second/opus.SampleRate
+		}
+	}
+	for ; gap >= frameDuration; gap -= frameDuration {
+		if err := s.ogg.WritePacket(opus.Silence); err != nil {
+			return err
+		}
+	}
+	s.last = e
+	s.written = true
+	return s.ogg.WritePacket(e.Opus)
+}
+
+// open creates the file of a speaker, named after its user or its SSRC if the user is unknown.
+func (r *Recorder) open(s *speaker, ssrc uint32) error {
+	name := fmt.Sprint(ssrc)
+	if user, ok := r.users[ssrc]; ok {
+		name = user
+	}
+	r.names[name]++
+	if n := r.names[name]; n > 1 { // The same user reconnected with a new SSRC.
+		name = fmt.Sprintf("%s-%d", name, n)
+	}
+	path := filepath.Join(r.dir, name+".ogg")
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	core.LoggerOr(r.Logger).Log(core.LevelInfo, "recording a speaker", core.F("ssrc", ssrc), core.F("path", path))
+	s.path, s.file, s.buf = path, file, bufio.NewWriter(file)
+	s.ogg = ogg.NewWriter(s.buf, ssrc)
+	return s.ogg.WriteHeaders(2, opus.SampleRate, "SSRC="+fmt.Sprint(ssrc), "TITLE="+name)
+}
+
+// Files returns the paths of the files written so far.
+func (r *Recorder) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var files []string
+	for _, s := range r.speakers {
+		if s.path != "" {
+			files = append(files, s.path)
+		}
+	}
+	return files
+}
+
+// Close writes the packets still waiting in the jitter buffers and closes the files.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var err error
+	for _, s := range r.speakers {
+		for _, e := range s.jitter.flush() {
+			if werr := r.writeEntry(s, e); werr != nil && err == nil {
+				err = werr
+			}
+		}
+		if s.file == nil {
+			continue
+		}
+		for _, ferr := range []error{s.ogg.Close(), s.buf.Flush(), s.file.Close()} {
+			if ferr != nil && err == nil {
+				err = ferr
+			}
+		}
+	}
+	return err
+}
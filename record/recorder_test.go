@@ -0,0 +1,108 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/dondish/lionplayer/voice"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// frame is a 20ms opus frame which is distinguishable from silence.
+var frame = []byte{0xFC, 0x01, 0x02}
+
+func sequences(entries []entry) []uint16 {
+	var seqs []uint16
+	for _, e := range entries {
+		seqs = append(seqs, e.Sequence)
+	}
+	return seqs
+}
+
+func TestJitterBuffer(t *testing.T) {
+	j := jitterBuffer{depth: 2}
+	push := func(seq uint16) []uint16 {
+		return sequences(j.push(voice.Packet{Sequence: seq, Opus: frame}, time.Now()))
+	}
+	assert.Equal(t, []uint16{65535}, push(65535))
+	assert.Nil(t, push(1), "a packet after a gap should be held back")
+	assert.Equal(t, []uint16{0, 1}, push(0), "the buffer should reorder around the wrap")
+	assert.Nil(t, push(0), "duplicated packets should be dropped")
+	assert.Nil(t, push(3))
+	assert.Nil(t, push(4))
+	assert.Equal(t, []uint16{3, 4, 5}, push(5), "missing packets should be skipped once the buffer is full")
+	assert.Nil(t, push(2), "late packets should be dropped")
+	assert.Nil(t, push(7))
+	assert.Equal(t, []uint16{7}, sequences(j.flush()))
+}
+
+// lastGranule returns the granule position of the last page in an Ogg file.
+func lastGranule(t *testing.T, path string) uint64 {
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "error is supposed to be nil")
+	i := bytes.LastIndex(data, []byte("OggS"))
+	if i < 0 || len(data) < i+14 {
+		t.Fatal("no ogg page found")
+	}
+	return binary.LittleEndian.Uint64(data[i+6:])
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer os.RemoveAll(dir)
+
+	r, err := New(dir)
+	assert.Nil(t, err, "error is supposed to be nil")
+	r.SetUser(1, "alice")
+	start := r.started
+
+	// Alice speaks right away, packet 2 arrives late and packet 3 is lost.
+	for _, seq := range []uint16{0, 1, 4, 2, 5} {
+		p := voice.Packet{SSRC: 1, Sequence: seq, Timestamp: uint32(seq) * 960, Opus: frame}
+		assert.Nil(t, r.write(p, start.Add(time.Duration(seq)*frameDuration)))
+	}
+	// An unknown user starts speaking a second into the recording.
+	for seq := uint16(100); seq < 110; seq++ {
+		p := voice.Packet{SSRC: 2, Sequence: seq, Timestamp: 123456 + uint32(seq)*960, Opus: frame}
+		assert.Nil(t, r.write(p, start.Add(time.Second+time.Duration(seq-100)*frameDuration)))
+	}
+	assert.Nil(t, r.Close())
+	assert.Equal(t, ErrClosed, r.Write(voice.Packet{SSRC: 1, Opus: frame}))
+
+	files := r.Files()
+	sort.Strings(files)
+	assert.Equal(t, []string{filepath.Join(dir, "2.ogg"), filepath.Join(dir, "alice.ogg")}, files)
+	assert.Equal(t, uint64(6*960), lastGranule(t, files[1]), "the lost packet should be filled with silence")
+	assert.Equal(t, uint64(opus.SampleRate+10*960), lastGranule(t, files[0]), "late speakers should be padded from the start")
+}
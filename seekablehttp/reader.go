@@ -41,13 +41,20 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 )
 
+// DefaultRetries is the number of times New sets a failed request to be retried.
+const DefaultRetries = 2
+
 // SeekingHTTP uses a series of HTTP GETs with Range headers
 // to implement io.ReadSeeker and io.ReaderAt.
 type SeekingHTTP struct {
 	URL     string       // The URL to connect to
 	Client  *http.Client // The HTTP DefaultHTTPClient to use (allows of client reuse)
+	Logger  core.Logger  // The logger of the requests, nil for core.DefaultLogger
+	Metrics core.Metrics // The metrics of the requests, nil for core.DefaultMetrics
+	Retries int          // The number of times a failed request or an interrupted stream is retried
 	url     *url.URL     // The url.URL representation of SeekingHTTP.Url
 	offset  int64
 	resp    io.ReadCloser
@@ -82,9 +89,10 @@ var _ io.ReaderAt = (*SeekingHTTP)(nil)
 // to Read or Seek.
 func New(url string, length int64) *SeekingHTTP {
 	return &SeekingHTTP{
-		URL:    url,
-		offset: 0,
-		length: length,
+		URL:     url,
+		offset:  0,
+		length:  length,
+		Retries: DefaultRetries,
 	}
 }
 
@@ -115,34 +123,93 @@ func fmtRange(from int64) string {
 }
 
 // ReadAt reads len(buf) bytes into buf starting at offset off.
+//
+// A stream interrupted by an error is requested again from where it stopped.
 func (s *SeekingHTTP) ReadAt(buf []byte, off int64) (int, error) {
 	if !s.open {
-		req, err := s.newreq()
-		if err != nil {
+		if err := s.openAt(off); err != nil {
 			return 0, err
 		}
-
-		rng := fmtRange(off)
-		req.Header.Add("Range", rng)
-
-		if err := s.init(); err != nil {
+	}
+	n, err := s.respbuf.Read(buf)
+	if n == 0 && err != nil && err != io.EOF && s.Retries > 0 {
+		core.LoggerOr(s.Logger).Log(core.LevelWarn, "stream interrupted", core.F(core.KeyOffset, off), core.F(core.KeyError, err))
+		core.MetricsOr(s.Metrics).Add(core.MetricHTTPRetries, 1)
+		_ = s.close()
+		if err := s.openAt(off); err != nil {
 			return 0, err
 		}
-		resp, err := s.Client.Do(req)
-		if err != nil {
-			return 0, err
+		return s.respbuf.Read(buf)
+	}
+	return n, err
+}
+
+// openAt requests the stream from the offset given, retrying failed requests.
+func (s *SeekingHTTP) openAt(off int64) error {
+	var err error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			core.MetricsOr(s.Metrics).Add(core.MetricHTTPRetries, 1)
 		}
-		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
-			s.resp = resp.Body
-			s.open = true
-			if s.respbuf == nil {
-				s.respbuf = bufio.NewReader(s.resp)
-			} else {
-				s.respbuf.Reset(s.resp)
-			}
+		var retry bool
+		if retry, err = s.request(off); err == nil || !retry {
+			return err
 		}
 	}
-	return s.respbuf.Read(buf)
+	return err
+}
+
+// request requests the stream from the offset given, returning whether a failure may be retried.
+func (s *SeekingHTTP) request(off int64) (bool, error) {
+	req, err := s.newreq()
+	if err != nil {
+		return false, err
+	}
+
+	rng := fmtRange(off)
+	req.Header.Add("Range", rng)
+
+	if err := s.init(); err != nil {
+		return false, err
+	}
+	logger := core.LoggerOr(s.Logger)
+	metrics := core.MetricsOr(s.Metrics)
+	logger.Log(core.LevelDebug, "requesting stream", core.F(core.KeyOffset, off))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		metrics.Add(core.MetricHTTPRequests, 1, core.L(core.LabelCode, "error"))
+		logger.Log(core.LevelWarn, "stream request failed", core.F(core.KeyOffset, off), core.F(core.KeyError, err))
+		return true, err
+	}
+	metrics.Add(core.MetricHTTPRequests, 1, core.L(core.LabelCode, strconv.Itoa(resp.StatusCode)))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		logger.Log(core.LevelWarn, "stream request failed", core.F(core.KeyOffset, off), core.F("status", resp.StatusCode))
+		return resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	s.resp = countingReader{ReadCloser: resp.Body, metrics: metrics}
+	s.open = true
+	if s.respbuf == nil {
+		s.respbuf = bufio.NewReader(s.resp)
+	} else {
+		s.respbuf.Reset(s.resp)
+	}
+	return false, nil
+}
+
+// countingReader counts the bytes read from a response into MetricHTTPBytes.
+type countingReader struct {
+	io.ReadCloser
+	metrics core.Metrics
+}
+
+// Read implements io.Reader.
+func (r countingReader) Read(buf []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buf)
+	if n > 0 {
+		r.metrics.Add(core.MetricHTTPBytes, float64(n))
+	}
+	return n, err
 }
 
 // init initializes the Client used if not already set
@@ -184,7 +251,7 @@ func (s *SeekingHTTP) Seek(offset int64, whence int) (int64, error) {
 	if s.offset == oldoff {
 		return s.offset, nil
 	}
-	if s.offset > oldoff && s.offset-oldoff < int64(s.respbuf.Buffered()) {
+	if s.open && s.offset > oldoff && s.offset-oldoff < int64(s.respbuf.Buffered()) {
 		_, err := s.respbuf.Discard(int(s.offset - oldoff))
 		if err != nil {
 			return 0, err
@@ -213,10 +280,14 @@ func (s *SeekingHTTP) Size() (int64, error) {
 	}
 	req.Method = "HEAD"
 
+	metrics := core.MetricsOr(s.Metrics)
 	resp, err := s.Client.Do(req)
 	if err != nil {
+		metrics.Add(core.MetricHTTPRequests, 1, core.L(core.LabelCode, "error"))
 		return 0, err
 	}
+	metrics.Add(core.MetricHTTPRequests, 1, core.L(core.LabelCode, strconv.Itoa(resp.StatusCode)))
+	_ = resp.Body.Close()
 
 	if resp.ContentLength < 0 {
 		return 0, errors.New("no content length for Size()")
@@ -0,0 +1,181 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package server
+
+import (
+	"github.com/dondish/lionplayer/core"
+	"sync"
+	"time"
+)
+
+// listenerBuffer is the amount of packets buffered for each listener before packets are dropped.
+const listenerBuffer = 256
+
+// Listener receives the packets broadcasted by a Broadcaster.
+type Listener struct {
+	// C receives the packets, it is closed when the listener is removed.
+	C <-chan core.Packet
+	c chan core.Packet
+	b *Broadcaster
+	// The amount of packets dropped because the listener was too slow.
+	dropped uint64
+}
+
+// Close removes the listener from the broadcaster.
+func (l *Listener) Close() {
+	l.b.remove(l)
+}
+
+// Dropped returns the amount of packets dropped because the listener did not keep up.
+func (l *Listener) Dropped() uint64 {
+	l.b.mu.RLock()
+	defer l.b.mu.RUnlock()
+	return l.dropped
+}
+
+// Broadcaster fans out the packets of a Playable to multiple listeners.
+//
+// A slow listener never blocks the others, packets it can't keep up with are dropped.
+type Broadcaster struct {
+	mu         sync.RWMutex
+	listeners  map[*Listener]struct{}
+	title      string
+	channels   int
+	samplerate int
+	packets    uint64
+	started    time.Time
+	closed     bool
+}
+
+// NewBroadcaster creates a new Broadcaster for audio with the channels and sample rate given.
+func NewBroadcaster(channels, sampleRate int) *Broadcaster {
+	return &Broadcaster{
+		listeners:  make(map[*Listener]struct{}),
+		channels:   channels,
+		samplerate: sampleRate,
+		started:    time.Now(),
+	}
+}
+
+// Subscribe adds a new listener to the broadcaster.
+//
+// If the broadcaster is closed the listener's channel is closed immediately.
+func (b *Broadcaster) Subscribe() *Listener {
+	c := make(chan core.Packet, listenerBuffer)
+	l := &Listener{C: c, c: c, b: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return l
+	}
+	b.listeners[l] = struct{}{}
+	return l
+}
+
+// remove removes a listener and closes its channel.
+func (b *Broadcaster) remove(l *Listener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.listeners[l]; ok {
+		delete(b.listeners, l)
+		close(l.c)
+	}
+}
+
+// Broadcast sends the packet to all of the listeners.
+func (b *Broadcaster) Broadcast(p core.Packet) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.packets++
+	for l := range b.listeners {
+		select {
+		case l.c <- p:
+		default:
+			l.dropped++
+		}
+	}
+}
+
+// Play plays the Playable given and broadcasts its packets until it ends.
+//
+// Play blocks the current goroutine, the broadcaster stays open after the Playable ends.
+func (b *Broadcaster) Play(p core.Playable, title string) {
+	b.mu.Lock()
+	b.title = title
+	b.channels = p.Channels()
+	b.samplerate = p.SampleRate()
+	b.mu.Unlock()
+	go p.Play()
+	for packet := range p.Chan() {
+		b.Broadcast(packet)
+	}
+}
+
+// SetTitle sets the title of the content currently broadcasted.
+func (b *Broadcaster) SetTitle(title string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.title = title
+}
+
+// Title returns the title of the content currently broadcasted.
+func (b *Broadcaster) Title() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.title
+}
+
+// Format returns the channel count and the sample rate of the broadcasted audio.
+func (b *Broadcaster) Format() (channels, sampleRate int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.channels, b.samplerate
+}
+
+// Listeners returns the amount of listeners currently subscribed.
+func (b *Broadcaster) Listeners() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.listeners)
+}
+
+// Close closes the broadcaster and all of its listeners.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for l := range b.listeners {
+		delete(b.listeners, l)
+		close(l.c)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package server
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxMetadata is the size of the largest metadata block, its length is sent in a byte as 16 byte blocks.
+const maxMetadata = 255 * 16
+
+// icyWriter interleaves ICY (SHOUTcast) metadata blocks into the stream every metaint bytes.
+type icyWriter struct {
+	w io.Writer
+	// The interval of the metadata blocks, 0 disables metadata
+	metaint int
+	// The amount of audio bytes written since the last metadata block
+	written int
+	// title returns the current title
+	title func() string
+	// The last title sent, metadata is only repeated when it changes
+	last string
+}
+
+// Write implements io.Writer.
+func (iw *icyWriter) Write(p []byte) (int, error) {
+	if iw.metaint == 0 {
+		return iw.w.Write(p)
+	}
+	var n int
+	for len(p) > 0 {
+		chunk := iw.metaint - iw.written
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+		m, err := iw.w.Write(p[:chunk])
+		n += m
+		iw.written += m
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+		if iw.written == iw.metaint {
+			if _, err := iw.w.Write(iw.metadata()); err != nil {
+				return n, err
+			}
+			iw.written = 0
+		}
+	}
+	return n, nil
+}
+
+// metadata builds the next metadata block, a single zero byte if nothing changed.
+func (iw *icyWriter) metadata() []byte {
+	title := iw.title()
+	if title == iw.last {
+		return []byte{0}
+	}
+	iw.last = title
+	meta := "StreamTitle='" + escapeTitle(title, maxMetadata-len("StreamTitle='';")) + "';"
+	blocks := (len(meta) + 15) / 16
+	b := make([]byte, 1+blocks*16)
+	b[0] = byte(blocks)
+	copy(b[1:], meta)
+	return b
+}
+
+// escapeTitle escapes the quotes of a title, truncating it to whole characters fitting in max bytes.
+func escapeTitle(title string, max int) string {
+	var sb strings.Builder
+	for i := 0; i < len(title); {
+		_, size := utf8.DecodeRuneInString(title[i:])
+		c := title[i : i+size]
+		if c == "'" {
+			c = "\\'"
+		}
+		if sb.Len()+len(c) > max {
+			break
+		}
+		sb.WriteString(c)
+		i += size
+	}
+	return sb.String()
+}
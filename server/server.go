@@ -0,0 +1,190 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+/*
+Package server serves the audio of a Playable over HTTP so it can be listened to in a browser.
+
+The audio is streamed live using chunked transfer encoding either in an Ogg Opus
+or a WebM container, each listener receives the container headers before any
+audio so joining mid-stream is always valid.
+*/
+package server
+
+import (
+	"encoding/json"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/ogg"
+	"github.com/dondish/lionplayer/webm"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// packetWriter is a container writer that receives opus packets.
+type packetWriter interface {
+	WritePacket(data []byte) error
+}
+
+// Server is an http.Handler that streams the audio of a Broadcaster.
+//
+// It serves the following endpoints:
+//
+//	/stream.ogg  - the audio in an Ogg Opus container
+//	/stream.webm - the audio in a WebM container
+//	/status      - a JSON object describing the stream
+type Server struct {
+	// MetaInt is the interval in bytes of ICY metadata blocks carrying the current title.
+	//
+	// Metadata is only sent to clients that ask for it using the Icy-MetaData header,
+	// 0 disables metadata altogether.
+	MetaInt int
+	// Name is the name of the stream sent in the icy-name header.
+	Name string
+	// Logger logs the listeners and why their streams ended, nil for core.DefaultLogger.
+	Logger core.Logger
+
+	broadcaster *Broadcaster
+	mux         *http.ServeMux
+}
+
+// Status is the JSON object returned by the status endpoint.
+type Status struct {
+	Title      string `json:"title"`
+	Listeners  int    `json:"listeners"`
+	Channels   int    `json:"channels"`
+	SampleRate int    `json:"sampleRate"`
+	Packets    uint64 `json:"packets"`
+	Uptime     int64  `json:"uptime"`
+}
+
+// New creates a new Server streaming the broadcaster given.
+func New(b *Broadcaster) *Server {
+	s := &Server{
+		broadcaster: b,
+		mux:         http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/stream.ogg", s.serveOgg)
+	s.mux.HandleFunc("/stream.webm", s.serveWebm)
+	s.mux.HandleFunc("/status", s.serveStatus)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Status returns the current status of the stream.
+func (s *Server) Status() Status {
+	b := s.broadcaster
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return Status{
+		Title:      b.title,
+		Listeners:  len(b.listeners),
+		Channels:   b.channels,
+		SampleRate: b.samplerate,
+		Packets:    b.packets,
+		Uptime:     int64(time.Since(b.started) / time.Second),
+	}
+}
+
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Status())
+}
+
+func (s *Server) serveOgg(w http.ResponseWriter, r *http.Request) {
+	s.stream(w, r, "audio/ogg", func(iw *icyWriter, channels, rate int) (packetWriter, error) {
+		ow := ogg.NewWriter(iw, rand.Uint32())
+		return ow, ow.WriteHeaders(channels, rate)
+	})
+}
+
+func (s *Server) serveWebm(w http.ResponseWriter, r *http.Request) {
+	s.stream(w, r, "audio/webm", func(iw *icyWriter, channels, rate int) (packetWriter, error) {
+		m := webm.NewMuxer(iw, channels, rate)
+		return m, m.WriteHeaders()
+	})
+}
+
+// stream subscribes to the broadcaster and writes its packets using the container created by newWriter.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, contentType string, newWriter func(*icyWriter, int, int) (packetWriter, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Cache-Control", "no-cache, no-store")
+	iw := &icyWriter{w: w, title: s.broadcaster.Title}
+	if s.MetaInt > 0 && r.Header.Get("Icy-MetaData") == "1" {
+		iw.metaint = s.MetaInt
+		h.Set("icy-metaint", strconv.Itoa(s.MetaInt))
+	}
+	if s.Name != "" {
+		h.Set("icy-name", s.Name)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	logger := core.With(s.Logger, core.F("listener", r.RemoteAddr), core.F("format", contentType))
+	l := s.broadcaster.Subscribe()
+	logger.Log(core.LevelInfo, "listener connected")
+	defer func() {
+		l.Close()
+		logger.Log(core.LevelInfo, "listener disconnected", core.F("dropped", l.Dropped()))
+	}()
+	channels, rate := s.broadcaster.Format()
+	pw, err := newWriter(iw, channels, rate)
+	if err != nil {
+		logger.Log(core.LevelWarn, "writing the stream headers failed", core.F(core.KeyError, err))
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	done := r.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case p, ok := <-l.C:
+			if !ok {
+				return
+			}
+			if len(p.Data) == 0 {
+				continue
+			}
+			if err := pw.WritePacket(p.Data); err != nil { // Usually the listener went away.
+				logger.Log(core.LevelDebug, "writing a packet failed", core.F(core.KeyError, err))
+				return
+			}
+			if flusher != nil && len(l.C) == 0 {
+				flusher.Flush()
+			}
+		}
+	}
+}
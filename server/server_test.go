@@ -0,0 +1,134 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// waitListeners waits until the broadcaster has the amount of listeners given.
+func waitListeners(b *Broadcaster, n int) bool {
+	for i := 0; i < 100; i++ {
+		if b.Listeners() == n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestServer_OggHeadersFirst(t *testing.T) {
+	b := NewBroadcaster(2, 48000)
+	b.Broadcast(core.Packet{Data: opus.Silence}) // Sent before anybody listens
+	ts := httptest.NewServer(New(b))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/stream.ogg")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer res.Body.Close()
+	assert.Equal(t, "audio/ogg", res.Header.Get("Content-Type"))
+	assert.True(t, waitListeners(b, 1), "the listener should be subscribed")
+
+	b.Broadcast(core.Packet{Data: opus.Silence})
+	r := bufio.NewReader(res.Body)
+	page := make([]byte, 36)
+	_, err = io.ReadFull(r, page)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, "OggS", string(page[:4]), "the stream should start with a page")
+	assert.Equal(t, "OpusHead", string(page[28:36]), "the first packet should be the OpusHead")
+}
+
+func TestServer_WebmHeadersFirst(t *testing.T) {
+	b := NewBroadcaster(2, 48000)
+	ts := httptest.NewServer(New(b))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/stream.webm")
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer res.Body.Close()
+	header := make([]byte, 4)
+	_, err = io.ReadFull(res.Body, header)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Equal(t, []byte{0x1A, 0x45, 0xDF, 0xA3}, header, "the stream should start with an EBML header")
+}
+
+func TestServer_IcyMetadata(t *testing.T) {
+	b := NewBroadcaster(2, 48000)
+	b.SetTitle("Never Gonna Give You Up")
+	s := New(b)
+	s.MetaInt = 16
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/stream.ogg", nil)
+	req.Header.Set("Icy-MetaData", "1")
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err, "error is supposed to be nil")
+	defer res.Body.Close()
+	assert.Equal(t, "16", res.Header.Get("icy-metaint"))
+
+	data := make([]byte, 17)
+	_, err = io.ReadFull(res.Body, data)
+	assert.Nil(t, err, "error is supposed to be nil")
+	meta := make([]byte, int(data[16])*16)
+	_, err = io.ReadFull(res.Body, meta)
+	assert.Nil(t, err, "error is supposed to be nil")
+	assert.Contains(t, string(meta), "StreamTitle='Never Gonna Give You Up';")
+}
+
+func TestIcyWriter_LongTitle(t *testing.T) {
+	title := strings.Repeat("é'", 1500) // 6000 bytes once escaped
+	iw := &icyWriter{title: func() string { return title }}
+	b := iw.metadata()
+	assert.Equal(t, 255, int(b[0]), "the metadata should use all of the blocks")
+	assert.Len(t, b, 1+255*16)
+	meta := strings.TrimRight(string(b[1:]), "\x00")
+	assert.True(t, strings.HasPrefix(meta, "StreamTitle='é\\'"))
+	assert.True(t, strings.HasSuffix(meta, "é\\'';"), "the terminator should be kept after a whole escape")
+	assert.True(t, utf8.ValidString(meta), "the title should be cut between characters")
+}
+
+func TestServer_Status(t *testing.T) {
+	b := NewBroadcaster(2, 48000)
+	b.SetTitle("title")
+	rec := httptest.NewRecorder()
+	New(b).ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var status Status
+	assert.Nil(t, json.NewDecoder(rec.Body).Decode(&status), "error is supposed to be nil")
+	assert.Equal(t, "title", status.Title)
+	assert.Equal(t, 2, status.Channels)
+	assert.Equal(t, 0, status.Listeners)
+}
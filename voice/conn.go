@@ -0,0 +1,300 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+// Package voice implements a Discord voice connection driven only by a voice session.
+//
+// Unlike a full bot session it only needs the session id, token and endpoint
+// Discord sends in the Voice State Update and Voice Server Update events, which
+// allows nodes to send audio on behalf of bots running elsewhere.
+//
+// See: https://discordapp.com/developers/docs/topics/voice-connections
+package voice
+
+import (
+	"errors"
+	"github.com/dondish/lionplayer/core"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/gorilla/websocket"
+	"net"
+	"sync"
+	"time"
+)
+
+// silenceFrames is the amount of silence frames sent when the audio stops.
+const silenceFrames = 5
+
+// trailingDelay is the time without frames after which the audio is considered stopped.
+const trailingDelay = 100 * time.Millisecond
+
+// ErrClosed is returned when using a closed connection.
+var ErrClosed = errors.New("voice connection closed")
+
+// Options contains the information needed to connect to a voice server.
+type Options struct {
+	// GuildID is the id of the guild (the server_id of the voice server).
+	GuildID string
+	// UserID is the id of the user sending the audio.
+	UserID string
+	// SessionID is the session id from the Voice State Update event.
+	SessionID string
+	// Token is the token from the Voice Server Update event.
+	Token string
+	// Endpoint is the endpoint from the Voice Server Update event.
+	Endpoint string
+	// Mode is the preferred encryption mode, the best supported mode is chosen if empty.
+	Mode string
+	// Dialer is the websocket dialer used, websocket.DefaultDialer if nil.
+	Dialer *websocket.Dialer
+	// Timeout is the time to wait for each step of the handshake.
+	Timeout time.Duration
+	// ResumeAttempts is the amount of times to try resuming a dropped gateway connection.
+	ResumeAttempts int
+	// Logger logs the failures of the connection, nil for core.DefaultLogger.
+	Logger core.Logger
+}
+
+// Conn is a connection to a Discord voice server.
+type Conn struct {
+	// OnSpeaking is called when another user starts or stops speaking.
+	OnSpeaking func(SpeakingUpdate)
+
+	opts   Options
+	logger core.Logger
+
+	mu       sync.Mutex
+	ws       *websocket.Conn
+	lastBeat time.Time
+	lastAck  time.Time
+	ping     time.Duration
+	speaking bool
+	err      error
+
+	// Serializes writes to the gateway.
+	wsMu sync.Mutex
+
+	udp  *net.UDPConn
+	ssrc uint32
+	mode string
+	key  [32]byte
+
+	// Serializes the audio, guards the fields below.
+	sendMu    sync.Mutex
+	sequence  uint16
+	timestamp uint32
+	nonce     uint32
+	next      time.Time
+	lastFrame time.Time
+	trailing  *time.Timer
+
+	recv     chan Packet
+	recvOnce sync.Once
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the voice server described by the options given.
+func Dial(opts Options) (*Conn, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.ResumeAttempts <= 0 {
+		opts.ResumeAttempts = 3
+	}
+	c := &Conn{
+		opts:   opts,
+		logger: core.With(opts.Logger, core.F(core.KeyGuild, opts.GuildID)),
+		closed: make(chan struct{}),
+	}
+	if err := c.handshake(); err != nil {
+		if c.udp != nil {
+			_ = c.udp.Close()
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// SSRC returns the SSRC assigned to the connection.
+func (c *Conn) SSRC() uint32 {
+	return c.ssrc
+}
+
+// Ping returns the round trip time of the last heartbeat.
+func (c *Conn) Ping() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ping
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns the reason the connection was closed, nil if it was closed using Close.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Speaking sets the speaking state of the connection.
+func (c *Conn) Speaking(speaking bool) error {
+	c.mu.Lock()
+	if c.speaking == speaking {
+		c.mu.Unlock()
+		return nil
+	}
+	c.speaking = speaking
+	ws := c.ws
+	c.mu.Unlock()
+	s := SpeakingUpdate{SSRC: c.ssrc}
+	if speaking {
+		s.Speaking = 1
+	}
+	return c.send(ws, opSpeaking, s)
+}
+
+// WriteOpus sends a single opus frame, blocking until it is time to send it.
+//
+// A few frames of silence are sent automatically once the frames stop coming.
+func (c *Conn) WriteOpus(frame []byte) error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	if err := c.Speaking(true); err != nil {
+		return err
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if err := c.writeFrame(frame); err != nil {
+		return err
+	}
+	if c.trailing == nil {
+		c.trailing = time.AfterFunc(trailingDelay, c.trail)
+	} else {
+		c.trailing.Reset(trailingDelay)
+	}
+	return nil
+}
+
+// writeFrame paces, encrypts and sends a single frame, sendMu must be held.
+func (c *Conn) writeFrame(frame []byte) error {
+	duration, err := opus.PacketDuration(frame)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if c.next.Before(now) { // Not keeping up or resuming after a break, don't try to catch up.
+		c.next = now
+	}
+	time.Sleep(c.next.Sub(now))
+	packet := c.packet(frame)
+	if _, err := c.udp.Write(packet); err != nil {
+		return err
+	}
+	samples, _ := opus.PacketSamples(frame)
+	c.sequence++
+	c.timestamp += uint32(samples)
+	c.next = c.next.Add(duration)
+	c.lastFrame = time.Now()
+	return nil
+}
+
+// trail sends the trailing silence frames if no frame was sent lately.
+func (c *Conn) trail() {
+	c.sendMu.Lock()
+	if time.Since(c.lastFrame) < trailingDelay {
+		c.sendMu.Unlock()
+		return
+	}
+	c.sendSilence()
+	c.sendMu.Unlock()
+	if err := c.Speaking(false); err != nil {
+		c.logger.Log(core.LevelDebug, "sending the speaking state failed", core.F(core.KeyError, err))
+	}
+}
+
+// sendSilence sends the silence frames, sendMu must be held.
+func (c *Conn) sendSilence() {
+	for i := 0; i < silenceFrames; i++ {
+		if err := c.writeFrame(opus.Silence); err != nil {
+			c.logger.Log(core.LevelDebug, "sending silence failed", core.F(core.KeyError, err))
+			return
+		}
+	}
+}
+
+// fail closes the connection because of the error given.
+func (c *Conn) fail(err error) {
+	c.logger.Log(core.LevelWarn, "voice connection failed", core.F(core.KeyError, err))
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.shutdown(websocket.CloseGoingAway)
+}
+
+// shutdown closes the gateway and the UDP connection.
+func (c *Conn) shutdown(code int) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.sendMu.Lock()
+		if c.trailing != nil {
+			c.trailing.Stop()
+		}
+		c.sendMu.Unlock()
+		c.mu.Lock()
+		ws := c.ws
+		c.mu.Unlock()
+		if ws != nil {
+			c.wsMu.Lock()
+			_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+			c.wsMu.Unlock()
+			_ = ws.Close()
+		}
+		_ = c.udp.Close()
+	})
+}
+
+// Close sends the trailing silence, stops speaking and closes the connection.
+func (c *Conn) Close() error {
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+	c.sendMu.Lock()
+	if c.trailing != nil && c.trailing.Stop() {
+		c.sendSilence()
+	}
+	c.sendMu.Unlock()
+	_ = c.Speaking(false)
+	c.shutdown(websocket.CloseNormalClosure)
+	return nil
+}
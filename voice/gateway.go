@@ -0,0 +1,398 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package voice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dondish/lionplayer/core"
+	"github.com/gorilla/websocket"
+	"strings"
+	"time"
+)
+
+// The voice gateway opcodes.
+//
+// See: https://discordapp.com/developers/docs/topics/opcodes-and-status-codes#voice
+const (
+	opIdentify           = 0
+	opSelectProtocol     = 1
+	opReady              = 2
+	opHeartbeat          = 3
+	opSessionDescription = 4
+	opSpeaking           = 5
+	opHeartbeatAck       = 6
+	opResume             = 7
+	opHello              = 8
+	opResumed            = 9
+	opClientDisconnect   = 13
+)
+
+// gatewayVersion is the version of the voice gateway used.
+const gatewayVersion = 4
+
+// payload is a voice gateway message.
+type payload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+type hello struct {
+	HeartbeatInterval float64 `json:"heartbeat_interval"`
+}
+
+type identify struct {
+	ServerID  string `json:"server_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+}
+
+type resume struct {
+	ServerID  string `json:"server_id"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+}
+
+type ready struct {
+	SSRC  uint32   `json:"ssrc"`
+	IP    string   `json:"ip"`
+	Port  int      `json:"port"`
+	Modes []string `json:"modes"`
+}
+
+type selectProtocol struct {
+	Protocol string             `json:"protocol"`
+	Data     selectProtocolData `json:"data"`
+}
+
+type selectProtocolData struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Mode    string `json:"mode"`
+}
+
+type sessionDescription struct {
+	Mode      string `json:"mode"`
+	SecretKey []byte `json:"secret_key"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the secret key is sent as an array of numbers.
+func (s *sessionDescription) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Mode      string `json:"mode"`
+		SecretKey []int  `json:"secret_key"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	s.Mode = raw.Mode
+	s.SecretKey = make([]byte, len(raw.SecretKey))
+	for i, b := range raw.SecretKey {
+		s.SecretKey[i] = byte(b)
+	}
+	return nil
+}
+
+// SpeakingUpdate is sent by the gateway when a user starts or stops speaking.
+type SpeakingUpdate struct {
+	Speaking int    `json:"speaking"`
+	Delay    int    `json:"delay"`
+	SSRC     uint32 `json:"ssrc"`
+	UserID   string `json:"user_id,omitempty"`
+}
+
+// gatewayURL returns the websocket URL of the endpoint given.
+//
+// The endpoint may already contain a scheme, which allows connecting to local servers.
+func gatewayURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "wss://" + strings.TrimSuffix(endpoint, ":80")
+	}
+	return fmt.Sprintf("%s/?v=%d", strings.TrimSuffix(endpoint, "/"), gatewayVersion)
+}
+
+// CloseError is returned when the voice gateway closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e CloseError) Error() string {
+	return fmt.Sprintf("voice gateway closed: %d %s", e.Code, e.Reason)
+}
+
+// Resumable returns whether the session can be resumed after this closure.
+func (e CloseError) Resumable() bool {
+	switch e.Code {
+	case 4004, // Authentication failed
+		4006, // Session no longer valid
+		4011, // Server not found
+		4014, // Disconnected (kicked, moved or the channel was deleted)
+		4016: // Unknown encryption mode
+		return false
+	}
+	return true
+}
+
+// ErrHandshake is returned when the gateway sent something unexpected during the handshake.
+var ErrHandshake = errors.New("voice handshake failed")
+
+// send writes a payload to the gateway connection given.
+func (c *Conn) send(ws *websocket.Conn, op int, d interface{}) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	c.wsMu.Lock()
+	defer c.wsMu.Unlock()
+	_ = ws.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	return ws.WriteJSON(payload{Op: op, D: data})
+}
+
+// receive reads payloads until one with the opcode given is received and unmarshals it into v.
+func receive(ws *websocket.Conn, timeout time.Duration, op int, v interface{}) error {
+	_ = ws.SetReadDeadline(time.Now().Add(timeout))
+	defer ws.SetReadDeadline(time.Time{})
+	for {
+		var p payload
+		if err := ws.ReadJSON(&p); err != nil {
+			return closeError(err)
+		}
+		if p.Op == op {
+			if v == nil {
+				return nil
+			}
+			return json.Unmarshal(p.D, v)
+		}
+	}
+}
+
+// closeError converts websocket close errors into CloseError.
+func closeError(err error) error {
+	if ce, ok := err.(*websocket.CloseError); ok {
+		return CloseError{Code: ce.Code, Reason: ce.Text}
+	}
+	return err
+}
+
+// dialGateway connects to the gateway and waits for the Hello payload.
+func (c *Conn) dialGateway() (*websocket.Conn, time.Duration, error) {
+	dialer := c.opts.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	ws, _, err := dialer.Dial(gatewayURL(c.opts.Endpoint), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var h hello
+	if err := receive(ws, c.opts.Timeout, opHello, &h); err != nil {
+		_ = ws.Close()
+		return nil, 0, err
+	}
+	return ws, time.Duration(h.HeartbeatInterval * float64(time.Millisecond)), nil
+}
+
+// handshake identifies, discovers the external address and selects the protocol.
+func (c *Conn) handshake() error {
+	ws, interval, err := c.dialGateway()
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		_ = ws.Close()
+		return err
+	}
+	err = c.send(ws, opIdentify, identify{
+		ServerID:  c.opts.GuildID,
+		UserID:    c.opts.UserID,
+		SessionID: c.opts.SessionID,
+		Token:     c.opts.Token,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	var r ready
+	if err := receive(ws, c.opts.Timeout, opReady, &r); err != nil {
+		return fail(err)
+	}
+	mode := selectMode(c.opts.Mode, r.Modes)
+	if mode == "" {
+		return fail(ErrNoSupportedMode)
+	}
+	if err := c.openUDP(r.IP, r.Port, r.SSRC); err != nil {
+		return fail(err)
+	}
+	ip, port, err := c.discover()
+	if err != nil {
+		return fail(err)
+	}
+	err = c.send(ws, opSelectProtocol, selectProtocol{
+		Protocol: "udp",
+		Data:     selectProtocolData{Address: ip, Port: port, Mode: mode},
+	})
+	if err != nil {
+		return fail(err)
+	}
+	var sd sessionDescription
+	if err := receive(ws, c.opts.Timeout, opSessionDescription, &sd); err != nil {
+		return fail(err)
+	}
+	if len(sd.SecretKey) != len(c.key) {
+		return fail(ErrHandshake)
+	}
+	c.mu.Lock()
+	c.mode = sd.Mode
+	copy(c.key[:], sd.SecretKey)
+	c.mu.Unlock()
+	c.attach(ws, interval)
+	return nil
+}
+
+// resume reconnects to the gateway and resumes the session.
+func (c *Conn) resume() error {
+	ws, interval, err := c.dialGateway()
+	if err != nil {
+		return err
+	}
+	err = c.send(ws, opResume, resume{
+		ServerID:  c.opts.GuildID,
+		SessionID: c.opts.SessionID,
+		Token:     c.opts.Token,
+	})
+	if err == nil {
+		err = receive(ws, c.opts.Timeout, opResumed, nil)
+	}
+	if err != nil {
+		_ = ws.Close()
+		return err
+	}
+	c.attach(ws, interval)
+	return nil
+}
+
+// attach starts serving the gateway connection given.
+func (c *Conn) attach(ws *websocket.Conn, interval time.Duration) {
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.ws = ws
+	c.lastBeat, c.lastAck = time.Time{}, time.Time{}
+	c.mu.Unlock()
+	go c.heartbeat(ws, interval, done)
+	go c.listen(ws, done)
+}
+
+// heartbeat sends heartbeats until done is closed, closing the connection if they are not acknowledged.
+func (c *Conn) heartbeat(ws *websocket.Conn, interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.mu.Lock()
+		missed := !c.lastBeat.IsZero() && c.lastAck.Before(c.lastBeat)
+		c.lastBeat = time.Now()
+		nonce := c.lastBeat.UnixNano() / int64(time.Millisecond)
+		c.mu.Unlock()
+		if missed { // A zombie connection, reconnecting will resume it.
+			c.logger.Log(core.LevelWarn, "heartbeat not acknowledged, reconnecting to the voice gateway")
+			_ = ws.Close()
+			return
+		}
+		if err := c.send(ws, opHeartbeat, nonce); err != nil {
+			// Writing failed so the connection is broken, listen notices it and resumes.
+			c.logger.Log(core.LevelDebug, "sending a heartbeat failed", core.F(core.KeyError, err))
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listen reads the gateway connection until it is closed and resumes the session if possible.
+func (c *Conn) listen(ws *websocket.Conn, done chan struct{}) {
+	var err error
+	for {
+		var p payload
+		if err = ws.ReadJSON(&p); err != nil {
+			break
+		}
+		switch p.Op {
+		case opHeartbeatAck:
+			c.mu.Lock()
+			c.lastAck = time.Now()
+			c.ping = c.lastAck.Sub(c.lastBeat)
+			c.mu.Unlock()
+		case opSpeaking:
+			var s SpeakingUpdate
+			if json.Unmarshal(p.D, &s) == nil && c.OnSpeaking != nil {
+				c.OnSpeaking(s)
+			}
+		case opSessionDescription:
+			var sd sessionDescription
+			if json.Unmarshal(p.D, &sd) == nil && len(sd.SecretKey) == len(c.key) {
+				c.mu.Lock()
+				c.mode = sd.Mode
+				copy(c.key[:], sd.SecretKey)
+				c.mu.Unlock()
+			}
+		}
+	}
+	close(done)
+	_ = ws.Close()
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	err = closeError(err)
+	if ce, ok := err.(CloseError); ok && !ce.Resumable() {
+		c.fail(err)
+		return
+	}
+	c.logger.Log(core.LevelInfo, "voice gateway connection dropped, resuming", core.F(core.KeyError, err))
+	for attempt := 0; attempt < c.opts.ResumeAttempts; attempt++ {
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+		if err = c.resume(); err == nil {
+			c.logger.Log(core.LevelInfo, "resumed the voice session", core.F("attempt", attempt+1))
+			return
+		}
+		c.logger.Log(core.LevelWarn, "resuming the voice session failed", core.F("attempt", attempt+1), core.F(core.KeyError, err))
+		if ce, ok := err.(CloseError); ok && !ce.Resumable() {
+			break
+		}
+	}
+	c.fail(err)
+}
@@ -0,0 +1,117 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package voice
+
+import (
+	"encoding/binary"
+	"github.com/dondish/lionplayer/core"
+)
+
+// receiveBuffer is the amount of received packets buffered until they are read.
+const receiveBuffer = 64
+
+// payloadType is the RTP payload type of Opus audio.
+const payloadType = 0x78
+
+// Packet is an Opus frame received from another user.
+type Packet struct {
+	SSRC      uint32
+	Sequence  uint16
+	Timestamp uint32
+	Opus      []byte
+}
+
+// Receive returns the channel the audio sent by other users is received on.
+//
+// The channel is closed when the connection is closed. Speaking updates map
+// the SSRC of the packets to the users who sent them, see OnSpeaking.
+func (c *Conn) Receive() <-chan Packet {
+	c.recvOnce.Do(func() {
+		c.recv = make(chan Packet, receiveBuffer)
+		go c.receive()
+	})
+	return c.recv
+}
+
+// receive reads the UDP connection until it is closed.
+func (c *Conn) receive() {
+	defer close(c.recv)
+	buf := make([]byte, 1500)
+	for {
+		n, err := c.udp.Read(buf)
+		if err != nil {
+			select {
+			case <-c.closed:
+				return
+			default:
+			}
+			if ne, ok := err.(interface{ Temporary() bool }); ok && ne.Temporary() {
+				continue
+			}
+			c.logger.Log(core.LevelWarn, "receiving audio failed", core.F(core.KeyError, err))
+			return
+		}
+		c.mu.Lock()
+		mode, key := c.mode, c.key
+		c.mu.Unlock()
+		p, ok := parseRTP(mode, &key, buf[:n])
+		if !ok {
+			continue
+		}
+		select {
+		case c.recv <- p:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// parseRTP decrypts an RTP packet and strips its header extension.
+func parseRTP(mode string, key *[32]byte, data []byte) (Packet, bool) {
+	if len(data) < rtpHeaderSize || data[0]>>6 != 2 || data[1]&0x7F != payloadType {
+		return Packet{}, false
+	}
+	payload, ok := Decrypt(mode, key, data)
+	if !ok {
+		return Packet{}, false
+	}
+	// The CSRC identifiers and the header extension are sent encrypted.
+	skip := 4 * int(data[0]&0x0F)
+	if data[0]&0x10 != 0 {
+		if len(payload) < skip+4 {
+			return Packet{}, false
+		}
+		skip += 4 + 4*int(binary.BigEndian.Uint16(payload[skip+2:]))
+	}
+	if len(payload) <= skip {
+		return Packet{}, false
+	}
+	return Packet{
+		SSRC:      binary.BigEndian.Uint32(data[8:]),
+		Sequence:  binary.BigEndian.Uint16(data[2:]),
+		Timestamp: binary.BigEndian.Uint32(data[4:]),
+		Opus:      payload[skip:],
+	}, true
+}
@@ -0,0 +1,190 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package voice
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The supported encryption modes.
+const (
+	// ModeXSalsa20Poly1305 uses the RTP header as the nonce.
+	ModeXSalsa20Poly1305 = "xsalsa20_poly1305"
+	// ModeXSalsa20Poly1305Suffix uses a random nonce appended to the packet.
+	ModeXSalsa20Poly1305Suffix = "xsalsa20_poly1305_suffix"
+	// ModeXSalsa20Poly1305Lite uses an incremental 4 byte nonce appended to the packet.
+	ModeXSalsa20Poly1305Lite = "xsalsa20_poly1305_lite"
+)
+
+// supportedModes are the supported encryption modes in order of preference.
+var supportedModes = []string{ModeXSalsa20Poly1305Lite, ModeXSalsa20Poly1305Suffix, ModeXSalsa20Poly1305}
+
+// ErrNoSupportedMode is returned when the voice server does not offer any supported encryption mode.
+var ErrNoSupportedMode = errors.New("no supported encryption mode")
+
+// ErrDiscovery is returned when the IP discovery fails.
+var ErrDiscovery = errors.New("ip discovery failed")
+
+// rtpHeaderSize is the size of the RTP header.
+const rtpHeaderSize = 12
+
+// discoveryPacketSize is the size of the IP discovery packets.
+const discoveryPacketSize = 74
+
+// selectMode selects the encryption mode to use out of the modes offered by the server.
+func selectMode(preferred string, offered []string) string {
+	has := func(mode string) bool {
+		for _, m := range offered {
+			if m == mode {
+				return true
+			}
+		}
+		return false
+	}
+	if preferred != "" {
+		if has(preferred) {
+			return preferred
+		}
+		return ""
+	}
+	for _, m := range supportedModes {
+		if has(m) {
+			return m
+		}
+	}
+	return ""
+}
+
+// openUDP opens the UDP connection to the voice server.
+func (c *Conn) openUDP(ip string, port int, ssrc uint32) error {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	c.udp, err = net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return err
+	}
+	c.ssrc = ssrc
+	return nil
+}
+
+// discover finds out the external address and port of the UDP connection.
+//
+// See: https://discordapp.com/developers/docs/topics/voice-connections#ip-discovery
+func (c *Conn) discover() (string, int, error) {
+	req := make([]byte, discoveryPacketSize)
+	binary.BigEndian.PutUint16(req, 1)      // Request
+	binary.BigEndian.PutUint16(req[2:], 70) // Length
+	binary.BigEndian.PutUint32(req[4:], c.ssrc)
+	res := make([]byte, discoveryPacketSize)
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := c.udp.Write(req); err != nil {
+			return "", 0, err
+		}
+		_ = c.udp.SetReadDeadline(time.Now().Add(c.opts.Timeout / 3))
+		n, err := c.udp.Read(res)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return "", 0, err
+		}
+		_ = c.udp.SetReadDeadline(time.Time{})
+		if n < discoveryPacketSize || binary.BigEndian.Uint16(res) != 2 {
+			return "", 0, ErrDiscovery
+		}
+		address := res[8:72]
+		for i, b := range address {
+			if b == 0 {
+				address = address[:i]
+				break
+			}
+		}
+		return string(address), int(binary.BigEndian.Uint16(res[72:])), nil
+	}
+	return "", 0, ErrDiscovery
+}
+
+// packet builds the encrypted RTP packet of the frame given, sendMu must be held.
+func (c *Conn) packet(frame []byte) []byte {
+	header := make([]byte, rtpHeaderSize, rtpHeaderSize+len(frame)+secretbox.Overhead+24)
+	header[0] = 0x80 // Version 2
+	header[1] = 0x78 // Payload type
+	binary.BigEndian.PutUint16(header[2:], c.sequence)
+	binary.BigEndian.PutUint32(header[4:], c.timestamp)
+	binary.BigEndian.PutUint32(header[8:], c.ssrc)
+
+	c.mu.Lock()
+	mode, key := c.mode, c.key
+	c.mu.Unlock()
+	var nonce [24]byte
+	switch mode {
+	case ModeXSalsa20Poly1305Lite:
+		c.nonce++
+		binary.BigEndian.PutUint32(nonce[:], c.nonce)
+		return append(secretbox.Seal(header, frame, &nonce, &key), nonce[:4]...)
+	case ModeXSalsa20Poly1305Suffix:
+		_, _ = rand.Read(nonce[:])
+		return append(secretbox.Seal(header, frame, &nonce, &key), nonce[:]...)
+	default:
+		copy(nonce[:], header)
+		return secretbox.Seal(header, frame, &nonce, &key)
+	}
+}
+
+// Decrypt decrypts the opus payload of an RTP packet encrypted using the mode and key given.
+//
+// It returns false if the packet can't be authenticated.
+func Decrypt(mode string, key *[32]byte, packet []byte) ([]byte, bool) {
+	if len(packet) < rtpHeaderSize+secretbox.Overhead {
+		return nil, false
+	}
+	var nonce [24]byte
+	header, body := packet[:rtpHeaderSize], packet[rtpHeaderSize:]
+	switch mode {
+	case ModeXSalsa20Poly1305Lite:
+		if len(body) < secretbox.Overhead+4 {
+			return nil, false
+		}
+		copy(nonce[:], body[len(body)-4:])
+		body = body[:len(body)-4]
+	case ModeXSalsa20Poly1305Suffix:
+		if len(body) < secretbox.Overhead+24 {
+			return nil, false
+		}
+		copy(nonce[:], body[len(body)-24:])
+		body = body[:len(body)-24]
+	default:
+		copy(nonce[:], header)
+	}
+	return secretbox.Open(nil, body, &nonce, key)
+}
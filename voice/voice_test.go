@@ -0,0 +1,260 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package voice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/dondish/lionplayer/opus"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is a minimal stand-in for a Discord voice server.
+type fakeServer struct {
+	modes []string
+	key   [32]byte
+	udp   *net.UDPConn
+	http  *httptest.Server
+
+	// closeCode closes the first gateway connection with this code once the session is described.
+	closeCode int
+
+	mu      sync.Mutex
+	mode    string
+	resumes int
+	frames  chan []byte
+}
+
+func newFakeServer(t *testing.T, modes ...string) *fakeServer {
+	s := &fakeServer{modes: modes, frames: make(chan []byte, 64)}
+	for i := range s.key {
+		s.key[i] = byte(i)
+	}
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.udp = udp
+	go s.serveUDP()
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveGateway))
+	return s
+}
+
+func (s *fakeServer) Close() {
+	s.http.Close()
+	_ = s.udp.Close()
+}
+
+func (s *fakeServer) endpoint() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http")
+}
+
+func (s *fakeServer) serveUDP() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n == discoveryPacketSize && binary.BigEndian.Uint16(buf) == 1 {
+			res := make([]byte, discoveryPacketSize)
+			binary.BigEndian.PutUint16(res, 2)
+			binary.BigEndian.PutUint16(res[2:], 70)
+			copy(res[4:], buf[4:8])
+			copy(res[8:], addr.IP.String())
+			binary.BigEndian.PutUint16(res[72:], uint16(addr.Port))
+			_, _ = s.udp.WriteToUDP(res, addr)
+			continue
+		}
+		s.mu.Lock()
+		mode := s.mode
+		s.mu.Unlock()
+		if frame, ok := Decrypt(mode, &s.key, buf[:n]); ok {
+			s.frames <- frame
+		}
+	}
+}
+
+func (s *fakeServer) serveGateway(w http.ResponseWriter, r *http.Request) {
+	ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	send := func(op int, d interface{}) {
+		data, _ := json.Marshal(d)
+		_ = ws.WriteJSON(payload{Op: op, D: data})
+	}
+	send(opHello, hello{HeartbeatInterval: 100})
+	for {
+		var p payload
+		if err := ws.ReadJSON(&p); err != nil {
+			return
+		}
+		switch p.Op {
+		case opIdentify:
+			port := s.udp.LocalAddr().(*net.UDPAddr).Port
+			send(opReady, ready{SSRC: 42, IP: "127.0.0.1", Port: port, Modes: s.modes})
+		case opSelectProtocol:
+			var sp selectProtocol
+			_ = json.Unmarshal(p.D, &sp)
+			s.mu.Lock()
+			s.mode = sp.Data.Mode
+			s.mu.Unlock()
+			key := make([]int, len(s.key))
+			for i, b := range s.key {
+				key[i] = int(b)
+			}
+			send(opSessionDescription, map[string]interface{}{"mode": sp.Data.Mode, "secret_key": key})
+			if s.closeCode != 0 {
+				_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(s.closeCode, ""))
+				return
+			}
+		case opResume:
+			s.mu.Lock()
+			s.resumes++
+			s.mu.Unlock()
+			send(opResumed, nil)
+		case opHeartbeat:
+			send(opHeartbeatAck, json.RawMessage(p.D))
+		}
+	}
+}
+
+func (s *fakeServer) dial(t *testing.T) *Conn {
+	c, err := Dial(Options{GuildID: "1", UserID: "2", SessionID: "3", Token: "4", Endpoint: s.endpoint(), Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *fakeServer) receive(t *testing.T) []byte {
+	select {
+	case frame := <-s.frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("no frame received")
+		return nil
+	}
+}
+
+func TestGatewayURL(t *testing.T) {
+	assert.Equal(t, "wss://voice.discord.media/?v=4", gatewayURL("voice.discord.media:80"))
+	assert.Equal(t, "ws://localhost:1234/?v=4", gatewayURL("ws://localhost:1234"))
+}
+
+func TestSelectMode(t *testing.T) {
+	all := []string{ModeXSalsa20Poly1305, ModeXSalsa20Poly1305Suffix, ModeXSalsa20Poly1305Lite}
+	assert.Equal(t, ModeXSalsa20Poly1305Lite, selectMode("", all))
+	assert.Equal(t, ModeXSalsa20Poly1305, selectMode(ModeXSalsa20Poly1305, all))
+	assert.Equal(t, "", selectMode("", []string{"aead_aes256_gcm"}))
+}
+
+func TestConn_Modes(t *testing.T) {
+	for _, mode := range []string{ModeXSalsa20Poly1305, ModeXSalsa20Poly1305Suffix, ModeXSalsa20Poly1305Lite} {
+		t.Run(mode, func(t *testing.T) {
+			s := newFakeServer(t, mode)
+			defer s.Close()
+			c := s.dial(t)
+			assert.Equal(t, uint32(42), c.SSRC())
+
+			frame := []byte{0xFC, 1, 2, 3}
+			for i := 0; i < 3; i++ {
+				assert.Nil(t, c.WriteOpus(frame), "error is supposed to be nil")
+				assert.True(t, bytes.Equal(frame, s.receive(t)), "the frame should decrypt to the original")
+			}
+			assert.Nil(t, c.Close())
+			for i := 0; i < silenceFrames; i++ {
+				assert.Equal(t, opus.Silence, s.receive(t), "silence should trail the audio")
+			}
+			assert.Equal(t, ErrClosed, c.WriteOpus(frame))
+		})
+	}
+}
+
+func TestConn_Resume(t *testing.T) {
+	s := newFakeServer(t, ModeXSalsa20Poly1305Lite)
+	s.closeCode = 4015 // Voice server crashed
+	defer s.Close()
+	c := s.dial(t)
+	defer c.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		resumes := s.resumes
+		s.mu.Unlock()
+		if resumes > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the session was not resumed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, c.Err(), "the connection should survive a resumable close")
+	assert.Nil(t, c.WriteOpus(opus.Silence))
+	assert.Equal(t, opus.Silence, s.receive(t))
+}
+
+func TestConn_NotResumable(t *testing.T) {
+	s := newFakeServer(t, ModeXSalsa20Poly1305Lite)
+	s.closeCode = 4014 // Disconnected
+	defer s.Close()
+	c := s.dial(t)
+
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection should close")
+	}
+	assert.Equal(t, CloseError{Code: 4014}, c.Err())
+}
+
+func TestParseRTP(t *testing.T) {
+	c := &Conn{ssrc: 7, mode: ModeXSalsa20Poly1305Lite, sequence: 3, timestamp: 960}
+	frame := []byte{0xFC, 1, 2, 3}
+	extension := []byte{0xBE, 0xDE, 0, 1, 0x10, 0xFF, 0, 0}
+	data := c.packet(append(extension, frame...))
+	data[0] |= 0x10 // Extension present
+
+	p, ok := parseRTP(c.mode, &c.key, data)
+	assert.True(t, ok, "the packet should be parsed")
+	assert.Equal(t, Packet{SSRC: 7, Sequence: 3, Timestamp: 960, Opus: frame}, p)
+
+	data[len(data)-5] ^= 1
+	_, ok = parseRTP(c.mode, &c.key, data)
+	assert.False(t, ok, "a tampered packet should be rejected")
+}
@@ -0,0 +1,188 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package webm
+
+import (
+	"encoding/binary"
+	"github.com/dondish/lionplayer/opus"
+	"io"
+	"math"
+	"time"
+)
+
+// unknownSize is the EBML size used for elements whose size is not known in advance (live streams).
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// maxClusterDuration is the longest cluster written, SimpleBlock timecodes are relative int16 milliseconds.
+const maxClusterDuration = 30 * time.Second
+
+// Muxer writes Opus packets into a live WebM stream.
+//
+// Both the Segment and the Clusters are written with an unknown size, which
+// means the output can be consumed while it is being written.
+type Muxer struct {
+	w        io.Writer
+	channels int
+	rate     int
+	// The timecode of the next packet, relative to the beginning of the stream
+	timecode time.Duration
+	// The timecode of the current cluster, -1 if no cluster was started
+	cluster time.Duration
+}
+
+// NewMuxer creates a new Muxer writing to w.
+func NewMuxer(w io.Writer, channels, sampleRate int) *Muxer {
+	return &Muxer{
+		w:        w,
+		channels: channels,
+		rate:     sampleRate,
+		cluster:  -1,
+	}
+}
+
+// encodeSize encodes the size given as an EBML variable size integer.
+func encodeSize(size int) []byte {
+	for l := 1; l <= 8; l++ {
+		if uint64(size) < 1<<uint(7*l)-1 {
+			b := make([]byte, l)
+			v := uint64(size) | 1<<uint(7*l)
+			for i := l - 1; i >= 0; i-- {
+				b[i] = byte(v)
+				v >>= 8
+			}
+			return b
+		}
+	}
+	return unknownSize
+}
+
+// element encodes an EBML element with the id and payload given.
+func element(id uint32, payload ...[]byte) []byte {
+	var size int
+	for _, p := range payload {
+		size += len(p)
+	}
+	b := encodeId(id)
+	b = append(b, encodeSize(size)...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// encodeId encodes an element id, ids already contain their length marker.
+func encodeId(id uint32) []byte {
+	switch {
+	case id > 0xFFFFFF:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFFFF:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xFF:
+		return []byte{byte(id >> 8), byte(id)}
+	}
+	return []byte{byte(id)}
+}
+
+// uintElement encodes an unsigned integer element.
+func uintElement(id uint32, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	i := 0
+	for i < 7 && b[i] == 0 {
+		i++
+	}
+	return element(id, b[i:])
+}
+
+// floatElement encodes a float element.
+func floatElement(id uint32, v float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	return element(id, b[:])
+}
+
+// WriteHeaders writes the EBML header, the beginning of the Segment, the Info and Tracks elements.
+func (m *Muxer) WriteHeaders() error {
+	header := element(0x1A45DFA3,
+		uintElement(0x4286, 1),          // EBMLVersion
+		uintElement(0x42F7, 1),          // EBMLReadVersion
+		uintElement(0x42F2, 4),          // EBMLMaxIDLength
+		uintElement(0x42F3, 8),          // EBMLMaxSizeLength
+		element(0x4282, []byte("webm")), // DocType
+		uintElement(0x4287, 4),          // DocTypeVersion
+		uintElement(0x4285, 2),          // DocTypeReadVersion
+	)
+	segment := append(encodeId(0x18538067), unknownSize...)
+	info := element(0x1549A966,
+		uintElement(0x2AD7B1, uint64(time.Millisecond)), // TimecodeScale
+		element(0x4D80, []byte("lionplayer")),           // MuxingApp
+		element(0x5741, []byte("lionplayer")),           // WritingApp
+	)
+	tracks := element(0x1654AE6B,
+		element(0xAE,
+			uintElement(0xD7, 1),                              // TrackNumber
+			uintElement(0x73C5, 1),                            // TrackUID
+			uintElement(0x83, 2),                              // TrackType (audio)
+			element(0x86, []byte("A_OPUS")),                   // CodecID
+			element(0x63A2, opus.Head(m.channels, m.rate, 0)), // CodecPrivate
+			element(0xE1, floatElement(0xB5, float64(opus.SampleRate)), // Audio
+				uintElement(0x9F, uint64(m.channels))),
+		),
+	)
+	for _, b := range [][]byte{header, segment, info, tracks} {
+		if _, err := m.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePacket writes an Opus packet as a SimpleBlock, starting a new Cluster when needed.
+func (m *Muxer) WritePacket(data []byte) error {
+	duration, err := opus.PacketDuration(data)
+	if err != nil {
+		return err
+	}
+	if m.cluster < 0 || m.timecode-m.cluster >= maxClusterDuration {
+		m.cluster = m.timecode
+		cluster := append(encodeId(0x1F43B675), unknownSize...)
+		cluster = append(cluster, uintElement(0xE7, uint64(m.cluster/time.Millisecond))...)
+		if _, err := m.w.Write(cluster); err != nil {
+			return err
+		}
+	}
+	rel := int16((m.timecode - m.cluster) / time.Millisecond)
+	block := []byte{0x81, byte(uint16(rel) >> 8), byte(rel), 0x80} // Track 1, keyframe
+	if _, err := m.w.Write(element(0xA3, block, data)); err != nil {
+		return err
+	}
+	m.timecode += duration
+	return nil
+}
+
+// Timecode returns the duration of the audio written.
+func (m *Muxer) Timecode() time.Duration {
+	return m.timecode
+}
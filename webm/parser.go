@@ -75,6 +75,10 @@ type Seek struct {
 // Parser abstracts the parsing of ebml files (and streams).
 type Parser struct {
 	*ebml.Element
+	// Logger logs the events of the parser and of the track parsed, nil for core.DefaultLogger.
+	Logger core.Logger
+	// closer closes the stream being parsed once the track stops playing, nil if it can't be closed.
+	closer io.Closer
 }
 
 // CuePoint contains all information relative to a seek point in the Segment.
@@ -86,13 +90,16 @@ type CuePoint struct {
 }
 
 // New creates a new parser instance for the input stream given.
+//
+// If the stream is an io.Closer the track parsed closes it when it stops playing.
 func New(rs io.ReadSeeker) (*Parser, error) {
 	var e *ebml.Element
 	e, err := ebml.RootElement(rs)
 	if err != nil {
 		return nil, err
 	}
-	return &Parser{e}, nil
+	closer, _ := rs.(io.Closer)
+	return &Parser{Element: e, closer: closer}, nil
 }
 
 // parseMetaSeek parses the SeekHead and returns the position of the Cues element in the segment.
@@ -156,7 +163,10 @@ func (p *Parser) parseSegment(segment *ebml.Element) (*Track, error) {
 	t := Track{
 		Output:  make(chan core.Packet),
 		seek:    make(chan time.Duration, 3),
+		seekTo:  make(chan time.Duration, 1),
 		parser:  p,
+		closer:  p.closer,
+		logger:  p.Logger,
 		segment: segment,
 		cues:    0,
 		trackId: 0,
@@ -190,7 +200,7 @@ func (p *Parser) parseSegment(segment *ebml.Element) (*Track, error) {
 			t.codec = strings.ToLower(strings.TrimPrefix(t.tracks[0].CodecID, "A_"))
 			t.samplerate = int(t.tracks[0].SamplingFrequency)
 		case 0x1C53BB6B: // Cues
-			t.cuepoints, err = parseCues(el, len(t.tracks))
+			t.cuepoints, err = parseCues(el, len(t.tracks), p.Logger)
 			if err != nil {
 				return nil, err
 			}
@@ -32,7 +32,6 @@ import (
 	"github.com/dondish/lionplayer/core"
 	"github.com/ebml-go/ebml"
 	"io"
-	"log"
 	"time"
 )
 
@@ -81,10 +80,16 @@ type Track struct {
 	Output chan core.Packet
 	// The signal channel
 	seek chan time.Duration
+	// The position to seek to, holds only the latest seek
+	seekTo chan time.Duration
 	// The parser responsible for this Track
 	parser *Parser
 	// The segment element
 	segment *ebml.Element
+	// Closes the stream once the track stops playing, nil if it can't be closed
+	closer io.Closer
+	// The logger of the parser
+	logger core.Logger
 	// The position of the cues element
 	cues int64
 	// A slice of saved cuepoints
@@ -127,10 +132,8 @@ func (t Track) Pause(b bool) {
 	}
 }
 
-// Close stops the Track and frees up resources.
+// Close stops the Track and frees up resources, the stream is closed once Play returns.
 func (t *Track) Close() error {
-	t.segment = nil
-	t.parser = nil
 	t.seek <- shutdown
 	return nil
 }
@@ -178,9 +181,10 @@ func getClusterPositions(positions *ebml.Element, tracklen int) (poses []uint64,
 }
 
 // parseCues parses the Cues element and returns a slice of cuepoints found in it.
-func parseCues(cues *ebml.Element, tracklen int) ([]CuePoint, error) {
+func parseCues(cues *ebml.Element, tracklen int, logger core.Logger) ([]CuePoint, error) {
 	if cues.Id != 0x1C53BB6B {
-		log.Println("wrong cues id", fmt.Sprintf("%#x", cues.Id))
+		core.LoggerOr(logger).Log(core.LevelWarn, "wrong cues id", core.F("id", fmt.Sprintf("%#x", cues.Id)),
+			core.F(core.KeyOffset, cues.Offset))
 	}
 	cuepoints := make([]CuePoint, 0)
 	var tim *ebml.Element
@@ -224,7 +228,10 @@ func (t Track) internalSeek(duration time.Duration) error {
 			return err
 		}
 		cues, err := t.segment.Next()
-		t.cuepoints, err = parseCues(cues, len(t.tracks))
+		if err != nil {
+			return err
+		}
+		t.cuepoints, err = parseCues(cues, len(t.tracks), t.logger)
 		if err != nil {
 			return err
 		}
@@ -242,9 +249,20 @@ func (t Track) internalSeek(duration time.Duration) error {
 }
 
 // Seek sends a seek signal to the player, it will seek to that position after finishing up with the current cluster.
+//
+// Seek never blocks, a seek that wasn't handled yet is replaced by the new one.
 func (t Track) Seek(duration time.Duration) error {
-	t.seek <- duration
-	return nil
+	for {
+		select {
+		case t.seekTo <- duration:
+			return nil
+		default:
+		}
+		select {
+		case <-t.seekTo:
+		default:
+		}
+	}
 }
 
 func remaining(x int8) (rem int) {
@@ -359,7 +377,7 @@ func (t *Track) handleBlock(block []byte, currtime time.Duration) {
 // handleCluster handles the Cluster element.
 func (t *Track) handleCluster(cluster *ebml.Element, currtime time.Duration) {
 	var err error
-	for err == nil && len(t.seek) == 0 {
+	for err == nil && len(t.seek) == 0 && len(t.seekTo) == 0 {
 		var e *ebml.Element
 		e, err = cluster.Next()
 		var block []byte
@@ -388,6 +406,9 @@ func (t *Track) handleCluster(cluster *ebml.Element, currtime time.Duration) {
 func (t Track) Play() {
 	var err error
 	defer close(t.Output)
+	if t.closer != nil {
+		defer t.closer.Close()
+	}
 	for err == nil {
 		var c Cluster
 		var data *ebml.Element
@@ -414,11 +435,15 @@ func (t Track) Play() {
 		if seek == shutdown {
 			break
 		}
-		if seek != badTC {
+		select {
+		case seek = <-t.seekTo:
 			err = t.internalSeek(seek)
+		default:
 		}
 	}
 	if err != nil && err != io.EOF {
-		log.Println("play error", err)
+		offset, _ := t.segment.Seek(0, io.SeekCurrent)
+		core.LoggerOr(t.logger).Log(core.LevelError, "webm playback failed", core.F(core.KeyError, err),
+			core.F(core.KeyOffset, offset))
 	}
 }
@@ -0,0 +1,220 @@
+/*
+MIT License
+
+Copyright (c) 2019 Oded Shapira
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package youtube
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Search searches youtube for videos matching the query and returns up to limit of them.
+//
+// The tracks found have no format yet, it is resolved when they are played.
+func (yt Source) Search(query string, limit int) ([]*Track, error) {
+	resjson, err := yt.getJSON("https://www.youtube.com/results?search_query=" + url.QueryEscape(query) + "&pbj=1&hl=en")
+	if err != nil {
+		return nil, err
+	}
+	tracks := parseSearchResults(resjson, limit)
+	for _, track := range tracks {
+		track.source = &yt
+	}
+	return tracks, nil
+}
+
+// Related returns up to limit of the videos youtube suggests watching after the video given, up next first.
+//
+// The tracks found have no format yet, it is resolved when they are played.
+func (yt Source) Related(videoId string, limit int) ([]*Track, error) {
+	resjson, err := yt.getJSON("https://www.youtube.com/watch?v=" + url.QueryEscape(videoId) + "&pbj=1&hl=en")
+	if err != nil {
+		return nil, err
+	}
+	tracks := parseRelated(resjson, videoId, limit)
+	for _, track := range tracks {
+		track.source = &yt
+	}
+	return tracks, nil
+}
+
+// getJSON requests a page in its JSON form and decodes it.
+func (yt Source) getJSON(u string) (interface{}, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("User-Agent", "lionPlayer v0.1")
+	req.Header.Add("X-YouTube-Client-Name", "1")
+	req.Header.Add("X-YouTube-Client-Version", "2.20191008.04.01")
+	res, err := yt.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var resjson interface{}
+	if err := json.NewDecoder(res.Body).Decode(&resjson); err != nil {
+		return nil, err
+	}
+	return resjson, nil
+}
+
+// parseSearchResults finds the video renderers in the search response, in order.
+func parseSearchResults(v interface{}, limit int) []*Track {
+	var tracks []*Track
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if len(tracks) >= limit {
+			return
+		}
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			if renderer, ok := v["videoRenderer"].(map[string]interface{}); ok {
+				if track := parseVideoRenderer(renderer); track != nil {
+					tracks = append(tracks, track)
+				}
+				return
+			}
+			// Maps are unordered, the results are under "contents" while ads and shelves are elsewhere.
+			if contents, ok := v["contents"]; ok {
+				walk(contents)
+				return
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(v)
+	return tracks
+}
+
+// parseRelated finds the compact video renderers in the watch response, in order, leaving out the video itself.
+func parseRelated(v interface{}, videoId string, limit int) []*Track {
+	var tracks []*Track
+	seen := map[string]bool{videoId: true}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if len(tracks) >= limit {
+			return
+		}
+		switch v := v.(type) {
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		case map[string]interface{}:
+			if renderer, ok := v["compactVideoRenderer"].(map[string]interface{}); ok {
+				if track := parseVideoRenderer(renderer); track != nil && !seen[track.VideoId] {
+					seen[track.VideoId] = true
+					tracks = append(tracks, track)
+				}
+				return
+			}
+			// Maps are unordered, walking the keys in order puts the up next video, which comes first in the
+			// results, before the rest of them.
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(v[key])
+			}
+		}
+	}
+	walk(v)
+	return tracks
+}
+
+// parseVideoRenderer converts a video renderer into a track, nil if it is not a video.
+func parseVideoRenderer(renderer map[string]interface{}) *Track {
+	videoId, _ := renderer["videoId"].(string)
+	if videoId == "" {
+		return nil
+	}
+	track := &Track{
+		VideoId: videoId,
+		Title:   rendererText(renderer["title"]),
+		Author:  rendererText(renderer["ownerText"]),
+	}
+	if track.Author == "" {
+		track.Author = rendererText(renderer["longBylineText"])
+	}
+	length, ok := parseLength(rendererText(renderer["lengthText"]))
+	if ok {
+		track.Length = length
+	} else {
+		// Live streams have no length.
+		track.IsStream = true
+		track.Length = math.MaxInt64
+	}
+	return track
+}
+
+// rendererText returns the text of a text renderer, either simple or made of runs.
+func rendererText(v interface{}) string {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if text, ok := m["simpleText"].(string); ok {
+		return text
+	}
+	runs, _ := m["runs"].([]interface{})
+	var sb strings.Builder
+	for _, run := range runs {
+		if r, ok := run.(map[string]interface{}); ok {
+			text, _ := r["text"].(string)
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// parseLength parses a length like 1:02:03 or 3:45.
+func parseLength(text string) (time.Duration, bool) {
+	if text == "" {
+		return 0, false
+	}
+	var length time.Duration
+	for _, part := range strings.Split(text, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		length = length*60 + time.Duration(n)
+	}
+	return length * time.Second, true
+}
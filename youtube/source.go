@@ -33,6 +33,7 @@ import (
 	"github.com/dondish/lionplayer/core"
 	"math"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"time"
@@ -40,7 +41,9 @@ import (
 
 // Source is an HTTP
 type Source struct {
-	Client *http.Client
+	Client  *http.Client
+	Logger  core.Logger  // The logger of the tracks played, nil for core.DefaultLogger
+	Metrics core.Metrics // The metrics of the tracks loaded, nil for core.DefaultMetrics
 }
 
 // ErrUnplayable is the error returned by fails in PlayVideo.
@@ -67,9 +70,67 @@ func New(client *http.Client) *Source {
 	return &Source{Client: client}
 }
 
+// NewTrack creates a track of the video given without loading it, its format is resolved once it is played.
+//
+// It is used to recreate tracks that were loaded before, as their urls expire.
+func (yt *Source) NewTrack(videoId, title, author string, length time.Duration, isStream bool) *Track {
+	if isStream {
+		length = math.MaxInt64
+	}
+	return &Track{
+		VideoId:  videoId,
+		Title:    title,
+		Author:   author,
+		Length:   length,
+		IsStream: isStream,
+		source:   yt,
+	}
+}
+
+// The stages of loading a track measured in core.MetricLoadSeconds.
+const (
+	stageResolve = "resolve"
+	stageStream  = "stream"
+)
+
+// measure records the time a stage of loading a track took since start, and its failure if reason isn't empty.
+func measure(metrics core.Metrics, stage string, start time.Time, reason string) {
+	metrics = core.MetricsOr(metrics)
+	source := core.L(core.LabelSource, "youtube")
+	metrics.Observe(core.MetricLoadSeconds, time.Since(start).Seconds(), source, core.L(core.LabelStage, stage))
+	if reason != "" {
+		metrics.Add(core.MetricLoadFailures, 1, source, core.L(core.LabelReason, reason))
+	}
+}
+
+// failureReason returns the reason PlayVideo failed with the error given, empty if it is nil.
+func failureReason(err error) string {
+	switch err.(type) {
+	case nil:
+		return ""
+	case ErrUnplayable:
+		return "unplayable"
+	case ErrTrackNotFound:
+		return "not_found"
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return "parse"
+	case *url.Error:
+		return "http"
+	}
+	return "other"
+}
+
 // PlayVideo plays a video using the video id given.
 // Returns a youtube track that implements core.Track
 func (yt Source) PlayVideo(videoId string) (*Track, error) {
+	start := time.Now()
+	track, err := yt.playVideo(videoId)
+	measure(yt.Metrics, stageResolve, start, failureReason(err))
+	return track, err
+}
+
+// playVideo implements PlayVideo.
+func (yt Source) playVideo(videoId string) (*Track, error) {
 	req, err := http.NewRequest("GET", "https://www.youtube.com/watch?v="+videoId+"&pbj=1&hl=en", nil)
 	if err != nil {
 		return nil, err
@@ -81,6 +142,7 @@ func (yt Source) PlayVideo(videoId string) (*Track, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 	var resjson []interface{}
 	dec := json.NewDecoder(res.Body)
 	err = dec.Decode(&resjson)
@@ -33,6 +33,9 @@ import (
 	"time"
 )
 
+// ErrNoSource is returned when playing a track without a format that wasn't created by a Source.
+var ErrNoSource = errors.New("the track has no format and no source to resolve it")
+
 // Track represents a Youtube track.
 // Track is lazy-loaded which means that it won't
 // load anything before being instructed to, which
@@ -50,9 +53,20 @@ type Track struct {
 
 // Codec returns the codec the content is encoded in.
 func (t Track) Codec() string {
+	if t.Format == nil {
+		return "opus"
+	}
 	return strings.Trim(strings.Split(t.Format.Type, "=")[1], "\"")
 }
 
+// Bitrate returns the bitrate of the chosen format.
+func (t Track) Bitrate() int {
+	if t.Format == nil {
+		return 0
+	}
+	return int(t.Format.Bitrate)
+}
+
 // Duration returns the duration of the track.
 func (t Track) Duration() time.Duration {
 	return t.Length
@@ -64,32 +78,68 @@ func (t Track) Playable() (core.Playable, error) {
 }
 
 // PlaySeekable returns a core.PlaySeekable matching this track.
+//
+// Tracks found by searching resolve their format first.
 func (t Track) PlaySeekable() (core.PlaySeekable, error) {
-	vurl, err := t.Format.GetValidUrl()
+	format := t.Format
+	if format == nil {
+		if t.source == nil {
+			return nil, ErrNoSource
+		}
+		resolved, err := t.source.PlayVideo(t.VideoId)
+		if err != nil {
+			return nil, err
+		}
+		format = resolved.Format
+	}
+	var logger core.Logger
+	var metrics core.Metrics
+	if t.source != nil {
+		logger, metrics = t.source.Logger, t.source.Metrics
+	}
+	logger = core.With(logger, core.F(core.KeyTrack, t.VideoId))
+
+	start := time.Now()
+	file, reason, err := t.open(format, logger, metrics)
+	measure(metrics, stageStream, start, reason)
 	if err != nil {
-		return nil, err
+		logger.Log(core.LevelWarn, "loading track failed", core.F(core.KeyError, err))
 	}
+	return file, err
+}
 
-	res := seekablehttp.New(vurl, t.Format.Clen)
+// open opens the stream of the format given, returning the reason it failed.
+func (t Track) open(format *Format, logger core.Logger, metrics core.Metrics) (core.PlaySeekable, string, error) {
+	vurl, err := format.GetValidUrl()
+	if err != nil {
+		return nil, "decipher", err
+	}
+
+	res := seekablehttp.New(vurl, format.Clen)
+	res.Logger = logger
+	res.Metrics = metrics
 
 	if size, err := res.Size(); err != nil {
-		return nil, err
+		return nil, "http", err
 	} else if size == 0 {
-		return nil, errors.New("got an empty request")
+		return nil, "empty", errors.New("got an empty request")
 	}
-	if strings.Split(t.Format.Type, ";")[0] == "audio/webm" {
+	if strings.Split(format.Type, ";")[0] == "audio/webm" {
 		parser, err := webm.New(res)
 
 		if err != nil {
-			return nil, err
+			_ = res.Close()
+			return nil, "parse", err
 		}
+		parser.Logger = logger
 
 		file, err := parser.Parse()
 		if err != nil {
-			panic(err)
-			return nil, err
+			_ = res.Close()
+			return nil, "parse", err
 		}
-		return file, nil
+		return file, "", nil
 	}
-	return nil, errors.New("mime type not supported")
+	_ = res.Close()
+	return nil, "unsupported", errors.New("mime type not supported")
 }
@@ -25,8 +25,10 @@ SOFTWARE.
 package youtube
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 var (
@@ -120,3 +122,53 @@ func TestTrack_Codec(t *testing.T) {
 	}
 	assert.Equal(t, "opus", track.Codec(), "the codec is supposed to be opus")
 }
+
+var searchResponse = `[{"page": "search"}, {"response": {"contents": {"twoColumnSearchResultsRenderer": {"primaryContents": {"sectionListRenderer": {"contents": [{"itemSectionRenderer": {"contents": [
+	{"channelRenderer": {"channelId": "UCuAXFkgsw1L7xaCfnd5JJOw", "title": {"simpleText": "Rick Astley"}}},
+	{"videoRenderer": {"videoId": "dQw4w9WgXcQ", "title": {"runs": [{"text": "Rick Astley - "}, {"text": "Never Gonna Give You Up (Video)"}]}, "ownerText": {"runs": [{"text": "RickAstleyVEVO"}]}, "lengthText": {"simpleText": "3:33"}}},
+	{"videoRenderer": {"videoId": "5qap5aO4i9A", "title": {"simpleText": "lofi hip hop radio"}, "longBylineText": {"runs": [{"text": "ChilledCow"}]}}},
+	{"videoRenderer": {"videoId": "yPYZpwSpKmA", "title": {"simpleText": "Together Forever"}, "ownerText": {"runs": [{"text": "RickAstleyVEVO"}]}, "lengthText": {"simpleText": "1:03:25"}}}
+]}}]}}}}}}]`
+
+func TestTrack_PlayableWithoutSource(t *testing.T) {
+	_, err := Track{VideoId: rickvid}.Playable()
+	assert.Equal(t, ErrNoSource, err, "a track without a format needs a source")
+}
+
+func TestParseSearchResults(t *testing.T) {
+	var v interface{}
+	assert.Nil(t, json.Unmarshal([]byte(searchResponse), &v), "error is supposed to be nil")
+	tracks := parseSearchResults(v, 5)
+	assert.Len(t, tracks, 3, "only the videos should be found")
+	assert.Equal(t, rickvid, tracks[0].VideoId)
+	assert.Equal(t, ricktitle, tracks[0].Title, "the runs should be joined")
+	assert.Equal(t, rickauth, tracks[0].Author)
+	assert.Equal(t, 213*time.Second, tracks[0].Duration())
+	assert.True(t, tracks[1].IsStream, "a video without a length is a live-stream")
+	assert.Equal(t, "ChilledCow", tracks[1].Author)
+	assert.Equal(t, time.Hour+3*time.Minute+25*time.Second, tracks[2].Length)
+	assert.Equal(t, "opus", tracks[2].Codec(), "the codec is supposed to be opus before resolving the format")
+
+	assert.Len(t, parseSearchResults(v, 1), 1, "the results should be limited")
+}
+
+var watchResponse = `[{"page": "watch"}, {"player": {"args": {}}}, {"response": {"contents": {"twoColumnWatchNextResults": {"secondaryResults": {"secondaryResults": {"results": [
+	{"compactAutoplayRenderer": {"contents": [{"compactVideoRenderer": {"videoId": "yPYZpwSpKmA", "title": {"simpleText": "Together Forever"}, "longBylineText": {"runs": [{"text": "RickAstleyVEVO"}]}, "lengthText": {"simpleText": "3:25"}}}]}},
+	{"compactVideoRenderer": {"videoId": "dQw4w9WgXcQ", "title": {"simpleText": "Never Gonna Give You Up"}, "longBylineText": {"runs": [{"text": "RickAstleyVEVO"}]}, "lengthText": {"simpleText": "3:33"}}},
+	{"compactRadioRenderer": {"playlistId": "RDdQw4w9WgXcQ"}},
+	{"compactVideoRenderer": {"videoId": "yPYZpwSpKmA", "title": {"simpleText": "Together Forever"}}},
+	{"compactVideoRenderer": {"videoId": "AC3Ejf7vPEY", "title": {"simpleText": "Whenever You Need Somebody"}, "longBylineText": {"runs": [{"text": "RickAstleyVEVO"}]}, "lengthText": {"simpleText": "3:54"}}}
+]}}}}}}]`
+
+func TestParseRelated(t *testing.T) {
+	var v interface{}
+	assert.Nil(t, json.Unmarshal([]byte(watchResponse), &v), "error is supposed to be nil")
+	tracks := parseRelated(v, rickvid, 5)
+	assert.Len(t, tracks, 2, "the video itself and duplicates should be left out")
+	assert.Equal(t, "yPYZpwSpKmA", tracks[0].VideoId, "the up next video should come first")
+	assert.Equal(t, rickauth, tracks[0].Author)
+	assert.Equal(t, 205*time.Second, tracks[0].Length)
+	assert.Equal(t, "AC3Ejf7vPEY", tracks[1].VideoId)
+
+	assert.Len(t, parseRelated(v, rickvid, 1), 1, "the results should be limited")
+}